@@ -1,11 +1,26 @@
 package main
 
 import (
+	"booker/config"
 	"booker/models"
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"os"
+	"time"
 )
 
 func main() {
-	db := models.ConnectToDatabase("booker.db")
-	models.CreateNewTables(db)
-	models.FillWithSampleData(db)
+	cfg, _, err := config.Load(os.Args[0], os.Args[1:], os.Getenv)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	} else if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx := context.Background()
+	db := models.ConnectToDatabase(cfg.Database, time.Duration(cfg.QueryTimeout))
+	models.CreateNewTables(ctx, db)
+	models.FillWithSampleData(ctx, db)
 }
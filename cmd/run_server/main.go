@@ -1,9 +1,51 @@
 package main
 
 import (
+	"booker/config"
 	"booker/http"
+	"booker/logging"
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	_ "time/tzdata" // time zones work even without them installed
 )
 
 func main() {
-	http.NewServer("booker.db").Run(":8080")
+	cfg, opts, err := config.Load(os.Args[0], os.Args[1:], os.Getenv)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	} else if err != nil {
+		log.Fatal(err)
+	}
+	if opts.Print {
+		if err := cfg.Print(os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	logger := cfg.Logger(os.Stderr)
+	logging.SetDefault(logger)
+	// whatever still uses the log package ends up in the same stream
+	log.SetFlags(0)
+	log.SetOutput(logger.Writer(logging.LevelInfo))
+
+	if cfg.WebDir != "" {
+		if err := http.UseWebDir(cfg.WebDir, cfg.ReloadTemplates); err != nil {
+			logger.Error("web files not loaded", "error", err)
+			os.Exit(1)
+		}
+	}
+
+	// requests in progress are finished before the server exits
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := http.NewServer(cfg).Run(ctx); err != nil {
+		logger.Error("server stopped", "error", err)
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,355 @@
+// Package config reads the settings of the server when it starts. Every
+// option has a default value, which can be changed in a JSON file, with an
+// environment variable and with a command line flag, in the order of
+// increasing precedence.
+package config
+
+import (
+	"booker/logging"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/mail"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EnvPrefix starts the names of the environment variables, the rest is
+// the name of the option in upper case, like BOOKER_SMTP_HOST
+const EnvPrefix = "BOOKER_"
+
+type Config struct {
+	Listen   string `json:"listen"`
+	Database string `json:"database"` // path of the SQLite file or its DSN
+	// longest time a single database statement may take, zero means no limit
+	QueryTimeout Duration `json:"query_timeout"`
+
+	SessionTTL Duration `json:"session_ttl"`
+	// zone of the business until it's chosen in the settings
+	Timezone string `json:"timezone"`
+
+	// templates and static files are read from WebDir instead of the
+	// embedded ones when it's set, ReloadTemplates is meant for development
+	WebDir          string `json:"web_dir"`
+	ReloadTemplates bool   `json:"reload_templates"`
+
+	LogFormat string `json:"log_format"` // logfmt or json
+	LogLevel  string `json:"log_level"`
+	// the metrics are served only on this address, which should be reachable
+	// just by the monitoring, and not at all when it's empty
+	MetricsListen string `json:"metrics_listen"`
+
+	SMTP     SMTP     `json:"smtp"`
+	TLS      TLS      `json:"tls"`
+	Features Features `json:"features"`
+}
+
+// SMTP is the server through which users who ask for it get their
+// notifications by email, they are only shown in the application without a host
+type SMTP struct {
+	Host     string `json:"host"`
+	Port     int    `json:"port"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	From     string `json:"from"`
+}
+
+// TLS enables HTTPS when both files are given. Plain HTTP requests to
+// RedirectListen are then redirected to HTTPS.
+type TLS struct {
+	CertFile       string `json:"cert_file"`
+	KeyFile        string `json:"key_file"`
+	RedirectListen string `json:"redirect_listen"`
+}
+
+func (t TLS) Enabled() bool {
+	return t.CertFile != ""
+}
+
+// Features can be turned off by the operator of the server
+type Features struct {
+	Registration   bool `json:"registration"`
+	DataExport     bool `json:"data_export"`
+	AccountErasure bool `json:"account_erasure"`
+}
+
+// Duration is written like "12h" or "30m" in the file
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+func Default() Config {
+	return Config{
+		Listen:       ":8080",
+		Database:     "booker.db",
+		QueryTimeout: Duration(5 * time.Second),
+		SessionTTL:   Duration(12 * time.Hour),
+		Timezone:     "Local",
+		LogFormat:    "logfmt",
+		LogLevel:     "info",
+		SMTP:         SMTP{Port: 587},
+		Features: Features{
+			Registration:   true,
+			DataExport:     true,
+			AccountErasure: true,
+		},
+	}
+}
+
+// option describes one setting, the name of its flag is the same as the
+// name of its environment variable after the prefix, just in lower case
+// and with dashes
+type option struct {
+	name  string
+	usage string
+	field func(c *Config) interface{}
+}
+
+var options = []option{
+	{"listen", "address on which the server listens", func(c *Config) interface{} { return &c.Listen }},
+	{"database", "path or DSN of the SQLite database", func(c *Config) interface{} { return &c.Database }},
+	{"query-timeout", "longest time a database statement may take, 0 for no limit", func(c *Config) interface{} { return &c.QueryTimeout }},
+	{"session-ttl", "how long users stay logged in", func(c *Config) interface{} { return &c.SessionTTL }},
+	{"timezone", "time zone of the business until it's set in the settings", func(c *Config) interface{} { return &c.Timezone }},
+	{"web-dir", "read templates and static files from this directory instead of the embedded ones", func(c *Config) interface{} { return &c.WebDir }},
+	{"reload-templates", "parse templates again on every request, for development together with -web-dir", func(c *Config) interface{} { return &c.ReloadTemplates }},
+	{"log-format", "format of the logs, logfmt or json", func(c *Config) interface{} { return &c.LogFormat }},
+	{"log-level", "least important level logged: debug, info, warn or error", func(c *Config) interface{} { return &c.LogLevel }},
+	{"metrics-listen", "address on which the metrics are served, none without it", func(c *Config) interface{} { return &c.MetricsListen }},
+	{"smtp-host", "SMTP server for outgoing emails", func(c *Config) interface{} { return &c.SMTP.Host }},
+	{"smtp-port", "port of the SMTP server", func(c *Config) interface{} { return &c.SMTP.Port }},
+	{"smtp-username", "user name for the SMTP server", func(c *Config) interface{} { return &c.SMTP.Username }},
+	{"smtp-password", "password for the SMTP server", func(c *Config) interface{} { return &c.SMTP.Password }},
+	{"smtp-from", "sender address of emails", func(c *Config) interface{} { return &c.SMTP.From }},
+	{"tls-cert-file", "certificate for HTTPS", func(c *Config) interface{} { return &c.TLS.CertFile }},
+	{"tls-key-file", "private key for HTTPS", func(c *Config) interface{} { return &c.TLS.KeyFile }},
+	{"tls-redirect-listen", "address on which plain HTTP is redirected to HTTPS", func(c *Config) interface{} { return &c.TLS.RedirectListen }},
+	{"feature-registration", "let customers create accounts themselves", func(c *Config) interface{} { return &c.Features.Registration }},
+	{"feature-data-export", "let users download their data", func(c *Config) interface{} { return &c.Features.DataExport }},
+	{"feature-account-erasure", "let users delete their accounts", func(c *Config) interface{} { return &c.Features.AccountErasure }},
+}
+
+func (o option) envName() string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(o.name, "-", "_"))
+}
+
+func (o option) set(c *Config, value string) error {
+	switch field := o.field(c).(type) {
+	case *string:
+		*field = value
+	case *int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		*field = n
+	case *bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		*field = b
+	case *Duration:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		*field = Duration(d)
+	}
+	return nil
+}
+
+// Options holds what was read from the command line besides the settings
+type Options struct {
+	Print bool // print the configuration and exit
+}
+
+// Load reads the configuration for the program from the file given with
+// -config or in BOOKER_CONFIG, the environment and the arguments, and
+// validates it
+func Load(program string, args []string, getenv func(string) string) (Config, Options, error) {
+	var opts Options
+	flags := flag.NewFlagSet(program, flag.ContinueOnError)
+	file := flags.String("config", getenv(EnvPrefix+"CONFIG"), "JSON file with the configuration")
+	flags.BoolVar(&opts.Print, "print-config", false, "print the configuration and exit")
+	values := make(map[string]string)
+	for _, o := range options {
+		o := o
+		usage := o.usage + " (" + o.envName() + ")"
+		if _, ok := o.field(&Config{}).(*bool); ok {
+			flags.Var(boolValue{values, o.name}, o.name, usage)
+		} else {
+			flags.Func(o.name, usage, func(v string) error {
+				values[o.name] = v
+				return nil
+			})
+		}
+	}
+	if err := flags.Parse(args); err != nil {
+		return Config{}, opts, err
+	}
+	if flags.NArg() > 0 {
+		return Config{}, opts, fmt.Errorf("unexpected arguments: %s", strings.Join(flags.Args(), " "))
+	}
+
+	c := Default()
+	if *file != "" {
+		if err := c.readFile(*file); err != nil {
+			return c, opts, err
+		}
+	}
+	for _, o := range options {
+		if v := getenv(o.envName()); v != "" {
+			if err := o.set(&c, v); err != nil {
+				return c, opts, fmt.Errorf("%s: %w", o.envName(), err)
+			}
+		}
+	}
+	for _, o := range options {
+		if v, ok := values[o.name]; ok {
+			if err := o.set(&c, v); err != nil {
+				return c, opts, fmt.Errorf("-%s: %w", o.name, err)
+			}
+		}
+	}
+	return c, opts, c.Validate()
+}
+
+// boolValue lets boolean flags be given without a value
+type boolValue struct {
+	values map[string]string
+	name   string
+}
+
+func (b boolValue) String() string { return "" }
+
+func (b boolValue) Set(v string) error {
+	if _, err := strconv.ParseBool(v); err != nil {
+		return err
+	}
+	b.values[b.name] = v
+	return nil
+}
+
+func (b boolValue) IsBoolFlag() bool { return true }
+
+func (c *Config) readFile(name string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	decoder := json.NewDecoder(f)
+	decoder.DisallowUnknownFields()
+	if err = decoder.Decode(c); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
+
+// Validate checks all options and reports every problem at once
+func (c Config) Validate() error {
+	var problems []string
+	if _, _, err := net.SplitHostPort(c.Listen); err != nil {
+		problems = append(problems, "invalid listen address: "+err.Error())
+	}
+	if c.MetricsListen != "" {
+		if _, _, err := net.SplitHostPort(c.MetricsListen); err != nil {
+			problems = append(problems, "invalid metrics address: "+err.Error())
+		} else if c.MetricsListen == c.Listen {
+			problems = append(problems, "metrics need an address of their own")
+		}
+	}
+	if c.Database == "" {
+		problems = append(problems, "database can't be empty")
+	}
+	if c.QueryTimeout < 0 {
+		problems = append(problems, "query timeout can't be negative")
+	}
+	if time.Duration(c.SessionTTL) < time.Minute {
+		problems = append(problems, "session TTL has to be at least a minute")
+	}
+	if _, err := time.LoadLocation(c.Timezone); c.Timezone == "" || err != nil {
+		problems = append(problems, "unknown time zone "+strconv.Quote(c.Timezone))
+	}
+	if _, err := logging.ParseFormat(c.LogFormat); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if _, err := logging.ParseLevel(c.LogLevel); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if c.ReloadTemplates && c.WebDir == "" {
+		problems = append(problems, "reloading templates needs a web directory")
+	}
+	if c.SMTP.Host != "" {
+		if c.SMTP.Port <= 0 || c.SMTP.Port > 65535 {
+			problems = append(problems, "invalid SMTP port")
+		}
+		if _, err := mail.ParseAddress(c.SMTP.From); err != nil {
+			problems = append(problems, "invalid SMTP sender address")
+		}
+	}
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		problems = append(problems, "TLS needs both a certificate and a key")
+	}
+	if c.TLS.RedirectListen != "" {
+		if !c.TLS.Enabled() {
+			problems = append(problems, "redirecting to HTTPS needs TLS")
+		} else if _, _, err := net.SplitHostPort(c.TLS.RedirectListen); err != nil {
+			problems = append(problems, "invalid redirect address: "+err.Error())
+		}
+	}
+	for _, file := range []string{c.TLS.CertFile, c.TLS.KeyFile} {
+		if file == "" {
+			continue
+		}
+		if _, err := os.Stat(file); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid configuration: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// Logger creates the logger writing to w, the configuration has to be
+// valid
+func (c Config) Logger(w io.Writer) *logging.Logger {
+	format, _ := logging.ParseFormat(c.LogFormat)
+	level, _ := logging.ParseLevel(c.LogLevel)
+	return logging.New(w, format, level)
+}
+
+// Print writes the configuration as JSON which can be used as the file,
+// with the password hidden
+func (c Config) Print(w io.Writer) error {
+	if c.SMTP.Password != "" {
+		c.SMTP.Password = "********"
+	}
+	b, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", b)
+	return err
+}
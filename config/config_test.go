@@ -0,0 +1,126 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func env(vars map[string]string) func(string) string {
+	return func(name string) string { return vars[name] }
+}
+
+func TestDefaults(t *testing.T) {
+	c, opts, err := Load("booker", nil, env(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c != Default() || opts.Print {
+		t.Errorf("Expected the default configuration, got %+v", c)
+	}
+}
+
+func TestPrecedence(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "booker.json")
+	content := `{
+		"listen": ":9000",
+		"database": "file.db",
+		"session_ttl": "2h",
+		"smtp": {"host": "smtp.example.com", "from": "booker@example.com"},
+		"features": {"registration": false}
+	}`
+	if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	vars := map[string]string{
+		"BOOKER_CONFIG":        file,
+		"BOOKER_DATABASE":      "env.db",
+		"BOOKER_SESSION_TTL":   "3h",
+		"BOOKER_SMTP_PORT":     "25",
+		"BOOKER_TIMEZONE":      "Europe/Warsaw",
+		"BOOKER_SMTP_PASSWORD": "secret",
+	}
+	args := []string{"-session-ttl", "4h", "-feature-data-export=false", "-print-config"}
+	c, opts, err := Load("booker", args, env(vars))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := Default()
+	expected.Listen = ":9000"
+	expected.Database = "env.db"
+	expected.SessionTTL = Duration(4 * time.Hour)
+	expected.Timezone = "Europe/Warsaw"
+	expected.SMTP = SMTP{Host: "smtp.example.com", Port: 25, Password: "secret", From: "booker@example.com"}
+	expected.Features.Registration = false
+	expected.Features.DataExport = false
+	if c != expected {
+		t.Errorf("Expected %+v, got %+v", expected, c)
+	}
+	if !opts.Print {
+		t.Error("Expected printing to be requested")
+	}
+
+	var out bytes.Buffer
+	if err = c.Print(&out); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out.String(), "secret") || !strings.Contains(out.String(), `"session_ttl": "4h0m0s"`) {
+		t.Errorf("Unexpected output: %s", out.String())
+	}
+
+	// the printed configuration can be read back
+	if err = os.WriteFile(file, out.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	again, _, err := Load("booker", []string{"-config", file}, env(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected.SMTP.Password = "********"
+	if again != expected {
+		t.Errorf("Expected %+v, got %+v", expected, again)
+	}
+}
+
+func TestValidation(t *testing.T) {
+	cases := [][]string{
+		{"-listen", "8080"},
+		{"-metrics-listen", "9090"},
+		{"-metrics-listen", ":8080"},
+		{"-database", ""},
+		{"-query-timeout", "-1s"},
+		{"-session-ttl", "10s"},
+		{"-session-ttl", "forever"},
+		{"-timezone", "Mars/Olympus"},
+		{"-reload-templates"},
+		{"-smtp-host", "smtp.example.com", "-smtp-from", "nobody"},
+		{"-smtp-host", "smtp.example.com", "-smtp-from", "a@example.com", "-smtp-port", "0"},
+		{"-tls-cert-file", "cert.pem"},
+		{"-tls-cert-file", "missing.pem", "-tls-key-file", "missing.key"},
+		{"-tls-redirect-listen", ":80"},
+		{"-log-format", "xml"},
+		{"-log-level", "loud"},
+		{"-feature-registration=maybe"},
+		{"-unknown"},
+		{"extra"},
+	}
+	for _, args := range cases {
+		if _, _, err := Load("booker", args, env(nil)); err == nil {
+			t.Errorf("Expected an error for %v", args)
+		}
+	}
+
+	if _, _, err := Load("booker", nil, env(map[string]string{"BOOKER_SMTP_PORT": "x"})); err == nil {
+		t.Error("Expected an error for an invalid environment variable")
+	}
+	file := filepath.Join(t.TempDir(), "booker.json")
+	os.WriteFile(file, []byte(`{"listen": ":80", "typo": 1}`), 0644)
+	if _, _, err := Load("booker", []string{"-config", file}, env(nil)); err == nil {
+		t.Error("Expected an error for an unknown option in the file")
+	}
+}
@@ -0,0 +1,225 @@
+package http
+
+import (
+	"booker/i18n"
+	"booker/logging"
+	"booker/models"
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	defaultApprovalHoldHours = 24
+	pendingExpiryInterval    = time.Minute
+
+	notPendingMessage = "this booking doesn't wait for approval anymore"
+)
+
+// notify leaves a message for the user in their language, failures are
+// only logged
+func (s *server) notify(ctx context.Context, userId int, format string, args ...interface{}) {
+	s.notifyWithReason(ctx, userId, "", format, args...)
+}
+
+// notifyWithReason adds the reason given by the employee to the message.
+// Users who asked for it get the message by email as well, which is sent
+// in the background.
+func (s *server) notifyWithReason(ctx context.Context, userId int, reason string, format string, args ...interface{}) {
+	u, err := models.GetUserById(ctx, s.db, userId)
+	if err != nil {
+		logging.FromContext(ctx).Error("recipient of the notification not read", "user_id", userId, "error", err)
+		return
+	}
+	lang := userLanguage(u)
+	message := i18n.Translate(lang, format, args...)
+	if reason != "" {
+		message += " " + i18n.Translate(lang, "Reason: %s", reason)
+	}
+	if err := models.CreateNotification(ctx, s.db, userId, message); err != nil {
+		logging.FromContext(ctx).Error("notification not saved", "user_id", userId, "error", err)
+	}
+
+	if s.sendMail == nil || !u.NotifyEmail || u.Email == "" {
+		return
+	}
+	logger := logging.FromContext(ctx)
+	go func() {
+		if err := s.sendMail(u.Email, i18n.Translate(lang, "Notification from Booker"), message); err != nil {
+			logger.Error("notification not emailed", "user_id", userId, "error", err)
+		}
+	}()
+}
+
+// approvalDeadline returns until when a pending booking of the date
+// holds it, the hold never outlasts the start of the visit
+func (s *server) approvalDeadline(ctx context.Context, date *models.Date) (time.Time, error) {
+	hours, err := models.GetSetting(ctx, s.db, models.SettingApprovalHoldHours,
+		strconv.Itoa(defaultApprovalHoldHours))
+	if err != nil {
+		return time.Time{}, err
+	}
+	n, err := strconv.Atoi(hours)
+	if err != nil {
+		return time.Time{}, err
+	}
+	deadline := time.Now().Add(time.Duration(n) * time.Hour)
+	if date.StartTime.Before(deadline) {
+		deadline = date.StartTime
+	}
+	return deadline, nil
+}
+
+// errBookingBlocked is returned by bookingNeedsApproval
+// when the user can't book the date at all
+var errBookingBlocked = errors.New("booking blocked because of missed visits")
+
+// bookingNeedsApproval tells whether a booking of the date by the user
+// has to wait for approval, either because the employee vets all their
+// bookings or because the customer missed too many visits
+func (s *server) bookingNeedsApproval(ctx context.Context, user *models.User, date *models.DateWithNames) (bool, error) {
+	rule, err := s.noShowRule(ctx, user)
+	if err != nil {
+		return false, err
+	} else if rule == models.NoShowBlock {
+		return false, errBookingBlocked
+	} else if rule == models.NoShowApproval {
+		return true, nil
+	}
+
+	emp, err := models.GetUserById(ctx, s.db, date.AssignedTo)
+	if err != nil {
+		return false, err
+	}
+	return emp.RequiresApproval && emp.Id != user.Id, nil
+}
+
+// bookedDateFromURL reads the booked date given in the URL,
+// which has to be assigned to the user unless they see all bookings
+func (s *server) bookedDateFromURL(r *http.Request) (*models.Date, error) {
+	user := getUser(r)
+	dateId, err := strconv.Atoi(chi.URLParam(r, "dateId"))
+	if err != nil {
+		return nil, statusError(http.StatusBadRequest)
+	}
+
+	date, err := models.GetDateById(r.Context(), s.db, dateId)
+	if err == models.ErrNotFound || (err == nil && date.BookedBy == -1) {
+		return nil, statusError(http.StatusBadRequest)
+	} else if err != nil {
+		return nil, err
+	} else if date.AssignedTo != user.Id && !user.Can(models.PermViewAllBookings) {
+		return nil, statusError(http.StatusForbidden)
+	}
+	return date, nil
+}
+
+func (s *server) approveBookingHandler(w http.ResponseWriter, r *http.Request) error {
+	user := getUser(r)
+	date, err := s.bookedDateFromURL(r)
+	if err != nil {
+		return err
+	}
+
+	err = models.ApproveBooking(r.Context(), s.db, date.Id)
+	if err == models.ErrNotPending {
+		return newError(http.StatusBadRequest, notPendingMessage)
+	} else if err != nil {
+		return err
+	}
+	s.notify(r.Context(), date.BookedBy, "Your booking of %s has been confirmed.", s.formatVisit(r.Context(), date))
+	s.auditEntry(r, &models.AuditEntry{
+		ActorId:      user.Id,
+		Action:       models.AuditApprove,
+		Target:       s.formatVisit(r.Context(), date),
+		TargetUserId: date.BookedBy,
+		TargetDateId: date.Id,
+	})
+
+	http.Redirect(w, r, "/assigned/", http.StatusFound)
+	return nil
+}
+
+func (s *server) rejectBookingHandler(w http.ResponseWriter, r *http.Request) error {
+	user := getUser(r)
+	date, err := s.bookedDateFromURL(r)
+	if err != nil {
+		return err
+	}
+
+	err = models.RejectBooking(r.Context(), s.db, date.Id)
+	if err == models.ErrNotPending {
+		return newError(http.StatusBadRequest, notPendingMessage)
+	} else if err != nil {
+		return err
+	}
+	s.notify(r.Context(), date.BookedBy, "Your booking of %s has been declined.", s.formatVisit(r.Context(), date))
+	s.auditEntry(r, &models.AuditEntry{
+		ActorId:      user.Id,
+		Action:       models.AuditReject,
+		Target:       s.formatVisit(r.Context(), date),
+		TargetUserId: date.BookedBy,
+		TargetDateId: date.Id,
+		Before:       auditValue(auditDate(date)),
+	})
+
+	http.Redirect(w, r, "/assigned/", http.StatusFound)
+	return nil
+}
+
+// expirePendingBookings releases dates of bookings which weren't
+// approved in time and lets the customers know
+func (s *server) expirePendingBookings(ctx context.Context, now time.Time) {
+	dates, err := models.ExpirePendingBookings(ctx, s.db, now)
+	if err != nil {
+		logging.FromContext(ctx).Error("pending bookings not expired", "error", err)
+		return
+	}
+	for _, d := range dates {
+		s.notify(ctx, d.BookedBy, "Your booking of %s wasn't confirmed in time and has been cancelled.",
+			s.formatVisit(ctx, d))
+		err := models.AddAuditEntry(ctx, s.db, &models.AuditEntry{
+			ActorId:      -1,
+			Action:       models.AuditExpire,
+			Target:       s.formatVisit(ctx, d),
+			TargetUserId: d.BookedBy,
+			TargetDateId: d.Id,
+			Before:       auditValue(auditDate(d)),
+		})
+		if err != nil {
+			logging.FromContext(ctx).Error("expiry not audited", "date_id", d.Id, "error", err)
+		}
+	}
+}
+
+// expirePendingBookingsPeriodically runs expirePendingBookings until stop is closed
+func (s *server) expirePendingBookingsPeriodically(interval time.Duration, stop <-chan struct{}) {
+	ctx := logging.NewContext(context.Background(), s.logger)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			s.expirePendingBookings(ctx, now)
+		case <-stop:
+			return
+		}
+	}
+}
+
+func (s *server) readNotificationsHandler(w http.ResponseWriter, r *http.Request) error {
+	user := getUser(r)
+	if user == nil {
+		return statusError(http.StatusForbidden)
+	}
+
+	if err := models.MarkNotificationsRead(r.Context(), s.db, user.Id); err != nil {
+		return err
+	}
+	http.Redirect(w, r, "/booked/", http.StatusFound)
+	return nil
+}
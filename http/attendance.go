@@ -0,0 +1,64 @@
+package http
+
+import (
+	"booker/models"
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const noShowBlockedMessage = "you can't book online because of missed visits, please contact us"
+
+// noShowRule returns what happens with bookings of the customer because
+// of missed visits: models.NoShowBlock, models.NoShowApproval or "" if
+// the customer is within the limit. Staff is never limited.
+func (s *server) noShowRule(ctx context.Context, u *models.User) (string, error) {
+	if u.IsStaff() {
+		return "", nil
+	}
+	limit, err := models.GetSetting(ctx, s.db, models.SettingNoShowLimit, "0")
+	if err != nil {
+		return "", err
+	}
+	n, err := strconv.Atoi(limit)
+	if err != nil || n <= 0 {
+		return "", err
+	}
+	noShows, err := models.CountNoShows(ctx, s.db, u.Id)
+	if err != nil || noShows < n {
+		return "", err
+	}
+	return models.GetSetting(ctx, s.db, models.SettingNoShowAction, models.NoShowBlock)
+}
+
+func (s *server) attendanceHandler(w http.ResponseWriter, r *http.Request) error {
+	user := getUser(r)
+
+	r.ParseForm()
+	status := r.Form.Get("status")
+	if !models.IsValidAttendance(status) {
+		return statusError(http.StatusBadRequest)
+	}
+	date, err := s.bookedDateFromURL(r)
+	if err != nil {
+		return err
+	} else if time.Now().Before(date.StartTime) {
+		return newError(http.StatusBadRequest, "attendance can be marked only after the visit starts")
+	}
+
+	if err = models.SetAttendance(r.Context(), s.db, date.Id, status, user.Id); err != nil {
+		return err
+	}
+	s.auditEntry(r, &models.AuditEntry{
+		ActorId:      user.Id,
+		Action:       models.AuditAttendance,
+		Target:       s.formatVisit(r.Context(), date),
+		TargetUserId: date.BookedBy,
+		TargetDateId: date.Id,
+		After:        auditValue(map[string]string{"status": status}),
+	})
+
+	http.Redirect(w, r, "/assigned/", http.StatusFound)
+	return nil
+}
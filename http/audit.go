@@ -0,0 +1,204 @@
+package http
+
+import (
+	"booker/logging"
+	"booker/models"
+	"encoding/csv"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// The audit log can't be changed, so it must not keep personal data
+// which erasing an account has to remove. Users are referenced only by
+// their ids, never by names in the target, and only the network of the
+// client is stored instead of its address.
+
+// audit records an action in the audit log, failures are only logged
+// so that they never break the request itself. Pass -1 if no user is
+// the target.
+func (s *server) audit(r *http.Request, actorId int, action string, targetUserId int, target string) {
+	s.auditEntry(r, &models.AuditEntry{
+		ActorId:      actorId,
+		Action:       action,
+		Target:       target,
+		TargetUserId: targetUserId,
+		TargetDateId: -1,
+	})
+}
+
+// auditEntry records an entry with target ids and before/after states,
+// the network of the client is filled in
+func (s *server) auditEntry(r *http.Request, e *models.AuditEntry) {
+	e.IP = auditNetwork(clientIP(r))
+	if err := models.AddAuditEntry(r.Context(), s.db, e); err != nil {
+		logError(r, err)
+	}
+}
+
+// auditNetwork truncates the address to its /24 network for IPv4
+// or /48 for IPv6, which still tells where requests came from
+func auditNetwork(ip string) string {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return ""
+	}
+	if v4 := addr.To4(); v4 != nil {
+		return v4.Mask(net.CIDRMask(24, 32)).String() + "/24"
+	}
+	return addr.Mask(net.CIDRMask(48, 128)).String() + "/48"
+}
+
+// auditValue serializes a state for the before/after columns,
+// nil is stored as an empty string
+func auditValue(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		logging.Default().Error("audit value not encoded", "error", err)
+		return ""
+	}
+	return string(b)
+}
+
+// auditedDate is the state of a date stored in the audit log
+type auditedDate struct {
+	Start      time.Time `json:"start"`
+	End        time.Time `json:"end"`
+	AssignedTo int       `json:"assignedTo"`
+	BookedBy   int       `json:"bookedBy"`
+}
+
+func auditDate(d *models.Date) auditedDate {
+	return auditedDate{d.StartTime, d.EndTime, d.AssignedTo, d.BookedBy}
+}
+
+// auditedUser is the state of a user stored in the audit log,
+// without the name and username which are personal data
+type auditedUser struct {
+	RoleId   int  `json:"roleId"`
+	Disabled bool `json:"disabled"`
+
+	RequiresApproval bool `json:"requiresApproval"`
+}
+
+func auditUser(u *models.User) auditedUser {
+	return auditedUser{u.RoleId, u.Disabled, u.RequiresApproval}
+}
+
+const auditPageSize = 200
+
+// readAuditFilter reads the filter from the query string,
+// invalid values are reported as field errors
+func readAuditFilter(r *http.Request) (models.AuditFilter, fieldErrors) {
+	q := r.URL.Query()
+	f := models.AuditFilter{Action: q.Get("action")}
+	fields := fieldErrors{}
+
+	ids := map[string]*int{
+		"actor": &f.ActorId,
+		"user":  &f.TargetUserId,
+		"date":  &f.TargetDateId,
+	}
+	for name, id := range ids {
+		if v := q.Get(name); v != "" {
+			var err error
+			if *id, err = strconv.Atoi(v); err != nil {
+				fields.add(name, "invalid id")
+			}
+		}
+	}
+
+	const layout = "2006-01-02"
+	if v := q.Get("from"); v != "" {
+		from, err := parseFormTime(r, layout, v)
+		if err != nil {
+			fields.add("from", "invalid start date")
+		}
+		f.From = from
+	}
+	if v := q.Get("to"); v != "" {
+		to, err := parseFormTime(r, layout, v)
+		if err != nil {
+			fields.add("to", "invalid end date")
+		}
+		f.To = to.AddDate(0, 0, 1)
+	}
+	return f, fields
+}
+
+func auditData(r *http.Request, entries []*models.AuditEntry) map[string]interface{} {
+	return map[string]interface{}{
+		"entries":  entries,
+		"actions":  models.AuditActions,
+		"query":    r.URL.Query(),
+		"rawQuery": r.URL.RawQuery,
+	}
+}
+
+func (s *server) auditView(w http.ResponseWriter, r *http.Request) error {
+	f, fields := readAuditFilter(r)
+	if len(fields) > 0 {
+		return formError("audit.html", auditData(r, nil), fields)
+	}
+	f.Limit = auditPageSize
+
+	entries, err := models.GetAuditEntries(r.Context(), s.db, f)
+	if err != nil {
+		return err
+	}
+
+	renderTemplate(w, r, "audit.html", auditData(r, entries))
+	return nil
+}
+
+func (s *server) auditExportHandler(w http.ResponseWriter, r *http.Request) error {
+	f, fields := readAuditFilter(r)
+	if len(fields) > 0 {
+		return formError("audit.html", auditData(r, nil), fields)
+	}
+
+	entries, err := models.GetAuditEntries(r.Context(), s.db, f)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="booker-audit.csv"`)
+
+	optionalId := func(id int) string {
+		if id == -1 {
+			return ""
+		}
+		return strconv.Itoa(id)
+	}
+
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"id", "time", "actorId", "actor", "action", "target",
+		"targetUserId", "targetUser", "targetDateId", "before", "after", "ip"})
+	for _, e := range entries {
+		cw.Write([]string{
+			strconv.Itoa(e.Id),
+			e.Time.Format(time.RFC3339),
+			optionalId(e.ActorId),
+			e.ActorName,
+			e.Action,
+			e.Target,
+			optionalId(e.TargetUserId),
+			e.TargetName,
+			optionalId(e.TargetDateId),
+			e.Before,
+			e.After,
+			e.IP,
+		})
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		logError(r, err)
+	}
+	return nil
+}
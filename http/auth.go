@@ -3,72 +3,151 @@ package http
 import (
 	"booker/models"
 	"context"
-	"log"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/google/uuid"
 )
 
-func (s *server) loginHandler(w http.ResponseWriter, r *http.Request) {
-	if !verifyForm(r, "username", "password") {
-		renderError(w, r, http.StatusBadRequest)
-		return
+func sessionCookie(r *http.Request, value string, expiresAt time.Time) *http.Cookie {
+	return &http.Cookie{
+		Name:     "session_token",
+		Value:    value,
+		Expires:  expiresAt,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+const (
+	invalidCredentialsMessage = "invalid username or password"
+	tooManyAttemptsMessage    = "too many failed login attempts, try again later"
+)
+
+func (s *server) loginHandler(w http.ResponseWriter, r *http.Request) error {
+	r.ParseForm()
+	username := r.Form.Get("username")
+	fields := fieldErrors{}
+	if username == "" {
+		fields.add("username", "username can't be empty")
+	}
+	if r.Form.Get("password") == "" {
+		fields.add("password", "password can't be empty")
+	}
+	if len(fields) > 0 {
+		return formError("login.html", nil, fields)
+	}
+
+	ip := clientIP(r)
+	wait := s.userLimiter.retryAfter(username)
+	if ipWait := s.ipLimiter.retryAfter(ip); ipWait > wait {
+		wait = ipWait
+	}
+	if wait > 0 {
+		s.audit(r, -1, models.AuditLoginFailed, -1, "")
+		w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+		return loginError(http.StatusTooManyRequests, tooManyAttemptsMessage)
 	}
 
-	u, err := models.GetUserByUsername(s.db, r.Form.Get("username"))
+	u, err := models.GetUserByUsername(r.Context(), s.db, username)
+	if err == models.ErrNotFound {
+		u = nil
+	} else if err != nil {
+		return err
+	}
+
+	if u != nil && u.IsLocked() {
+		s.audit(r, u.Id, models.AuditLoginFailed, u.Id, "")
+		return loginError(http.StatusTooManyRequests, tooManyAttemptsMessage)
+	} else if u == nil || u.Password != r.Form.Get("password") {
+		s.loginFailed(r, u, username)
+		return loginError(http.StatusBadRequest, invalidCredentialsMessage)
+	}
+
+	if u.Disabled {
+		s.audit(r, u.Id, models.AuditLoginFailed, u.Id, "")
+		return loginError(http.StatusForbidden, "this account is disabled")
+	}
 
-	if err != nil {
-		renderError(w, r, http.StatusInternalServerError)
-		log.Println(err)
-		return
-	} else if u.Password != r.Form.Get("password") {
-		addError(w, r, http.StatusBadRequest, "invalid username or password")
-		renderTemplate(w, r, "login.html", nil)
-		return
+	s.userLimiter.reset(username)
+	if u.FailedLogins != 0 {
+		if err = models.UnlockUser(r.Context(), s.db, u.Id); err != nil {
+			logError(r, err)
+		}
+	}
+
+	if u.TotpEnabled && !s.isTrustedDevice(r, u) {
+		return s.startSecondFactor(w, r, u)
 	}
 
+	return s.startSession(w, r, u)
+}
+
+// loginError shows the error above the login form
+func loginError(status int, message string) error {
+	e := newError(status, message)
+	e.template = "login.html"
+	return e
+}
+
+func (s *server) startSession(w http.ResponseWriter, r *http.Request, u *models.User) error {
 	sessionToken := uuid.NewString()
-	expiresAt := time.Now().Add(12 * time.Hour)
+	expiresAt := time.Now().Add(time.Duration(s.config.SessionTTL))
 
-	if err = models.CreateSession(s.db, sessionToken, u.Id, expiresAt); err != nil {
-		renderError(w, r, http.StatusInternalServerError)
-		log.Fatal(err)
-		return
+	if err := models.CreateSession(r.Context(), s.db, sessionToken, u.Id, expiresAt); err != nil {
+		return err
 	}
 
-	http.SetCookie(w, &http.Cookie{
-		Name:    "session_token",
-		Value:   sessionToken,
-		Expires: expiresAt,
-		Path:    "/",
-	})
+	http.SetCookie(w, sessionCookie(r, sessionToken, expiresAt))
+	s.audit(r, u.Id, models.AuditLogin, u.Id, "")
 
 	http.Redirect(w, r, "/", http.StatusSeeOther)
+	return nil
 }
 
-func (s *server) logoutHandler(w http.ResponseWriter, r *http.Request) {
-	c, err := r.Cookie("session_token")
-	if err != nil {
-		if err == http.ErrNoCookie {
-			renderError(w, r, http.StatusUnauthorized)
-		} else {
-			renderError(w, r, http.StatusBadRequest)
+// loginFailed counts a failed attempt and locks the account
+// when there were too many of them in a row
+func (s *server) loginFailed(r *http.Request, u *models.User, username string) {
+	s.userLimiter.fail(username)
+	s.ipLimiter.fail(clientIP(r))
+
+	actorId := -1
+	if u != nil {
+		actorId = u.Id
+		var lockedUntil time.Time
+		failures := u.FailedLogins + 1
+		// a lock which has expired starts the counting again
+		if !u.LockedUntil.IsZero() && !u.IsLocked() {
+			failures = 1
+		}
+		if failures >= loginLockoutThreshold {
+			lockedUntil = time.Now().Add(loginLockoutDuration)
+		}
+		if err := models.SetUserLoginFailures(r.Context(), s.db, u.Id, failures, lockedUntil); err != nil {
+			logError(r, err)
 		}
-		return
+	}
+	s.audit(r, actorId, models.AuditLoginFailed, actorId, "")
+}
+
+func (s *server) logoutHandler(w http.ResponseWriter, r *http.Request) error {
+	c, err := r.Cookie("session_token")
+	if err == http.ErrNoCookie {
+		return statusError(http.StatusUnauthorized)
+	} else if err != nil {
+		return statusError(http.StatusBadRequest)
 	}
 
 	sessionToken := c.Value
-	models.DeleteSession(s.db, sessionToken)
+	models.DeleteSession(r.Context(), s.db, sessionToken)
 
-	http.SetCookie(w, &http.Cookie{
-		Name:    "session_token",
-		Value:   "",
-		Expires: time.Now(),
-		Path:    "/",
-	})
+	http.SetCookie(w, sessionCookie(r, "", time.Now()))
 
 	http.Redirect(w, r, "/", http.StatusFound)
+	return nil
 }
 
 // middleware to read user from session
@@ -80,17 +159,45 @@ func (s *server) readUser(next http.Handler) http.Handler {
 			user = nil
 		} else {
 			sessionToken := c.Value
-			session, err := models.GetSessionByToken(s.db, sessionToken)
-			if err != nil {
-				renderError(w, r, http.StatusInternalServerError)
+			session, err := models.GetSessionByToken(r.Context(), s.db, sessionToken)
+			if err == models.ErrNotFound {
+				// signed out elsewhere, e.g. when the account was disabled
+				user = nil
+			} else if err != nil {
+				writeError(w, r, err)
+				return
 			} else if session.IsExpired() {
 				user = nil
-				models.DeleteSession(s.db, sessionToken)
+				models.DeleteSession(r.Context(), s.db, sessionToken)
 			} else {
-				user, err = models.GetUserById(s.db, session.UserId)
+				user, err = models.GetUserById(r.Context(), s.db, session.UserId)
+				if err != nil || user.Disabled {
+					user = nil
+				}
 			}
 		}
-		ctx := context.WithValue(r.Context(), "user", user)
+		ctx := context.WithValue(r.Context(), userKey, user)
+		if user != nil {
+			ctx = withUserLogger(ctx, user.Id)
+		}
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
+
+// requirePermission returns middleware which lets through only users
+// having at least one of the given permissions
+func requirePermission(permissions ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if user := getUser(r); user != nil {
+				for _, p := range permissions {
+					if user.Can(p) {
+						next.ServeHTTP(w, r)
+						return
+					}
+				}
+			}
+			writeError(w, r, statusError(http.StatusForbidden))
+		})
+	}
+}
@@ -0,0 +1,15 @@
+package http
+
+// contextKey is the type of the keys of values this package stores in
+// the context of a request, so that they can't clash with keys of others
+type contextKey int
+
+const (
+	userKey contextKey = iota
+	csrfTokenKey
+	languageKey
+	locationKey
+	featuresKey
+	pageKey
+	loggedRequestKey
+)
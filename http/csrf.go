@@ -0,0 +1,109 @@
+package http
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"html/template"
+	"log"
+	"net/http"
+)
+
+const (
+	csrfFieldName  = "csrf_token"
+	csrfHeaderName = "X-CSRF-Token"
+	csrfCookieName = "csrf_seed"
+)
+
+func newCsrfKey() []byte {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		log.Fatal(err)
+	}
+	return key
+}
+
+// csrfTokenFor derives the CSRF token bound to the given session
+func (s *server) csrfTokenFor(sessionToken string) string {
+	mac := hmac.New(sha256.New, s.csrfKey)
+	mac.Write([]byte(sessionToken))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// preSessionCsrfToken derives the token of visitors who aren't signed in
+// from a random cookie, which is issued on their first request. Forms
+// like the login one can't be sent from other sites then either.
+func (s *server) preSessionCsrfToken(w http.ResponseWriter, r *http.Request) string {
+	c, err := r.Cookie(csrfCookieName)
+	if err != nil || c.Value == "" {
+		seed := make([]byte, 32)
+		if _, err := rand.Read(seed); err != nil {
+			logError(r, err)
+			return ""
+		}
+		c = &http.Cookie{
+			Name:     csrfCookieName,
+			Value:    base64.RawURLEncoding.EncodeToString(seed),
+			Path:     "/",
+			HttpOnly: true,
+			Secure:   r.TLS != nil,
+			SameSite: http.SameSiteLaxMode,
+		}
+		http.SetCookie(w, c)
+	}
+	// kept apart from tokens of sessions
+	return s.csrfTokenFor("pre-session:" + c.Value)
+}
+
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+func getCsrfToken(r *http.Request) string {
+	val := r.Context().Value(csrfTokenKey)
+	if val != nil {
+		return val.(string)
+	} else {
+		return ""
+	}
+}
+
+// csrfField renders the hidden input expected by checkCsrf
+func csrfField(r *http.Request) template.HTML {
+	return template.HTML(`<input type="hidden" name="` + csrfFieldName +
+		`" value="` + template.HTMLEscapeString(getCsrfToken(r)) + `">`)
+}
+
+// middleware rejecting state-changing requests which don't carry the token
+// of the session, or of the visitor before they sign in
+func (s *server) checkCsrf(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var expected string
+		if c, err := r.Cookie("session_token"); err == nil && getUser(r) != nil {
+			expected = s.csrfTokenFor(c.Value)
+		} else {
+			expected = s.preSessionCsrfToken(w, r)
+		}
+		r = r.WithContext(context.WithValue(r.Context(), csrfTokenKey, expected))
+
+		if !isSafeMethod(r.Method) {
+			token := r.Header.Get(csrfHeaderName)
+			if token == "" {
+				token = r.PostFormValue(csrfFieldName)
+			}
+			if !hmac.Equal([]byte(token), []byte(expected)) {
+				writeError(w, r, newError(http.StatusForbidden,
+					"invalid or missing security token, please reload the page and try again"))
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,409 @@
+package http
+
+import (
+	"booker/models"
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	dateInputLayout    = "2006-01-02T15:04"
+	defaultDatesPeriod = 30 * 24 * time.Hour
+)
+
+// bulk operations on dates
+const (
+	bulkDelete   = "delete"
+	bulkShift    = "shift"
+	bulkReassign = "reassign"
+)
+
+// canManageDate tells whether the user may change the date
+func canManageDate(user *models.User, d *models.Date) bool {
+	return d.AssignedTo == user.Id || user.Can(models.PermManageSlots)
+}
+
+// managedDate reads the date given in the URL,
+// which the user has to be allowed to change
+func (s *server) managedDate(r *http.Request) (*models.DateWithNames, error) {
+	dateId, err := strconv.Atoi(chi.URLParam(r, "dateId"))
+	if err != nil {
+		return nil, statusError(http.StatusBadRequest)
+	}
+
+	date, err := models.GetDateWithNamesById(r.Context(), s.db, dateId)
+	if err != nil {
+		return nil, err
+	} else if !canManageDate(getUser(r), &date.Date) {
+		return nil, statusError(http.StatusForbidden)
+	}
+	return date, nil
+}
+
+// employeesFor returns employees the user may assign dates to,
+// nil if it's only the user
+func (s *server) employeesFor(ctx context.Context, user *models.User) ([]*models.User, error) {
+	if !user.Can(models.PermManageSlots) {
+		return nil, nil
+	}
+	return models.GetUsersWithPermission(ctx, s.db, models.PermOwnSlots)
+}
+
+func (s *server) datesData(r *http.Request) (map[string]interface{}, error) {
+	user := getUser(r)
+
+	empId := user.Id
+	if user.Can(models.PermManageSlots) {
+		empId = -1
+	}
+	if v := r.URL.Query().Get("employee"); v != "" {
+		var err error
+		if empId, err = strconv.Atoi(v); err != nil {
+			return nil, statusError(http.StatusBadRequest)
+		} else if empId != user.Id && !user.Can(models.PermManageSlots) {
+			return nil, statusError(http.StatusForbidden)
+		}
+	}
+
+	const layout = "2006-01-02"
+	today := time.Now().In(getLocation(r)).Format(layout)
+	from, err := parseFormTime(r, layout, r.URL.Query().Get("from"))
+	if err != nil {
+		from, _ = parseFormTime(r, layout, today)
+	}
+	to, err := parseFormTime(r, layout, r.URL.Query().Get("to"))
+	if err != nil || to.Before(from) {
+		to = from.Add(defaultDatesPeriod)
+	}
+
+	// the last day is included
+	dates, err := models.GetDatesWithNamesBetween(r.Context(), s.db, empId, from, to.AddDate(0, 0, 1))
+	if err != nil {
+		return nil, err
+	}
+	emps, err := s.employeesFor(r.Context(), user)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"dates":    dates,
+		"emps":     emps,
+		"employee": empId,
+		"from":     from.Format(layout),
+		"to":       to.Format(layout),
+	}, nil
+}
+
+func (s *server) datesView(w http.ResponseWriter, r *http.Request) error {
+	data, err := s.datesData(r)
+	if err != nil {
+		return err
+	}
+	renderTemplate(w, r, "dates.html", data)
+	return nil
+}
+
+// datesError shows the error above the list of dates
+func (s *server) datesError(r *http.Request, e *appError) error {
+	data, err := s.datesData(r)
+	if err != nil {
+		return err
+	}
+	e.template, e.data = "dates.html", data
+	return e
+}
+
+func (s *server) editDateData(r *http.Request, date *models.DateWithNames) (map[string]interface{}, error) {
+	emps, err := s.employeesFor(r.Context(), getUser(r))
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"date":  date,
+		"start": date.StartTime.In(getLocation(r)).Format(dateInputLayout),
+		"end":   date.EndTime.In(getLocation(r)).Format(dateInputLayout),
+		"emps":  emps,
+	}, nil
+}
+
+// editDateError shows the error with the form of the date
+func (s *server) editDateError(r *http.Request, date *models.DateWithNames, e *appError) error {
+	data, err := s.editDateData(r, date)
+	if err != nil {
+		return err
+	}
+	e.template, e.data = "edit_date.html", data
+	return e
+}
+
+func (s *server) editDateView(w http.ResponseWriter, r *http.Request) error {
+	date, err := s.managedDate(r)
+	if err != nil {
+		return err
+	} else if date.BookedBy != -1 {
+		return newError(http.StatusBadRequest, "booked dates can only be changed with bulk operations")
+	}
+	data, err := s.editDateData(r, date)
+	if err != nil {
+		return err
+	}
+	renderTemplate(w, r, "edit_date.html", data)
+	return nil
+}
+
+func (s *server) editDateHandler(w http.ResponseWriter, r *http.Request) error {
+	user := getUser(r)
+	date, err := s.managedDate(r)
+	if err != nil {
+		return err
+	}
+	r.ParseForm()
+
+	changed := date.Date
+	fields := fieldErrors{}
+	start, err := parseFormTime(r, dateInputLayout, r.Form.Get("start-time"))
+	if err != nil {
+		fields.add("start-time", "invalid start time")
+	}
+	end, err := parseFormTime(r, dateInputLayout, r.Form.Get("end-time"))
+	if err != nil || (len(fields) == 0 && !end.After(start)) {
+		fields.add("end-time", "invalid end time")
+	}
+	changed.StartTime, changed.EndTime = start, end
+
+	if r.Form.Has("employee") {
+		if !user.Can(models.PermManageSlots) {
+			return statusError(http.StatusForbidden)
+		}
+		empId, err := strconv.Atoi(r.Form.Get("employee"))
+		if err != nil {
+			empId = -1
+		}
+		emp, err := models.GetUserById(r.Context(), s.db, empId)
+		if err == models.ErrNotFound || (err == nil && !emp.Can(models.PermOwnSlots)) {
+			fields.add("employee", "unknown employee")
+		} else if err != nil {
+			return err
+		} else {
+			changed.AssignedTo = emp.Id
+		}
+	}
+	if len(fields) > 0 {
+		return s.editDateError(r, date, formError("", nil, fields))
+	}
+
+	err = models.UpdateDate(r.Context(), s.db, &changed)
+	if err == models.ErrDateTaken {
+		return newError(http.StatusBadRequest, "the date has been booked in the meantime")
+	} else if err == models.ErrEmployeeAbsent {
+		return s.editDateError(r, date, newError(http.StatusBadRequest, "the employee is absent at that time"))
+	} else if err == models.ErrDatesOverlap {
+		return s.editDateError(r, date, newError(http.StatusBadRequest,
+			"the date would overlap another date of the employee"))
+	} else if err != nil {
+		return err
+	}
+	s.auditEntry(r, &models.AuditEntry{
+		ActorId:      user.Id,
+		Action:       models.AuditEditDate,
+		Target:       s.formatVisit(r.Context(), &date.Date),
+		TargetUserId: changed.AssignedTo,
+		TargetDateId: date.Id,
+		Before:       auditValue(auditDate(&date.Date)),
+		After:        auditValue(auditDate(&changed)),
+	})
+
+	http.Redirect(w, r, "/dates/", http.StatusFound)
+	return nil
+}
+
+func (s *server) deleteDateHandler(w http.ResponseWriter, r *http.Request) error {
+	user := getUser(r)
+	date, err := s.managedDate(r)
+	if err != nil {
+		return err
+	}
+
+	err = models.DeleteDate(r.Context(), s.db, date.Id)
+	if err == models.ErrDateTaken {
+		return newError(http.StatusBadRequest, "booked dates can only be deleted with bulk operations")
+	} else if err != nil {
+		return err
+	}
+	s.auditEntry(r, &models.AuditEntry{
+		ActorId:      user.Id,
+		Action:       models.AuditDeleteDate,
+		Target:       s.formatVisit(r.Context(), &date.Date),
+		TargetUserId: date.AssignedTo,
+		TargetDateId: date.Id,
+		Before:       auditValue(auditDate(&date.Date)),
+	})
+
+	http.Redirect(w, r, "/dates/", http.StatusFound)
+	return nil
+}
+
+// bulkDatesHandler deletes, shifts or reassigns the selected dates.
+// If any of them is booked the operation has to be confirmed first
+// and the customers are notified about it.
+func (s *server) bulkDatesHandler(w http.ResponseWriter, r *http.Request) error {
+	user := getUser(r)
+	r.ParseForm()
+
+	ids := make([]int, len(r.Form["date"]))
+	for i, v := range r.Form["date"] {
+		var err error
+		if ids[i], err = strconv.Atoi(v); err != nil {
+			return statusError(http.StatusBadRequest)
+		}
+	}
+	dates, err := models.GetDatesByIds(r.Context(), s.db, ids)
+	if err != nil {
+		return err
+	}
+	for _, d := range dates {
+		if !canManageDate(user, d) {
+			return statusError(http.StatusForbidden)
+		}
+	}
+
+	fields := fieldErrors{}
+	if len(dates) == 0 {
+		fields.add("date", "no dates were selected")
+	}
+	action := r.Form.Get("action")
+	var shift time.Duration
+	var emp *models.User
+	switch action {
+	case bulkDelete:
+	case bulkShift:
+		minutes, err := strconv.Atoi(r.Form.Get("minutes"))
+		if err != nil || minutes == 0 {
+			fields.add("minutes", "invalid shift")
+		}
+		shift = time.Duration(minutes) * time.Minute
+	case bulkReassign:
+		if !user.Can(models.PermManageSlots) {
+			return statusError(http.StatusForbidden)
+		}
+		empId, err := strconv.Atoi(r.Form.Get("employee-to"))
+		if err != nil {
+			empId = -1
+		}
+		emp, err = models.GetUserById(r.Context(), s.db, empId)
+		if err == models.ErrNotFound || (err == nil && !emp.Can(models.PermOwnSlots)) {
+			fields.add("employee-to", "unknown employee")
+		} else if err != nil {
+			return err
+		}
+	default:
+		return statusError(http.StatusBadRequest)
+	}
+	if len(fields) > 0 {
+		return s.datesError(r, formError("", nil, fields))
+	}
+
+	var booked []*models.Date
+	for _, d := range dates {
+		if d.BookedBy != -1 {
+			booked = append(booked, d)
+		}
+	}
+	if len(booked) > 0 && r.Form.Get("confirm") != "1" {
+		renderTemplate(w, r, "dates_confirm.html", map[string]interface{}{
+			"ids":      ids,
+			"booked":   booked,
+			"action":   action,
+			"minutes":  r.Form.Get("minutes"),
+			"employee": r.Form.Get("employee-to"),
+			"reason":   r.Form.Get("reason"),
+			"emp":      emp,
+		})
+		return nil
+	}
+
+	reason := strings.TrimSpace(r.Form.Get("reason"))
+	if action == bulkDelete {
+		if err = models.DeleteDates(r.Context(), s.db, dates, user.Id, reason); err != nil {
+			return err
+		}
+		s.metrics.cancellations.Add(float64(len(booked)), "date_removed")
+		for _, d := range booked {
+			s.notifyWithReason(r.Context(), d.BookedBy, reason,
+				"Your booking of %s has been cancelled because the date was removed.", s.formatVisit(r.Context(), d))
+		}
+		s.auditDates(r, models.AuditDeleteDate, dates, nil)
+		http.Redirect(w, r, "/dates/", http.StatusFound)
+		return nil
+	}
+
+	moved := make([]*models.Date, len(dates))
+	for i, d := range dates {
+		m := *d
+		m.StartTime, m.EndTime = d.StartTime.Add(shift), d.EndTime.Add(shift)
+		if emp != nil {
+			m.AssignedTo = emp.Id
+		}
+		moved[i] = &m
+	}
+	err = models.MoveDates(r.Context(), s.db, moved)
+	if err == models.ErrEmployeeAbsent {
+		return s.datesError(r, newError(http.StatusBadRequest,
+			"some of the dates would fall into an absence of the employee"))
+	} else if err == models.ErrDatesOverlap {
+		return s.datesError(r, newError(http.StatusBadRequest,
+			"some of the dates would overlap other dates of the employee"))
+	} else if err != nil {
+		return err
+	}
+	s.notifyMovedBookings(r.Context(), dates, moved, emp, reason)
+	s.auditDates(r, models.AuditEditDate, dates, moved)
+	http.Redirect(w, r, "/dates/", http.StatusFound)
+	return nil
+}
+
+// notifyMovedBookings lets customers know their visits were moved
+func (s *server) notifyMovedBookings(ctx context.Context, before []*models.Date, after []*models.Date, emp *models.User, reason string) {
+	for i, d := range before {
+		if d.BookedBy == -1 {
+			continue
+		}
+		if emp != nil {
+			s.notifyWithReason(ctx, d.BookedBy, reason, "Your visit on %s will be handled by %s.",
+				s.formatVisit(ctx, d), emp.Name)
+		} else {
+			s.notifyWithReason(ctx, d.BookedBy, reason, "Your booking of %s has been moved to %s.",
+				s.formatVisit(ctx, d), s.formatVisit(ctx, after[i]))
+		}
+	}
+}
+
+// auditDates adds an entry for every changed date, after is nil for deleted ones
+func (s *server) auditDates(r *http.Request, action string, before []*models.Date, after []*models.Date) {
+	user := getUser(r)
+	for i, d := range before {
+		// the customer is the one affected by changes of booked dates
+		target := d.AssignedTo
+		if d.BookedBy != -1 {
+			target = d.BookedBy
+		}
+		e := models.AuditEntry{
+			ActorId:      user.Id,
+			Action:       action,
+			Target:       s.formatVisit(r.Context(), d),
+			TargetUserId: target,
+			TargetDateId: d.Id,
+			Before:       auditValue(auditDate(d)),
+		}
+		if after != nil {
+			e.After = auditValue(auditDate(after[i]))
+		}
+		s.auditEntry(r, &e)
+	}
+}
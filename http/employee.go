@@ -0,0 +1,63 @@
+package http
+
+import (
+	"booker/models"
+	"net/http"
+	"net/url"
+	"regexp"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// employeePageDays is how far ahead the public page of an employee
+// shows their free dates
+const employeePageDays = 14
+
+// validSlug matches addresses of public pages like "anna-nowak"
+var validSlug = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+const maxSlugLength = 40
+
+// isValidPhoto accepts absolute http(s) URLs and paths on this server
+func isValidPhoto(photo string) bool {
+	u, err := url.Parse(photo)
+	if err != nil {
+		return false
+	}
+	if u.Scheme == "" && u.Host == "" {
+		return len(u.Path) > 1 && u.Path[0] == '/' && u.Path[1] != '/'
+	}
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// employeeView is the public page of an employee which they can share
+// with their customers. Its dates are booked like any other ones.
+func (s *server) employeeView(w http.ResponseWriter, r *http.Request) error {
+	employee, err := models.GetUserBySlug(r.Context(), s.db, chi.URLParam(r, "slug"))
+	if err != nil {
+		return err
+	}
+	if employee.Disabled || !employee.Can(models.PermOwnSlots) {
+		return statusError(http.StatusNotFound)
+	}
+
+	loc := getLocation(r)
+	now := time.Now().In(loc)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	dates, err := models.SearchFreeDates(r.Context(), s.db, models.DateSearch{
+		From:          now,
+		To:            today.AddDate(0, 0, employeePageDays),
+		Location:      loc,
+		Employees:     []int{employee.Id},
+		OnlyEmployees: true,
+	})
+	if err != nil {
+		return err
+	}
+	renderTemplate(w, r, "employee.html", map[string]interface{}{
+		"employee": employee,
+		"dates":    dates,
+	})
+	return nil
+}
@@ -0,0 +1,176 @@
+package http
+
+import (
+	"booker/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// appError is returned by handlers when the request can't be served. The
+// message and the field errors are translated when they're shown, field
+// errors next to the inputs of the form, which is rendered again if the
+// error names its template.
+type appError struct {
+	status  int
+	message string // the status text when empty
+	args    []interface{}
+	fields  fieldErrors
+
+	template string
+	data     interface{}
+
+	err error // the cause, which is only logged
+}
+
+func (e *appError) Error() string {
+	if e.err != nil {
+		return e.err.Error()
+	}
+	if e.message != "" {
+		return fmt.Sprintf(e.message, e.args...)
+	}
+	return http.StatusText(e.status)
+}
+
+func (e *appError) Unwrap() error {
+	return e.err
+}
+
+// newError returns an error shown to the user with the status
+func newError(status int, format string, args ...interface{}) *appError {
+	return &appError{status: status, message: format, args: args}
+}
+
+// statusError returns an error shown with just the status
+func statusError(status int) *appError {
+	return &appError{status: status}
+}
+
+// fieldErrors are the problems with the inputs of a form by their names
+type fieldErrors map[string]string
+
+// add keeps only the first problem of every input
+func (f fieldErrors) add(field string, message string) {
+	if _, ok := f[field]; !ok {
+		f[field] = message
+	}
+}
+
+// formError asks for the form to be rendered again with the problems
+// shown next to the inputs
+func formError(template string, data interface{}, fields fieldErrors) *appError {
+	return &appError{
+		status:   http.StatusBadRequest,
+		message:  "please correct the marked fields",
+		fields:   fields,
+		template: template,
+		data:     data,
+	}
+}
+
+// handlerFunc returns the failure instead of rendering it itself
+type handlerFunc func(w http.ResponseWriter, r *http.Request) error
+
+// handle renders failures of the handler with writeError
+func handle(h handlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := h(w, r); err != nil {
+			writeError(w, r, err)
+		}
+	}
+}
+
+// asAppError gives errors of the models their status,
+// anything unexpected is an internal error
+func asAppError(err error) *appError {
+	var e *appError
+	switch {
+	case errors.As(err, &e):
+		return e
+	case errors.Is(err, models.ErrNotFound):
+		return &appError{status: http.StatusNotFound, err: err}
+	case errors.Is(err, models.ErrConflict):
+		return &appError{status: http.StatusConflict, err: err}
+	}
+	return &appError{status: http.StatusInternalServerError, err: err}
+}
+
+// writeError renders the error as JSON for clients which prefer it, or
+// else as the page of the error or the form which has to be corrected
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	e := asAppError(err)
+	if e.status >= 500 {
+		logError(r, err)
+	}
+
+	message := errorMessageFromStatus(r, e.status)
+	if e.message != "" {
+		message = tr(r, e.message, e.args...)
+	}
+	setError(r, e.status, message)
+	if len(e.fields) > 0 {
+		p := getPage(r)
+		p.fields = make(map[string]string, len(e.fields))
+		for name, m := range e.fields {
+			p.fields[name] = tr(r, m)
+		}
+	}
+
+	if e.template == "" || wantsJSON(r) {
+		renderTemplate(w, r, "error.html", nil)
+	} else {
+		renderTemplate(w, r, e.template, e.data)
+	}
+}
+
+type errorResponse struct {
+	Status int               `json:"status"`
+	Error  string            `json:"error"`
+	Fields map[string]string `json:"fields,omitempty"`
+}
+
+// writeJSONError sends the error stored in the page
+func writeJSONError(w http.ResponseWriter, r *http.Request) {
+	p := getPage(r)
+	status := readStatus(r)
+	if status < 400 {
+		status = http.StatusInternalServerError
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(errorResponse{status, p.err, p.fields})
+}
+
+// wantsJSON tells whether the client prefers JSON to HTML, which browsers
+// never do as they accept */* at most with the same quality
+func wantsJSON(r *http.Request) bool {
+	var htmlQ, jsonQ float64
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(part)
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		switch mediaType {
+		case "application/json":
+			if q > jsonQ {
+				jsonQ = q
+			}
+		case "text/html", "text/*", "*/*":
+			if q > htmlQ {
+				htmlQ = q
+			}
+		}
+	}
+	return jsonQ > htmlQ
+}
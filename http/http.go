@@ -1,56 +1,173 @@
 package http
 
 import (
+	"booker/config"
+	"booker/logging"
 	"booker/models"
+	"context"
 	"database/sql"
-	"log"
 	"net/http"
+	"time"
 
 	"github.com/go-chi/chi/v5"
-	"github.com/go-chi/chi/v5/middleware"
 )
 
 type server struct {
-	router *chi.Mux
-	db     *sql.DB
+	config      config.Config
+	router      *chi.Mux
+	metrics     *serverMetrics
+	logger      *logging.Logger
+	db          *sql.DB
+	csrfKey     []byte
+	location    locationCache
+	sendMail    mailer // nil when notifications can't be sent by email
+	userLimiter *loginLimiter
+	ipLimiter   *loginLimiter
 }
 
-func NewServer(dbfilename string) *server {
+func NewServer(cfg config.Config) *server {
 	s := server{
-		router: chi.NewRouter(),
-		db:     models.ConnectToDatabase(dbfilename),
+		config:      cfg,
+		logger:      logging.Default(),
+		router:      chi.NewRouter(),
+		db:          models.ConnectToDatabase(cfg.Database, time.Duration(cfg.QueryTimeout)),
+		csrfKey:     newCsrfKey(),
+		sendMail:    smtpMailer(cfg.SMTP),
+		userLimiter: newLoginLimiter(loginFreeAttemptsPerUser),
+		ipLimiter:   newLoginLimiter(loginFreeAttemptsPerIP),
 	}
+	s.metrics = s.newMetrics()
 	s.registerHandlers()
 	return &s
 }
 
-func (s *server) Run(addr string) {
-	log.Println("Starting server on " + addr)
-	log.Fatal(http.ListenAndServe(addr, s.router))
-}
-
 func (s *server) registerHandlers() {
-	r := s.router
+	s.router.Use(s.assignRequestID)
+	s.router.Use(logRequests)
+	s.router.Use(s.measureRequests)
+
+	// probes of the load balancer need no sessions and are logged
+	// only at the debug level, the metrics are served on their own address
+	s.router.Get("/healthz", s.healthzHandler)
+	s.router.Get("/readyz", s.readyzHandler)
+
+	s.router.Group(s.registerViews)
+}
 
+func (s *server) registerViews(r chi.Router) {
+	r.Use(preparePage)
 	r.Use(s.readUser)
-	r.Use(middleware.Logger)
+	r.Use(s.readLocation)
+	r.Use(s.readLanguage)
+	r.Use(s.readFeatures)
+	r.Use(s.checkCsrf)
+	r.Use(s.enforceTwoFactor)
 
-	r.Get("/", s.indexView)
-	r.Get("/booked/", s.bookedView)
+	r.Get("/", handle(s.indexView))
+	r.Get("/booked/", handle(s.bookedView))
 	r.Get("/login/", s.loginView)
-    r.Get("/register/", s.registerView)
-	r.Get("/add-date/", s.addDateView)
-	r.Get("/add-user/", s.addUserView)
-	r.Get("/assigned/", s.assignedView)
-
-	r.Post("/login/", s.loginHandler)
-    r.Post("/register/", s.registerHandler)
-	r.Post("/logout/", s.logoutHandler)
-	r.Post("/book/{dateId:[0-9]+}/", s.bookHandler)
-	r.Post("/unbook/{dateId:[0-9]+}/", s.unbookHandler)
-	r.Post("/add-date/", s.addDateHandler)
-	r.Post("/add-user/", s.addUserHandler)
-
-	fs := http.FileServer(http.Dir("web/static/"))
+	r.Get("/login/totp/", s.loginTotpView)
+	r.Get("/2fa/", handle(s.twoFactorView))
+	r.Get("/profile/", handle(s.profileView))
+	r.Get("/book/{dateId:[0-9]+}/", handle(s.bookView))
+	r.Get("/search/", handle(s.searchView))
+	r.Get("/e/{slug}/", handle(s.employeeView))
+
+	r.Post("/login/", handle(s.loginHandler))
+	r.Post("/login/totp/", handle(s.loginTotpHandler))
+	r.Post("/logout/", handle(s.logoutHandler))
+	r.Post("/book/{dateId:[0-9]+}/", handle(s.bookHandler))
+	r.Post("/unbook/{dateId:[0-9]+}/", handle(s.unbookHandler))
+	r.Post("/notifications/read/", handle(s.readNotificationsHandler))
+	r.Post("/2fa/setup/", handle(s.twoFactorSetupHandler))
+	r.Post("/2fa/enable/", handle(s.twoFactorEnableHandler))
+	r.Post("/2fa/recovery-codes/", handle(s.twoFactorRecoveryCodesHandler))
+	r.Post("/2fa/disable/", handle(s.twoFactorDisableHandler))
+	r.Post("/profile/", handle(s.profileHandler))
+
+	r.Group(func(r chi.Router) {
+		r.Use(requirePermission(models.PermOwnSlots, models.PermManageSlots))
+		r.Get("/add-date/", handle(s.addDateView))
+		r.Post("/add-date/", handle(s.addDateHandler))
+		r.Get("/schedule/", handle(s.scheduleView))
+		r.Post("/schedule/hours/", handle(s.workingHoursHandler))
+		r.Post("/schedule/breaks/", handle(s.createBreakHandler))
+		r.Post("/schedule/breaks/{breakId:[0-9]+}/delete/", handle(s.deleteBreakHandler))
+		r.Post("/schedule/absences/", handle(s.createAbsenceHandler))
+		r.Post("/schedule/absences/{absenceId:[0-9]+}/delete/", handle(s.deleteAbsenceHandler))
+		r.Post("/schedule/generate/", handle(s.generateDatesHandler))
+		r.Get("/dates/", handle(s.datesView))
+		r.Get("/dates/{dateId:[0-9]+}/", handle(s.editDateView))
+		r.Post("/dates/{dateId:[0-9]+}/", handle(s.editDateHandler))
+		r.Post("/dates/{dateId:[0-9]+}/delete/", handle(s.deleteDateHandler))
+		r.Post("/dates/bulk/", handle(s.bulkDatesHandler))
+	})
+
+	r.Group(func(r chi.Router) {
+		r.Use(requirePermission(models.PermOwnSlots, models.PermViewAllBookings))
+		r.Get("/assigned/", handle(s.assignedView))
+		r.Post("/assigned/{dateId:[0-9]+}/attendance/", handle(s.attendanceHandler))
+		r.Post("/assigned/{dateId:[0-9]+}/approve/", handle(s.approveBookingHandler))
+		r.Post("/assigned/{dateId:[0-9]+}/reject/", handle(s.rejectBookingHandler))
+	})
+
+	r.Group(func(r chi.Router) {
+		r.Use(requirePermission(models.PermManageUsers))
+		r.Get("/add-user/", handle(s.addUserView))
+		r.Get("/users/", handle(s.usersView))
+		r.Get("/users/locked/", handle(s.lockedUsersView))
+		r.Get("/users/{userId:[0-9]+}/", handle(s.editUserView))
+		r.Get("/users/{userId:[0-9]+}/delete/", handle(s.deleteUserView))
+		r.Get("/roles/", handle(s.rolesView))
+		r.Post("/add-user/", handle(s.addUserHandler))
+		r.Post("/users/{userId:[0-9]+}/", handle(s.editUserHandler))
+		r.Post("/users/{userId:[0-9]+}/unlock/", handle(s.unlockUserHandler))
+		r.Post("/users/{userId:[0-9]+}/delete/", handle(s.deleteUserHandler))
+		r.Post("/roles/", handle(s.createRoleHandler))
+		r.Post("/roles/assign/", handle(s.assignRoleHandler))
+		r.Post("/roles/{roleId:[0-9]+}/", handle(s.updateRoleHandler))
+	})
+
+	r.Group(func(r chi.Router) {
+		r.Use(requirePermission(models.PermEditSettings))
+		r.Get("/settings/", handle(s.settingsView))
+		r.Post("/settings/", handle(s.settingsHandler))
+		r.Get("/fields/", handle(s.fieldsView))
+		r.Post("/fields/", handle(s.createFieldHandler))
+		r.Post("/fields/{fieldId:[0-9]+}/delete/", handle(s.deleteFieldHandler))
+	})
+
+	r.Group(func(r chi.Router) {
+		r.Use(requirePermission(models.PermViewAuditLog))
+		r.Get("/audit/", handle(s.auditView))
+		r.Get("/audit/export.csv", handle(s.auditExportHandler))
+	})
+
+	if s.config.Features.Registration {
+		r.Get("/register/", handle(s.registerView))
+		r.Post("/register/", handle(s.registerHandler))
+	}
+	if s.config.Features.DataExport {
+		r.Get("/profile/export/", handle(s.exportDataHandler))
+	}
+	if s.config.Features.AccountErasure {
+		r.Get("/profile/delete/", handle(s.eraseAccountView))
+		r.Post("/profile/delete/", handle(s.eraseAccountHandler))
+	}
+
+	fs := http.FileServer(http.FS(staticFiles))
 	r.Handle("/static/*", http.StripPrefix("/static/", fs))
 }
+
+// readFeatures lets templates hide links to features which are turned off
+func (s *server) readFeatures(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), featuresKey, s.config.Features)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func getFeatures(r *http.Request) config.Features {
+	features, _ := r.Context().Value(featuresKey).(config.Features)
+	return features
+}
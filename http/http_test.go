@@ -1,18 +1,45 @@
 package http
 
 import (
+	"booker/config"
+	"booker/i18n"
+	"booker/logging"
 	"booker/models"
+	"booker/totp"
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/pem"
 	"fmt"
+	"io"
+	"io/fs"
+	"math/big"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 )
 
 func initTestingServer() *server {
-	s := NewServer("testing.db")
-	models.CreateNewTables(s.db)
-	models.FillWithSampleData(s.db)
+	cfg := config.Default()
+	cfg.Database = "testing.db"
+	s := NewServer(cfg)
+	models.CreateNewTables(context.Background(), s.db)
+	models.FillWithSampleData(context.Background(), s.db)
 	return s
 }
 
@@ -23,15 +50,25 @@ func checkResponseCode(t *testing.T, expected int, actual int) {
 }
 
 func loginAndReturnCookies(t *testing.T, s *server, credentials string) string {
-	w := httptest.NewRecorder()
-	r := httptest.NewRequest("POST", "/login/", strings.NewReader(credentials))
-	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	s.router.ServeHTTP(w, r)
+	w := postLogin(s, credentials)
 	checkResponseCode(t, http.StatusSeeOther, w.Code)
 	cookies := strings.Join(w.Result().Header["Set-Cookie"], "; ")
 	return cookies
 }
 
+// testCsrfSeed stands for the cookie given to visitors who aren't signed in
+const testCsrfSeed = "seed"
+
+func setCookiesWithCsrf(s *server, r *http.Request, cookies string) {
+	r.Header.Set("Cookie", cookies)
+	if c, err := r.Cookie("session_token"); err == nil {
+		r.Header.Set(csrfHeaderName, s.csrfTokenFor(c.Value))
+	} else {
+		r.AddCookie(&http.Cookie{Name: csrfCookieName, Value: testCsrfSeed})
+		r.Header.Set(csrfHeaderName, s.csrfTokenFor("pre-session:"+testCsrfSeed))
+	}
+}
+
 func loginAsAdmin(t *testing.T, s *server) string {
 	return loginAndReturnCookies(t, s, "username=admin&password=admin")
 }
@@ -54,9 +91,7 @@ func checkEmptyRequestWithCookies(
 ) *httptest.ResponseRecorder {
 	w := httptest.NewRecorder()
 	r := httptest.NewRequest(requestType, url, nil)
-	if cookies != "" {
-		r.Header.Set("Cookie", cookies)
-	}
+	setCookiesWithCsrf(s, r, cookies)
 	s.router.ServeHTTP(w, r)
 	checkResponseCode(t, expectedCode, w.Code)
 	return w
@@ -121,6 +156,196 @@ func TestBookUnbook(t *testing.T) {
 	checkEmptyRequestWithCookies(t, s, "POST", "/book/1/", bob, http.StatusFound)
 }
 
+func TestCsrf(t *testing.T) {
+	s := initTestingServer()
+
+	bob := loginAsBob(t, s)
+	if !strings.Contains(bob, "HttpOnly") || !strings.Contains(bob, "SameSite=Lax") {
+		t.Errorf("session cookie is missing security attributes: %s", bob)
+	}
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/book/1/", nil)
+	r.Header.Set("Cookie", bob)
+	s.router.ServeHTTP(w, r)
+	checkResponseCode(t, http.StatusForbidden, w.Code)
+	checkResponseBodySubstring(t, "security token", w)
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("POST", "/book/1/", strings.NewReader("csrf_token=forged"))
+	r.Header.Set("Cookie", bob)
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	s.router.ServeHTTP(w, r)
+	checkResponseCode(t, http.StatusForbidden, w.Code)
+
+	w = checkEmptyRequestWithCookies(t, s, "GET", "/", bob, http.StatusOK)
+	c, _ := r.Cookie("session_token")
+	token := s.csrfTokenFor(c.Value)
+	checkResponseBodySubstring(t, `name="csrf_token" value="`+token+`"`, w)
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("POST", "/book/1/", strings.NewReader("csrf_token="+token))
+	r.Header.Set("Cookie", bob)
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	s.router.ServeHTTP(w, r)
+	checkResponseCode(t, http.StatusFound, w.Code)
+
+	// visitors who aren't signed in get a token bound to a cookie
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("POST", "/login/", strings.NewReader("username=bob&password=123"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	s.router.ServeHTTP(w, r)
+	checkResponseCode(t, http.StatusForbidden, w.Code)
+
+	w = httptest.NewRecorder()
+	s.router.ServeHTTP(w, httptest.NewRequest("GET", "/login/", nil))
+	var seed *http.Cookie
+	for _, c := range w.Result().Cookies() {
+		if c.Name == csrfCookieName {
+			seed = c
+		}
+	}
+	if seed == nil || !seed.HttpOnly || seed.SameSite != http.SameSiteLaxMode {
+		t.Fatalf("Expected a CSRF cookie, got %v", w.Result().Cookies())
+	}
+	token = s.csrfTokenFor("pre-session:" + seed.Value)
+	checkResponseBodySubstring(t, `name="csrf_token" value="`+token+`"`, w)
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("POST", "/login/", strings.NewReader("username=bob&password=123&csrf_token="+token))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.AddCookie(seed)
+	s.router.ServeHTTP(w, r)
+	checkResponseCode(t, http.StatusSeeOther, w.Code)
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("POST", "/register/", strings.NewReader("name=Eve&username=eve&password=x&csrf_token="+token))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.AddCookie(&http.Cookie{Name: csrfCookieName, Value: "other"})
+	s.router.ServeHTTP(w, r)
+	checkResponseCode(t, http.StatusForbidden, w.Code)
+}
+
+func postFormWithCookies(s *server, url string, form string, cookies string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", url, strings.NewReader(form))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	setCookiesWithCsrf(s, r, cookies)
+	s.router.ServeHTTP(w, r)
+	return w
+}
+
+func joinCookies(w *httptest.ResponseRecorder) string {
+	var cookies []string
+	for _, c := range w.Result().Cookies() {
+		cookies = append(cookies, c.Name+"="+c.Value)
+	}
+	return strings.Join(cookies, "; ")
+}
+
+func TestTwoFactor(t *testing.T) {
+	s := initTestingServer()
+	const bobId = 4
+
+	bob := loginAsBob(t, s)
+	checkEmptyRequestWithCookies(t, s, "GET", "/2fa/", bob, http.StatusOK)
+	checkEmptyRequestWithCookies(t, s, "POST", "/2fa/setup/", bob, http.StatusFound)
+	w := checkEmptyRequestWithCookies(t, s, "GET", "/2fa/", bob, http.StatusOK)
+	checkResponseBodySubstring(t, "otpauth://totp/Booker:bob", w)
+
+	u, err := models.GetUserById(context.Background(), s.db, bobId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w = postFormWithCookies(s, "/2fa/enable/", "code=000000", bob)
+	checkResponseCode(t, http.StatusBadRequest, w.Code)
+	code, _ := totp.Code(u.TotpSecret, time.Now())
+	w = postFormWithCookies(s, "/2fa/enable/", "code="+code, bob)
+	checkResponseCode(t, http.StatusOK, w.Code)
+	checkResponseBodySubstring(t, "recovery codes", w)
+	recoveryCodes := regexp.MustCompile(`<code>([a-z2-7]{4}-[a-z2-7]{4})</code>`).FindAllStringSubmatch(w.Body.String(), -1)
+	if len(recoveryCodes) < 2 {
+		t.Fatal("Expected recovery codes in response body")
+	}
+	recoveryCode := recoveryCodes[0]
+
+	// every code is accepted once, so the login needs the next one
+	w = postFormWithCookies(s, "/2fa/recovery-codes/", "code="+code, bob)
+	checkResponseCode(t, http.StatusBadRequest, w.Code)
+	code, _ = totp.Code(u.TotpSecret, time.Now().Add(totp.Period))
+
+	// the password alone is not enough anymore
+	w = postLogin(s, "username=bob&password=123")
+	checkResponseCode(t, http.StatusSeeOther, w.Code)
+	if w.Header().Get("Location") != "/login/totp/" {
+		t.Errorf("Expected redirect to the second step, got %s", w.Header().Get("Location"))
+	}
+	pending := joinCookies(w)
+	if strings.Contains(pending, "session_token") {
+		t.Errorf("Session created before the second step")
+	}
+	checkEmptyRequestWithCookies(t, s, "GET", "/login/totp/", pending, http.StatusOK)
+	w = postFormWithCookies(s, "/login/totp/", "code=000000", pending)
+	checkResponseCode(t, http.StatusBadRequest, w.Code)
+	w = postFormWithCookies(s, "/login/totp/", "remember=1&code="+code, pending)
+	checkResponseCode(t, http.StatusSeeOther, w.Code)
+	trusted := joinCookies(w)
+	if !strings.Contains(trusted, "session_token") || !strings.Contains(trusted, "trusted_device") {
+		t.Errorf("Expected session and trusted device cookies, got %s", trusted)
+	}
+
+	// the pending login can't be reused
+	w = postFormWithCookies(s, "/login/totp/", "code="+code, pending)
+	checkResponseCode(t, http.StatusFound, w.Code)
+
+	// nor the code in another login
+	w = postLogin(s, "username=bob&password=123")
+	pending = joinCookies(w)
+	w = postFormWithCookies(s, "/login/totp/", "code="+code, pending)
+	checkResponseCode(t, http.StatusBadRequest, w.Code)
+
+	// remembered device skips the second step
+	w = postFormWithCookies(s, "/login/", "username=bob&password=123", trusted)
+	checkResponseCode(t, http.StatusSeeOther, w.Code)
+	if w.Header().Get("Location") != "/" {
+		t.Errorf("Expected trusted device to skip the second step")
+	}
+
+	// recovery codes work once
+	w = postLogin(s, "username=bob&password=123")
+	pending = joinCookies(w)
+	w = postFormWithCookies(s, "/login/totp/", "code="+strings.ToUpper(recoveryCode[1]), pending)
+	checkResponseCode(t, http.StatusSeeOther, w.Code)
+	w = postLogin(s, "username=bob&password=123")
+	pending = joinCookies(w)
+	w = postFormWithCookies(s, "/login/totp/", "code="+recoveryCode[1], pending)
+	checkResponseCode(t, http.StatusBadRequest, w.Code)
+
+	w = postFormWithCookies(s, "/2fa/disable/", "code="+recoveryCodes[1][1], bob)
+	checkResponseCode(t, http.StatusFound, w.Code)
+	loginAsBob(t, s)
+}
+
+func TestRequireStaffTwoFactor(t *testing.T) {
+	s := initTestingServer()
+
+	admin := loginAsAdmin(t, s)
+	andrzej := loginAsAndrzej(t, s)
+	bob := loginAsBob(t, s)
+
+	checkEmptyRequestWithCookies(t, s, "GET", "/settings/", andrzej, http.StatusForbidden)
+	checkEmptyRequestWithCookies(t, s, "GET", "/settings/", admin, http.StatusOK)
+	w := postFormWithCookies(s, "/settings/", "require_staff_totp=1", admin)
+	checkResponseCode(t, http.StatusFound, w.Code)
+
+	w = checkEmptyRequestWithCookies(t, s, "GET", "/assigned/", andrzej, http.StatusFound)
+	if w.Header().Get("Location") != "/2fa/" {
+		t.Errorf("Expected redirect to the enrolment page")
+	}
+	checkEmptyRequestWithCookies(t, s, "GET", "/2fa/", andrzej, http.StatusOK)
+	checkEmptyRequestWithCookies(t, s, "GET", "/booked/", bob, http.StatusOK)
+}
+
 func TestAddDateView(t *testing.T) {
 	s := initTestingServer()
 
@@ -159,7 +384,7 @@ func postAddDate(
 	w := httptest.NewRecorder()
 	r := httptest.NewRequest("POST", "/add-date/", strings.NewReader(formData))
 	if cookies != "" {
-		r.Header.Set("Cookie", cookies)
+		setCookiesWithCsrf(s, r, cookies)
 	}
 	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 	s.router.ServeHTTP(w, r)
@@ -187,17 +412,87 @@ func TestAddingDates(t *testing.T) {
 func TestInvalidLogin(t *testing.T) {
 	s := initTestingServer()
 
+	w := postLogin(s, "username=admin&password=123")
+	checkResponseCode(t, http.StatusBadRequest, w.Code)
+
+	w = postLogin(s, "username=admin")
+	checkResponseCode(t, http.StatusBadRequest, w.Code)
+
+	w = postLogin(s, "username=nobody&password=123")
+	checkResponseCode(t, http.StatusBadRequest, w.Code)
+	checkResponseBodySubstring(t, invalidCredentialsMessage, w)
+}
+
+func postLogin(s *server, credentials string) *httptest.ResponseRecorder {
 	w := httptest.NewRecorder()
-	r := httptest.NewRequest("POST", "/login/", strings.NewReader("username=admin&password=123"))
+	r := httptest.NewRequest("POST", "/login/", strings.NewReader(credentials))
 	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	setCookiesWithCsrf(s, r, "")
 	s.router.ServeHTTP(w, r)
+	return w
+}
+
+func TestLoginBackoff(t *testing.T) {
+	s := initTestingServer()
+
+	for i := 0; i < loginFreeAttemptsPerUser; i++ {
+		w := postLogin(s, "username=bob&password=wrong")
+		checkResponseCode(t, http.StatusBadRequest, w.Code)
+	}
+	w := postLogin(s, "username=bob&password=123")
+	checkResponseCode(t, http.StatusTooManyRequests, w.Code)
+	if w.Header().Get("Retry-After") == "" {
+		t.Errorf("Expected Retry-After header")
+	}
+
+	// other accounts from the same address are not affected
+	loginAsAndrzej(t, s)
+
+	// the backoff expires after a while
+	s.userLimiter.now = func() time.Time { return time.Now().Add(time.Hour) }
+	loginAsBob(t, s)
+}
+
+func TestLoginLockout(t *testing.T) {
+	s := initTestingServer()
+
+	const bobId = 4
+	err := models.SetUserLoginFailures(context.Background(), s.db, bobId, loginLockoutThreshold-1, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := postLogin(s, "username=bob&password=wrong")
 	checkResponseCode(t, http.StatusBadRequest, w.Code)
 
-	w = httptest.NewRecorder()
-	r = httptest.NewRequest("POST", "/login/", strings.NewReader("username=admin"))
-	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	s.router.ServeHTTP(w, r)
+	s.userLimiter.reset("bob")
+	w = postLogin(s, "username=bob&password=123")
+	checkResponseCode(t, http.StatusTooManyRequests, w.Code)
+
+	admin := loginAsAdmin(t, s)
+	w = checkEmptyRequestWithCookies(t, s, "GET", "/users/locked/", admin, http.StatusOK)
+	checkResponseBodySubstring(t, "(bob)", w)
+	checkEmptyRequestWithCookies(t, s, "POST", "/users/4/unlock/", "", http.StatusForbidden)
+	checkEmptyRequestWithCookies(t, s, "POST", "/users/4/unlock/", admin, http.StatusFound)
+
+	loginAsBob(t, s)
+
+	entries, err := models.GetAuditEntries(context.Background(), s.db, models.AuditFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entries[0].Action != models.AuditLogin || entries[0].TargetUserId != bobId {
+		t.Errorf("Expected the successful login to be audited, got %+v", entries[0])
+	}
+
+	// after the lock expires a single mistake doesn't lock the account again
+	err = models.SetUserLoginFailures(context.Background(), s.db, bobId, loginLockoutThreshold, time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w = postLogin(s, "username=bob&password=wrong")
 	checkResponseCode(t, http.StatusBadRequest, w.Code)
+	s.userLimiter.reset("bob")
+	loginAsBob(t, s)
 }
 
 func TestLogout(t *testing.T) {
@@ -231,17 +526,17 @@ func postAddUser(
 	name string,
 	username string,
 	password string,
-	userType int,
+	roleId int,
 	cookies string,
 	expectedCode int,
 ) {
-	formData := fmt.Sprintf("name=%s&username=%s&password=%s&type=%d",
-		name, username, password, userType)
+	formData := fmt.Sprintf("name=%s&username=%s&password=%s&role=%d",
+		name, username, password, roleId)
 
 	w := httptest.NewRecorder()
 	r := httptest.NewRequest("POST", "/add-user/", strings.NewReader(formData))
 	if cookies != "" {
-		r.Header.Set("Cookie", cookies)
+		setCookiesWithCsrf(s, r, cookies)
 	}
 	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 	s.router.ServeHTTP(w, r)
@@ -257,28 +552,1514 @@ func TestAddUser(t *testing.T) {
 	checkEmptyRequestWithCookies(t, s, "GET", "/add-user/", admin, http.StatusOK)
 	checkEmptyRequestWithCookies(t, s, "GET", "/add-user/", andrzej, http.StatusForbidden)
 
-	postAddUser(t, s, "Tomasz", "totomek", "kemotot", models.UserTypeEmployee, andrzej, http.StatusForbidden)
-	postAddUser(t, s, "Tomasz", "totomek", "kemotot", models.UserTypeEmployee, admin, http.StatusOK)
-	postAddUser(t, s, "Tomasz", "totomek", "kemotot", models.UserTypeEmployee, admin, http.StatusBadRequest)
+	postAddUser(t, s, "Tomasz", "totomek", "kemotot", models.RoleEmployee, andrzej, http.StatusForbidden)
+	postAddUser(t, s, "Tomasz", "totomek", "kemotot", models.RoleEmployee, admin, http.StatusSeeOther)
+	postAddUser(t, s, "Tomasz", "totomek", "kemotot", models.RoleEmployee, admin, http.StatusConflict)
 }
 
-func TestDisconnectedDatabase(t *testing.T) {
+func TestRoles(t *testing.T) {
 	s := initTestingServer()
 
 	admin := loginAsAdmin(t, s)
+	andrzej := loginAsAndrzej(t, s)
+	bob := loginAsBob(t, s)
 
-	if err := s.db.Close(); err != nil {
-		t.Errorf("Closing the database failed")
+	checkEmptyRequestWithCookies(t, s, "GET", "/roles/", andrzej, http.StatusForbidden)
+	w := checkEmptyRequestWithCookies(t, s, "GET", "/roles/", admin, http.StatusOK)
+	checkResponseBodySubstring(t, "view_all_bookings", w)
+
+	w = postFormWithCookies(s, "/roles/", "name=Receptionist&permission=view_all_bookings", andrzej)
+	checkResponseCode(t, http.StatusForbidden, w.Code)
+	w = postFormWithCookies(s, "/roles/", "name=Receptionist&permission=fly", admin)
+	checkResponseCode(t, http.StatusBadRequest, w.Code)
+	w = postFormWithCookies(s, "/roles/", "name=Receptionist&permission=view_all_bookings", admin)
+	checkResponseCode(t, http.StatusFound, w.Code)
+
+	checkEmptyRequestWithCookies(t, s, "GET", "/assigned/", bob, http.StatusForbidden)
+	w = postFormWithCookies(s, "/roles/assign/", "user=4&role=4", admin)
+	checkResponseCode(t, http.StatusFound, w.Code)
+	w = checkEmptyRequestWithCookies(t, s, "GET", "/assigned/", bob, http.StatusOK)
+	checkResponseBodySubstring(t, "Fabian:", w)
+	checkEmptyRequestWithCookies(t, s, "GET", "/add-date/", bob, http.StatusForbidden)
+
+	w = postFormWithCookies(s, "/roles/4/", "permission=manage_slots", admin)
+	checkResponseCode(t, http.StatusFound, w.Code)
+	checkEmptyRequestWithCookies(t, s, "GET", "/add-date/", bob, http.StatusOK)
+	checkEmptyRequestWithCookies(t, s, "GET", "/assigned/", bob, http.StatusForbidden)
+
+	w = postFormWithCookies(s, "/roles/1/", "permission=manage_slots", admin)
+	checkResponseCode(t, http.StatusForbidden, w.Code)
+}
+
+func TestRoleEscalation(t *testing.T) {
+	s := initTestingServer()
+
+	admin := loginAsAdmin(t, s)
+	andrzej := loginAsAndrzej(t, s)
+
+	// admins can't demote themselves, which could leave no admin
+	w := postFormWithCookies(s, "/roles/assign/", "user=1&role=3", admin)
+	checkResponseCode(t, http.StatusForbidden, w.Code)
+
+	// Andrzej becomes a manager of users without other permissions
+	w = postFormWithCookies(s, "/roles/", "name=Manager&permission=own_slots&permission=manage_users", admin)
+	checkResponseCode(t, http.StatusFound, w.Code)
+	w = postFormWithCookies(s, "/roles/assign/", "user=2&role=4", admin)
+	checkResponseCode(t, http.StatusFound, w.Code)
+
+	// roles are created and changed only with the permissions of the manager
+	w = postFormWithCookies(s, "/roles/", "name=Boss&permission=manage_users&permission=edit_settings", andrzej)
+	checkResponseCode(t, http.StatusForbidden, w.Code)
+	checkResponseBodySubstring(t, "you can&#39;t grant permissions you don&#39;t have yourself", w)
+	w = postFormWithCookies(s, "/roles/4/", "permission=manage_users&permission=edit_settings", andrzej)
+	checkResponseCode(t, http.StatusForbidden, w.Code)
+	w = postFormWithCookies(s, "/roles/", "name=Helper&permission=own_slots", andrzej)
+	checkResponseCode(t, http.StatusFound, w.Code)
+
+	// the admin role is given only by admins, nobody changes their own role
+	w = postFormWithCookies(s, "/roles/assign/", "user=2&role=1", andrzej)
+	checkResponseCode(t, http.StatusForbidden, w.Code)
+	w = postFormWithCookies(s, "/roles/assign/", "user=4&role=1", andrzej)
+	checkResponseCode(t, http.StatusForbidden, w.Code)
+	checkResponseBodySubstring(t, "only administrators can assign the admin role", w)
+	w = postFormWithCookies(s, "/users/4/", "name=bob&username=bob&role=1", andrzej)
+	checkResponseCode(t, http.StatusForbidden, w.Code)
+	w = postFormWithCookies(s, "/add-user/", "name=Eve&username=eve&password=eve&role=1", andrzej)
+	checkResponseCode(t, http.StatusBadRequest, w.Code)
+	checkResponseBodySubstring(t, "only administrators can assign the admin role", w)
+	w = postFormWithCookies(s, "/roles/assign/", "user=4&role=5", andrzej)
+	checkResponseCode(t, http.StatusFound, w.Code)
+
+	// accounts with more permissions are out of reach
+	w = postFormWithCookies(s, "/roles/assign/", "user=1&role=3", andrzej)
+	checkResponseCode(t, http.StatusForbidden, w.Code)
+	w = postFormWithCookies(s, "/users/1/", "name=admin&username=admin&role=1&password=mine", andrzej)
+	checkResponseCode(t, http.StatusForbidden, w.Code)
+	w = postFormWithCookies(s, "/users/1/delete/", "dates=delete", andrzej)
+	checkResponseCode(t, http.StatusForbidden, w.Code)
+	loginAsAdmin(t, s)
+}
+
+func TestUserManagement(t *testing.T) {
+	s := initTestingServer()
+
+	admin := loginAsAdmin(t, s)
+	andrzej := loginAsAndrzej(t, s)
+	bob := loginAsBob(t, s)
+
+	checkEmptyRequestWithCookies(t, s, "GET", "/users/", andrzej, http.StatusForbidden)
+	w := checkEmptyRequestWithCookies(t, s, "GET", "/users/?q=prac", admin, http.StatusOK)
+	checkResponseBodySubstring(t, "Andrzej", w)
+	checkResponseBodySubstring(t, "Fabian", w)
+	if strings.Contains(w.Body.String(), "(bob)") {
+		t.Errorf("Search returned users which don't match")
 	}
+	checkEmptyRequestWithCookies(t, s, "GET", "/users/4/", admin, http.StatusOK)
+	checkEmptyRequestWithCookies(t, s, "GET", "/users/100/", admin, http.StatusNotFound)
 
-	checkEmptyRequestWithCookies(t, s, "GET", "/", admin, http.StatusInternalServerError)
-	checkEmptyRequestWithCookies(t, s, "GET", "/booked/", admin, http.StatusInternalServerError)
-	checkEmptyRequestWithCookies(t, s, "POST", "/book/1/", admin, http.StatusInternalServerError)
-	checkEmptyRequestWithCookies(t, s, "POST", "/unbook/1/", admin, http.StatusInternalServerError)
+	// disabling signs the user out and blocks signing in
+	w = postFormWithCookies(s, "/users/4/", "name=Bobby&username=bob&role=3&disabled=1", admin)
+	checkResponseCode(t, http.StatusFound, w.Code)
+	checkEmptyRequestWithCookies(t, s, "GET", "/booked/", bob, http.StatusForbidden)
+	w = postLogin(s, "username=bob&password=123")
+	checkResponseCode(t, http.StatusForbidden, w.Code)
 
-	w := httptest.NewRecorder()
-	r := httptest.NewRequest("POST", "/login/", strings.NewReader("username=admin&password=admin"))
-	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	s.router.ServeHTTP(w, r)
+	w = postFormWithCookies(s, "/users/4/", "name=Bobby&username=pracownik&role=3", admin)
+	checkResponseCode(t, http.StatusConflict, w.Code)
+	checkResponseBodySubstring(t, "username is already taken", w)
+	w = postFormWithCookies(s, "/users/4/", "name=Bobby&username=bob&role=3&password=456", admin)
+	checkResponseCode(t, http.StatusFound, w.Code)
+	bob = loginAndReturnCookies(t, s, "username=bob&password=456")
+
+	w = postFormWithCookies(s, "/users/1/", "name=Admin&username=admin&role=1&disabled=1", admin)
+	checkResponseCode(t, http.StatusForbidden, w.Code)
+	w = postFormWithCookies(s, "/users/1/", "name=Admin&username=admin&role=3", admin)
+	checkResponseCode(t, http.StatusForbidden, w.Code)
+
+	// upcoming dates of a deleted employee go only to someone free at the time
+	w = checkEmptyRequestWithCookies(t, s, "GET", "/users/2/delete/", admin, http.StatusOK)
+	checkResponseBodySubstring(t, "has 5 upcoming dates", w)
+	w = postFormWithCookies(s, "/users/2/delete/", "dates=reassign&reassign-to=2", admin)
+	checkResponseCode(t, http.StatusBadRequest, w.Code)
+	w = postFormWithCookies(s, "/users/2/delete/", "dates=reassign&reassign-to=3", admin)
+	checkResponseCode(t, http.StatusBadRequest, w.Code)
+	checkResponseBodySubstring(t, "some of the dates would overlap other dates of the employee", w)
+
+	// deleting booked dates is confirmed first and cancels the bookings
+	w = postFormWithCookies(s, "/book/1/", "", bob)
+	checkResponseCode(t, http.StatusFound, w.Code)
+	w = postFormWithCookies(s, "/users/2/delete/", "dates=delete&reason=closing", admin)
+	checkResponseCode(t, http.StatusOK, w.Code)
+	checkResponseBodySubstring(t, "Deleting these booked dates will cancel their bookings", w)
+	w = postFormWithCookies(s, "/users/2/delete/", "dates=delete&reason=closing&confirm=1", admin)
+	checkResponseCode(t, http.StatusFound, w.Code)
+	w = postLogin(s, "username=pracownik&password=roku")
+	checkResponseCode(t, http.StatusBadRequest, w.Code)
+
+	dates, err := models.GetDatesWithNamesAssignedTo(context.Background(), s.db, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dates) != 0 {
+		t.Errorf("Expected the dates to be deleted, got %d", len(dates))
+	}
+	cancellations, err := models.GetCancellationsBookedBy(context.Background(), s.db, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cancellations) != 1 || cancellations[0].Reason != "closing" {
+		t.Errorf("Expected the booking to be recorded as cancelled, got %+v", cancellations)
+	}
+	w = checkEmptyRequestWithCookies(t, s, "GET", "/booked/", bob, http.StatusOK)
+	checkResponseBodySubstring(t, "has been cancelled because the date was removed", w)
+
+	w = postFormWithCookies(s, "/users/1/delete/", "dates=delete", admin)
+	checkResponseCode(t, http.StatusForbidden, w.Code)
+}
+
+func TestProfileAndBookingFields(t *testing.T) {
+	s := initTestingServer()
+
+	admin := loginAsAdmin(t, s)
+	andrzej := loginAsAndrzej(t, s)
+	bob := loginAsBob(t, s)
+
+	checkEmptyRequestWithCookies(t, s, "GET", "/profile/", "", http.StatusForbidden)
+	w := postFormWithCookies(s, "/profile/", "name=bob&email=not-an-email", bob)
+	checkResponseCode(t, http.StatusBadRequest, w.Code)
+
+	// notifications are emailed only when there's a server for it
+	w = checkEmptyRequestWithCookies(t, s, "GET", "/profile/", bob, http.StatusOK)
+	if strings.Contains(w.Body.String(), "notify-email") || strings.Contains(w.Body.String(), "notify-sms") {
+		t.Errorf("Expected no notifications by email or SMS to be offered")
+	}
+	type email struct{ to, subject, body string }
+	emails := make(chan email, 1)
+	s.sendMail = func(to string, subject string, body string) error {
+		emails <- email{to, subject, body}
+		return nil
+	}
+	w = postFormWithCookies(s, "/profile/", "name=bob&notify-email=1", bob)
+	checkResponseCode(t, http.StatusBadRequest, w.Code)
+	checkResponseBodySubstring(t, "email notifications need an email address", w)
+	w = postFormWithCookies(s, "/profile/", "name=Bob+Smith&email=bob@example.com&phone=555-123&language=pl&notify-email=1", bob)
+	checkResponseCode(t, http.StatusFound, w.Code)
+	w = checkEmptyRequestWithCookies(t, s, "GET", "/profile/", bob, http.StatusOK)
+	checkResponseBodySubstring(t, `value="bob@example.com"`, w)
+
+	s.notify(context.Background(), 4, "Your booking of %s has been confirmed.", "1.01")
+	select {
+	case e := <-emails:
+		if e.to != "bob@example.com" || e.subject != "Powiadomienie z Bookera" || !strings.Contains(e.body, "1.01") {
+			t.Errorf("Unexpected email %+v", e)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("Expected the notification to be emailed")
+	}
+
+	checkEmptyRequestWithCookies(t, s, "GET", "/fields/", andrzej, http.StatusForbidden)
+	w = postFormWithCookies(s, "/fields/", "label=Phone&required=1&profile-field=phone", admin)
+	checkResponseCode(t, http.StatusFound, w.Code)
+	w = postFormWithCookies(s, "/fields/", "label=Notes", admin)
+	checkResponseCode(t, http.StatusFound, w.Code)
+	w = postFormWithCookies(s, "/fields/", "label=Age&profile-field=age", admin)
+	checkResponseCode(t, http.StatusBadRequest, w.Code)
+
+	w = checkEmptyRequestWithCookies(t, s, "GET", "/book/1/", bob, http.StatusOK)
+	checkResponseBodySubstring(t, `name="field-1" value="555-123"`, w)
+	checkResponseBodySubstring(t, `name="field-2" value=""`, w)
+
+	w = postFormWithCookies(s, "/book/1/", "field-2=hello", bob)
+	checkResponseCode(t, http.StatusBadRequest, w.Code)
+	checkResponseBodySubstring(t, `value="hello"`, w)
+	w = postFormWithCookies(s, "/book/1/", "field-1=555-999&field-2=hello", bob)
+	checkResponseCode(t, http.StatusFound, w.Code)
+	checkEmptyRequestWithCookies(t, s, "GET", "/book/1/", bob, http.StatusBadRequest)
+
+	w = checkEmptyRequestWithCookies(t, s, "GET", "/assigned/", andrzej, http.StatusOK)
+	checkResponseBodySubstring(t, "Phone: 555-999", w)
+	checkResponseBodySubstring(t, "Notes: hello", w)
+
+	// answers are dropped together with the booking
+	checkEmptyRequestWithCookies(t, s, "POST", "/unbook/1/", bob, http.StatusFound)
+	answers, err := models.GetBookingAnswers(context.Background(), s.db, []int{1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(answers[1]) != 0 {
+		t.Errorf("Expected answers to be removed when unbooking")
+	}
+}
+
+func TestDataExportAndErasure(t *testing.T) {
+	s := initTestingServer()
+	const bobId = 4
+	const andrzejId = 2
+
+	andrzej := loginAsAndrzej(t, s)
+	bob := loginAsBob(t, s)
+
+	past := time.Now().Add(-48 * time.Hour)
+	if _, err := models.CreateDate(context.Background(), s.db, past, past.Add(time.Hour), andrzejId); err != nil {
+		t.Fatal(err)
+	}
+	if err := models.SetDateBookedBy(context.Background(), s.db, 11, bobId); err != nil {
+		t.Fatal(err)
+	}
+	if err := models.CreateBookingField(context.Background(), s.db, "Notes", false, models.ProfileFieldNone); err != nil {
+		t.Fatal(err)
+	}
+	w := postFormWithCookies(s, "/book/1/", "field-1=allergic+to+cats", bob)
+	checkResponseCode(t, http.StatusFound, w.Code)
+
+	checkEmptyRequestWithCookies(t, s, "GET", "/profile/export/", "", http.StatusForbidden)
+	w = checkEmptyRequestWithCookies(t, s, "GET", "/profile/export/", bob, http.StatusOK)
+	var export struct {
+		User struct {
+			Username string
+		}
+		Bookings []struct {
+			DateId  int
+			Answers map[string]string
+		}
+		Sessions []interface{}
+		Activity []interface{}
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &export); err != nil {
+		t.Fatal(err)
+	}
+	if export.User.Username != "bob" || len(export.Bookings) != 2 || len(export.Sessions) != 1 {
+		t.Errorf("Unexpected export: %s", w.Body.String())
+	}
+	if export.Bookings[1].Answers["Notes"] != "allergic to cats" {
+		t.Errorf("Expected booking answers in the export")
+	}
+	if strings.Contains(w.Body.String(), "password") {
+		t.Errorf("Password should not be exported")
+	}
+
+	w = postFormWithCookies(s, "/profile/delete/", "password=123", andrzej)
+	checkResponseCode(t, http.StatusForbidden, w.Code)
+	w = postFormWithCookies(s, "/profile/delete/", "password=wrong", bob)
+	checkResponseCode(t, http.StatusBadRequest, w.Code)
+	w = postFormWithCookies(s, "/profile/", "name=bob&email=bob@example.com&timezone=Europe/Warsaw", bob)
+	checkResponseCode(t, http.StatusFound, w.Code)
+	w = postFormWithCookies(s, "/profile/delete/", "password=123", bob)
+	checkResponseCode(t, http.StatusFound, w.Code)
+	if u, err := models.GetUserById(context.Background(), s.db, 4); err != nil || u.Email != "" || u.Timezone != "" {
+		t.Errorf("Expected the profile to be erased, got %+v %v", u, err)
+	}
+
+	w = postLogin(s, "username=bob&password=123")
+	checkResponseCode(t, http.StatusBadRequest, w.Code)
+	checkEmptyRequestWithCookies(t, s, "GET", "/booked/", bob, http.StatusForbidden)
+
+	// the past visit stays in the calendar, the future one is free again
+	w = checkEmptyRequestWithCookies(t, s, "GET", "/assigned/", andrzej, http.StatusOK)
+	checkResponseBodySubstring(t, "is booked by "+models.AnonymizedUserName, w)
+	if strings.Contains(w.Body.String(), "allergic") {
+		t.Errorf("Booking answers should be erased")
+	}
+	date, err := models.GetDateById(context.Background(), s.db, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if date.BookedBy != -1 {
+		t.Errorf("Future booking should be released")
+	}
+
+	// nothing in the audit log points to bob anymore but his id
+	admin := loginAsAdmin(t, s)
+	w = checkEmptyRequestWithCookies(t, s, "GET", "/audit/export.csv?user=4", admin, http.StatusOK)
+	checkResponseBodySubstring(t, models.AnonymizedUserName, w)
+	checkResponseBodySubstring(t, "192.0.2.0/24", w)
+	for _, personal := range []string{"bob", "192.0.2.1"} {
+		if strings.Contains(w.Body.String(), personal) {
+			t.Errorf("Expected %s to be erased from the audit log: %s", personal, w.Body.String())
+		}
+	}
+}
+
+func TestAuditLog(t *testing.T) {
+	s := initTestingServer()
+	const bobId = 4
+
+	admin := loginAsAdmin(t, s)
+	bob := loginAsBob(t, s)
+	andrzej := loginAsAndrzej(t, s)
+
+	checkEmptyRequestWithCookies(t, s, "POST", "/book/1/", bob, http.StatusFound)
+	w := postFormWithCookies(s, "/unbook/1/", "reason=private matter", admin)
+	checkResponseCode(t, http.StatusFound, w.Code)
+
+	entries, err := models.GetAuditEntries(context.Background(), s.db, models.AuditFilter{TargetDateId: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Action != models.AuditUnbook || entries[1].Action != models.AuditBook {
+		t.Fatalf("Expected booking and cancellation to be audited, got %+v", entries)
+	}
+	if entries[0].ActorId != 1 || entries[0].TargetUserId != bobId || entries[0].IP == "" {
+		t.Errorf("Unexpected cancellation entry %+v", entries[0])
+	}
+	if !strings.Contains(entries[0].Before, `"bookedBy":4`) || !strings.Contains(entries[0].After, `"bookedBy":-1`) {
+		t.Errorf("Expected before and after states, got %+v", entries[0])
+	}
+	// the reason may be personal and the log is never erased
+	if strings.Contains(entries[0].After, "private matter") || !strings.Contains(entries[0].After, `"reasonGiven":true`) {
+		t.Errorf("Expected only whether a reason was given, got %+v", entries[0])
+	}
+
+	checkEmptyRequestWithCookies(t, s, "GET", "/audit/", andrzej, http.StatusForbidden)
+	w = checkEmptyRequestWithCookies(t, s, "GET", "/audit/?action=unbook", admin, http.StatusOK)
+	checkResponseBodySubstring(t, "<b>unbook</b>", w)
+	if strings.Contains(w.Body.String(), "<b>book</b>") {
+		t.Errorf("Expected the log to be filtered by action")
+	}
+	checkEmptyRequestWithCookies(t, s, "GET", "/audit/?from=yesterday", admin, http.StatusBadRequest)
+
+	w = checkEmptyRequestWithCookies(t, s, "GET", "/audit/export.csv?date=1", admin, http.StatusOK)
+	if w.Header().Get("Content-Type") != "text/csv; charset=utf-8" {
+		t.Errorf("Expected a CSV export")
+	}
+	records, err := csv.NewReader(w.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 || records[1][4] != models.AuditUnbook {
+		t.Errorf("Unexpected CSV export %v", records)
+	}
+}
+
+func TestCancellationPolicy(t *testing.T) {
+	s := initTestingServer()
+	const bobId = 4
+	const andrzejId = 2
+
+	admin := loginAsAdmin(t, s)
+	bob := loginAsBob(t, s)
+	andrzej := loginAsAndrzej(t, s)
+
+	w := postFormWithCookies(s, "/settings/", "cancel_min_notice_hours=-1", admin)
+	checkResponseCode(t, http.StatusBadRequest, w.Code)
+	w = postFormWithCookies(s, "/settings/", "cancel_min_notice_hours=3&allow_late_cancel=1&require_cancel_reason=1", admin)
+	checkResponseCode(t, http.StatusFound, w.Code)
+
+	checkEmptyRequestWithCookies(t, s, "POST", "/book/1/", bob, http.StatusFound)
+	checkEmptyRequestWithCookies(t, s, "POST", "/book/5/", bob, http.StatusFound)
+	past := time.Now().Add(-2 * time.Hour)
+	pastId, err := models.CreateDate(context.Background(), s.db, past, past.Add(time.Hour), andrzejId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := models.SetDateBookedBy(context.Background(), s.db, pastId, bobId); err != nil {
+		t.Fatal(err)
+	}
+
+	// a visit which already took place can't be cancelled
+	w = postFormWithCookies(s, fmt.Sprintf("/unbook/%d/", pastId), "reason=sick", bob)
+	checkResponseCode(t, http.StatusBadRequest, w.Code)
+
+	// a reason is required
+	checkEmptyRequestWithCookies(t, s, "POST", "/unbook/5/", bob, http.StatusBadRequest)
+	w = postFormWithCookies(s, "/unbook/5/", "reason=sick", bob)
+	checkResponseCode(t, http.StatusFound, w.Code)
+
+	// late cancellations are allowed but flagged
+	w = postFormWithCookies(s, "/unbook/1/", "reason=traffic", bob)
+	checkResponseCode(t, http.StatusFound, w.Code)
+	w = checkEmptyRequestWithCookies(t, s, "GET", "/booked/", bob, http.StatusOK)
+	checkResponseBodySubstring(t, "(late)", w)
+	checkResponseBodySubstring(t, "traffic", w)
+
+	// unless the policy forbids them, admins can still override it
+	w = postFormWithCookies(s, "/settings/", "cancel_min_notice_hours=3&require_cancel_reason=1", admin)
+	checkResponseCode(t, http.StatusFound, w.Code)
+	checkEmptyRequestWithCookies(t, s, "POST", "/book/1/", bob, http.StatusFound)
+	w = postFormWithCookies(s, "/unbook/1/", "reason=traffic", bob)
+	checkResponseCode(t, http.StatusForbidden, w.Code)
+	checkEmptyRequestWithCookies(t, s, "POST", "/unbook/1/", admin, http.StatusFound)
+
+	w = checkEmptyRequestWithCookies(t, s, "GET", "/assigned/", andrzej, http.StatusOK)
+	checkResponseBodySubstring(t, "Cancellations (2 late)", w)
+}
+
+func TestAttendance(t *testing.T) {
+	s := initTestingServer()
+	const bobId = 4
+	const andrzejId = 2
+
+	admin := loginAsAdmin(t, s)
+	bob := loginAsBob(t, s)
+	andrzej := loginAsAndrzej(t, s)
+	fabian := loginAndReturnCookies(t, s, "username=pracownik2&password=miesiaca")
+
+	past := time.Now().Add(-2 * time.Hour)
+	pastId, err := models.CreateDate(context.Background(), s.db, past, past.Add(time.Hour), andrzejId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := models.SetDateBookedBy(context.Background(), s.db, pastId, bobId); err != nil {
+		t.Fatal(err)
+	}
+	url := fmt.Sprintf("/assigned/%d/attendance/", pastId)
+
+	w := postFormWithCookies(s, url, "status=no_show", bob)
+	checkResponseCode(t, http.StatusForbidden, w.Code)
+	w = postFormWithCookies(s, url, "status=no_show", fabian)
+	checkResponseCode(t, http.StatusForbidden, w.Code)
+	w = postFormWithCookies(s, url, "status=asleep", andrzej)
+	checkResponseCode(t, http.StatusBadRequest, w.Code)
+
+	// future visits can't be marked yet
+	checkEmptyRequestWithCookies(t, s, "POST", "/book/1/", bob, http.StatusFound)
+	w = postFormWithCookies(s, "/assigned/1/attendance/", "status=attended", andrzej)
+	checkResponseCode(t, http.StatusBadRequest, w.Code)
+
+	w = postFormWithCookies(s, url, "status=no_show", andrzej)
+	checkResponseCode(t, http.StatusFound, w.Code)
+	w = checkEmptyRequestWithCookies(t, s, "GET", "/assigned/", andrzej, http.StatusOK)
+	checkResponseBodySubstring(t, "(1 missed visits)", w)
+	w = checkEmptyRequestWithCookies(t, s, "GET", "/booked/", bob, http.StatusOK)
+	checkResponseBodySubstring(t, "- no_show", w)
+
+	// customers above the limit can't book on their own
+	w = postFormWithCookies(s, "/settings/", "no_show_limit=1&allow_late_cancel=1", admin)
+	checkResponseCode(t, http.StatusFound, w.Code)
+	checkEmptyRequestWithCookies(t, s, "GET", "/book/2/", bob, http.StatusForbidden)
+	checkEmptyRequestWithCookies(t, s, "POST", "/book/2/", bob, http.StatusForbidden)
+
+	w = postFormWithCookies(s, url, "status=late", admin)
+	checkResponseCode(t, http.StatusFound, w.Code)
+	checkEmptyRequestWithCookies(t, s, "POST", "/book/2/", bob, http.StatusFound)
+}
+
+func TestBookingApproval(t *testing.T) {
+	s := initTestingServer()
+	const bobId = 4
+	const andrzejId = 2
+
+	admin := loginAsAdmin(t, s)
+	bob := loginAsBob(t, s)
+	andrzej := loginAsAndrzej(t, s)
+	fabian := loginAndReturnCookies(t, s, "username=pracownik2&password=miesiaca")
+
+	w := postFormWithCookies(s, "/users/2/", "name=Andrzej&username=pracownik&role=2&requires-approval=1", admin)
+	checkResponseCode(t, http.StatusFound, w.Code)
+
+	w = checkEmptyRequestWithCookies(t, s, "GET", "/book/1/", bob, http.StatusOK)
+	checkResponseBodySubstring(t, "has to be confirmed", w)
+	w = checkEmptyRequestWithCookies(t, s, "POST", "/book/1/", bob, http.StatusFound)
+	if w.Header().Get("Location") != "/booked/" {
+		t.Errorf("Expected a redirect to the bookings of the customer")
+	}
+	w = checkEmptyRequestWithCookies(t, s, "GET", "/booked/", bob, http.StatusOK)
+	checkResponseBodySubstring(t, "awaiting approval", w)
+	// the slot is held meanwhile
+	checkEmptyRequestWithCookies(t, s, "POST", "/book/1/", admin, http.StatusBadRequest)
+
+	w = checkEmptyRequestWithCookies(t, s, "GET", "/assigned/", andrzej, http.StatusOK)
+	checkResponseBodySubstring(t, "bob asks to book", w)
+	checkEmptyRequestWithCookies(t, s, "POST", "/assigned/1/approve/", fabian, http.StatusForbidden)
+	checkEmptyRequestWithCookies(t, s, "POST", "/assigned/1/approve/", andrzej, http.StatusFound)
+	checkEmptyRequestWithCookies(t, s, "POST", "/assigned/1/approve/", andrzej, http.StatusBadRequest)
+	w = checkEmptyRequestWithCookies(t, s, "GET", "/booked/", bob, http.StatusOK)
+	checkResponseBodySubstring(t, "has been confirmed", w)
+
+	checkEmptyRequestWithCookies(t, s, "POST", "/book/2/", bob, http.StatusFound)
+	checkEmptyRequestWithCookies(t, s, "POST", "/assigned/2/reject/", andrzej, http.StatusFound)
+	w = checkEmptyRequestWithCookies(t, s, "GET", "/booked/", bob, http.StatusOK)
+	checkResponseBodySubstring(t, "has been declined", w)
+	checkEmptyRequestWithCookies(t, s, "POST", "/notifications/read/", bob, http.StatusFound)
+
+	// unanswered requests expire
+	checkEmptyRequestWithCookies(t, s, "POST", "/book/3/", bob, http.StatusFound)
+	s.expirePendingBookings(context.Background(), time.Now().Add(4*time.Hour))
+	date, err := models.GetDateById(context.Background(), s.db, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if date.BookedBy != -1 {
+		t.Errorf("Expected the expired booking to be released")
+	}
+	w = checkEmptyRequestWithCookies(t, s, "GET", "/booked/", bob, http.StatusOK)
+	checkResponseBodySubstring(t, "wasn&#39;t confirmed in time", w)
+	if strings.Contains(w.Body.String(), "has been declined") {
+		t.Errorf("Expected read notifications to be hidden")
+	}
+
+	// customers who miss visits can be asked for approval too
+	past := time.Now().Add(-2 * time.Hour)
+	pastId, err := models.CreateDate(context.Background(), s.db, past, past.Add(time.Hour), andrzejId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := models.SetDateBookedBy(context.Background(), s.db, pastId, bobId); err != nil {
+		t.Fatal(err)
+	}
+	if err := models.SetAttendance(context.Background(), s.db, pastId, models.AttendanceNoShow, andrzejId); err != nil {
+		t.Fatal(err)
+	}
+	w = postFormWithCookies(s, "/settings/", "no_show_limit=1&no_show_action=approval&allow_late_cancel=1", admin)
+	checkResponseCode(t, http.StatusFound, w.Code)
+	checkEmptyRequestWithCookies(t, s, "POST", "/book/6/", bob, http.StatusFound)
+	pending, err := models.GetPendingBookings(context.Background(), s.db, []int{6})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 1 {
+		t.Errorf("Expected the booking to wait for approval")
+	}
+}
+
+func TestSchedule(t *testing.T) {
+	s := initTestingServer()
+	const andrzejId = 2
+
+	admin := loginAsAdmin(t, s)
+	bob := loginAsBob(t, s)
+	andrzej := loginAsAndrzej(t, s)
+	fabian := loginAndReturnCookies(t, s, "username=pracownik2&password=miesiaca")
+
+	checkEmptyRequestWithCookies(t, s, "GET", "/schedule/", bob, http.StatusForbidden)
+	checkEmptyRequestWithCookies(t, s, "GET", "/schedule/", andrzej, http.StatusOK)
+	checkEmptyRequestWithCookies(t, s, "GET", "/schedule/?employee=3", andrzej, http.StatusForbidden)
+	checkEmptyRequestWithCookies(t, s, "GET", "/schedule/?employee=3", admin, http.StatusOK)
+	checkEmptyRequestWithCookies(t, s, "GET", "/schedule/?employee=4", admin, http.StatusBadRequest)
+
+	w := postFormWithCookies(s, "/schedule/hours/", "start-1=09:00&end-1=08:00", andrzej)
+	checkResponseCode(t, http.StatusBadRequest, w.Code)
+	w = postFormWithCookies(s, "/schedule/hours/", "start-1=09:00&end-1=12:00", andrzej)
+	checkResponseCode(t, http.StatusFound, w.Code)
+	w = postFormWithCookies(s, "/schedule/breaks/", "weekday=1&start=10:00&end=11:00", andrzej)
+	checkResponseCode(t, http.StatusFound, w.Code)
+	w = checkEmptyRequestWithCookies(t, s, "GET", "/schedule/", andrzej, http.StatusOK)
+	checkResponseBodySubstring(t, "Monday 10:00-11:00", w)
+
+	// 2030-01-07 is a Monday
+	w = postFormWithCookies(s, "/schedule/generate/", "from=2030-01-07&to=2030-01-13&length=60", andrzej)
+	checkResponseCode(t, http.StatusOK, w.Code)
+	checkResponseBodySubstring(t, "Created 2 dates.", w)
+	w = postFormWithCookies(s, "/schedule/generate/", "from=2030-01-07&to=2030-01-13&length=60", andrzej)
+	checkResponseBodySubstring(t, "Created 0 dates.", w)
+	w = postFormWithCookies(s, "/schedule/generate/", "from=2030-01-07&to=2032-01-13&length=60", andrzej)
+	checkResponseCode(t, http.StatusBadRequest, w.Code)
+
+	// an absence lists the booked visits it collides with
+	checkEmptyRequestWithCookies(t, s, "POST", "/book/2/", bob, http.StatusFound)
+	date, err := models.GetDateById(context.Background(), s.db, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const layout = "2006-01-02T15:04"
+	form := "kind=vacation&note=away&start-time=" + url.QueryEscape(time.Now().Format(layout)) +
+		"&end-time=" + url.QueryEscape(time.Now().Add(48*time.Hour).Format(layout))
+	w = postFormWithCookies(s, "/schedule/absences/", form, fabian)
+	checkResponseCode(t, http.StatusFound, w.Code)
+	w = postFormWithCookies(s, "/schedule/absences/", form+"&employee=2", admin)
+	checkResponseCode(t, http.StatusFound, w.Code)
+	w = checkEmptyRequestWithCookies(t, s, "GET", "/schedule/", andrzej, http.StatusOK)
+	checkResponseBodySubstring(t, "collides with booked visits", w)
+	checkResponseBodySubstring(t, date.StartTime.Format("2-01 15:04"), w)
+
+	inside := time.Now().Add(24 * time.Hour)
+	w = postFormWithCookies(s, "/add-date/", "employee=2&start-time="+url.QueryEscape(inside.Format(layout))+
+		"&end-time="+url.QueryEscape(inside.Add(time.Hour).Format(layout)), admin)
+	checkResponseCode(t, http.StatusBadRequest, w.Code)
+	checkResponseBodySubstring(t, "absent at that time", w)
+
+	absences, err := models.GetAbsences(context.Background(), s.db, andrzejId, time.Now())
+	if err != nil || len(absences) != 1 {
+		t.Fatalf("Expected one absence, got %v %v", absences, err)
+	}
+	w = postFormWithCookies(s, fmt.Sprintf("/schedule/absences/%d/delete/", absences[0].Id), "", fabian)
+	checkResponseCode(t, http.StatusFound, w.Code)
+	absences, _ = models.GetAbsences(context.Background(), s.db, andrzejId, time.Now())
+	if len(absences) != 1 {
+		t.Errorf("Expected other employees not to delete the absence")
+	}
+}
+
+func TestEditDates(t *testing.T) {
+	s := initTestingServer()
+	const bobId = 4
+
+	admin := loginAsAdmin(t, s)
+	bob := loginAsBob(t, s)
+	andrzej := loginAsAndrzej(t, s)
+	fabian := loginAndReturnCookies(t, s, "username=pracownik2&password=miesiaca")
+
+	checkEmptyRequestWithCookies(t, s, "GET", "/dates/", bob, http.StatusForbidden)
+	w := checkEmptyRequestWithCookies(t, s, "GET", "/dates/", andrzej, http.StatusOK)
+	if strings.Contains(w.Body.String(), "Fabian") {
+		t.Errorf("Expected only own dates to be listed")
+	}
+	checkEmptyRequestWithCookies(t, s, "GET", "/dates/?employee=3", andrzej, http.StatusForbidden)
+	checkEmptyRequestWithCookies(t, s, "GET", "/dates/1/", andrzej, http.StatusOK)
+	checkEmptyRequestWithCookies(t, s, "GET", "/dates/1/", fabian, http.StatusForbidden)
+	checkEmptyRequestWithCookies(t, s, "GET", "/dates/100/", admin, http.StatusNotFound)
+
+	date, err := models.GetDateById(context.Background(), s.db, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dateForm := func(start time.Time) string {
+		return "start-time=" + url.QueryEscape(start.Format(dateInputLayout)) +
+			"&end-time=" + url.QueryEscape(start.Add(time.Hour).Format(dateInputLayout))
+	}
+	moved := date.StartTime.Add(-30 * time.Minute).Truncate(time.Minute)
+	w = postFormWithCookies(s, "/dates/1/", dateForm(moved)+"&employee=3", andrzej)
+	checkResponseCode(t, http.StatusForbidden, w.Code)
+	w = postFormWithCookies(s, "/dates/1/", dateForm(date.StartTime.Add(30*time.Minute)), andrzej)
+	checkResponseCode(t, http.StatusBadRequest, w.Code)
+	checkResponseBodySubstring(t, "the date would overlap another date of the employee", w)
+	w = postFormWithCookies(s, "/dates/1/", dateForm(moved), andrzej)
+	checkResponseCode(t, http.StatusFound, w.Code)
+	if date, err = models.GetDateById(context.Background(), s.db, 1); err != nil || !date.StartTime.Equal(moved) {
+		t.Errorf("Expected the date to be moved, got %v %v", date, err)
+	}
+
+	// booked dates can't be changed one by one
+	checkEmptyRequestWithCookies(t, s, "POST", "/book/2/", bob, http.StatusFound)
+	checkEmptyRequestWithCookies(t, s, "GET", "/dates/2/", andrzej, http.StatusBadRequest)
+	checkEmptyRequestWithCookies(t, s, "POST", "/dates/2/delete/", andrzej, http.StatusBadRequest)
+	checkEmptyRequestWithCookies(t, s, "POST", "/dates/1/delete/", andrzej, http.StatusFound)
+
+	w = postFormWithCookies(s, "/dates/bulk/", "action=delete&date=2&date=6", andrzej)
+	checkResponseCode(t, http.StatusForbidden, w.Code)
+	w = postFormWithCookies(s, "/dates/bulk/", "action=reassign&employee-to=3&date=3", andrzej)
+	checkResponseCode(t, http.StatusForbidden, w.Code)
+
+	// touching booked dates needs a confirmation
+	w = postFormWithCookies(s, "/dates/bulk/", "action=shift&minutes=300&date=2&date=3", andrzej)
+	checkResponseCode(t, http.StatusOK, w.Code)
+	checkResponseBodySubstring(t, "moved by 300 minutes", w)
+	w = postFormWithCookies(s, "/dates/bulk/", "action=shift&minutes=60&date=2&date=3&confirm=1", andrzej)
+	checkResponseCode(t, http.StatusBadRequest, w.Code)
+	checkResponseBodySubstring(t, "some of the dates would overlap other dates of the employee", w)
+	w = postFormWithCookies(s, "/dates/bulk/", "action=shift&minutes=300&date=2&date=3&confirm=1", andrzej)
+	checkResponseCode(t, http.StatusFound, w.Code)
+	w = postFormWithCookies(s, "/dates/bulk/", "action=reassign&employee-to=3&date=4", admin)
+	checkResponseCode(t, http.StatusBadRequest, w.Code)
+	checkResponseBodySubstring(t, "some of the dates would overlap other dates of the employee", w)
+	w = postFormWithCookies(s, "/dates/bulk/", "action=reassign&employee-to=3&date=2&confirm=1", admin)
+	checkResponseCode(t, http.StatusFound, w.Code)
+	w = checkEmptyRequestWithCookies(t, s, "GET", "/booked/", bob, http.StatusOK)
+	checkResponseBodySubstring(t, "has been moved to", w)
+	checkResponseBodySubstring(t, "will be handled by Fabian", w)
+
+	w = postFormWithCookies(s, "/dates/bulk/", "action=delete&date=2&date=7&reason=closed&confirm=1", fabian)
+	checkResponseCode(t, http.StatusFound, w.Code)
+	w = checkEmptyRequestWithCookies(t, s, "GET", "/booked/", bob, http.StatusOK)
+	checkResponseBodySubstring(t, "the date was removed. Reason: closed", w)
+	if dates, _ := models.GetDatesBookedBy(context.Background(), s.db, bobId); len(dates) != 0 {
+		t.Errorf("Expected the booking to be cancelled")
+	}
+}
+
+func TestTimezones(t *testing.T) {
+	s := initTestingServer()
+	const andrzejId = 2
+
+	admin := loginAsAdmin(t, s)
+	bob := loginAsBob(t, s)
+	andrzej := loginAsAndrzej(t, s)
+
+	w := postFormWithCookies(s, "/settings/", "timezone=Mars/Olympus&allow_late_cancel=1", admin)
+	checkResponseCode(t, http.StatusBadRequest, w.Code)
+	w = postFormWithCookies(s, "/settings/", "timezone=Europe/Warsaw&allow_late_cancel=1", admin)
+	checkResponseCode(t, http.StatusFound, w.Code)
+
+	// forms are read in the zone of the business, times are stored in UTC
+	w = postFormWithCookies(s, "/add-date/", "start-time=2030-07-01T10:00&end-time=2030-07-01T11:00", andrzej)
+	checkResponseCode(t, http.StatusFound, w.Code)
+	dates, err := models.GetDatesWithNamesBetween(context.Background(), s.db, andrzejId,
+		time.Date(2030, 7, 1, 0, 0, 0, 0, time.UTC), time.Date(2030, 7, 2, 0, 0, 0, 0, time.UTC))
+	if err != nil || len(dates) != 1 {
+		t.Fatalf("Expected one date, got %v %v", dates, err)
+	}
+	if expected := time.Date(2030, 7, 1, 8, 0, 0, 0, time.UTC); !dates[0].StartTime.Equal(expected) {
+		t.Errorf("Expected the date to start at %v, got %v", expected, dates[0].StartTime)
+	}
+	w = checkEmptyRequestWithCookies(t, s, "GET", "/", bob, http.StatusOK)
+	checkResponseBodySubstring(t, "1-07 10:00 - 11:00", w)
+
+	// the zone isn't read again until the settings change it
+	if err := models.SetSetting(context.Background(), s.db, models.SettingTimezone, "Asia/Tokyo"); err != nil {
+		t.Fatal(err)
+	}
+	if loc := s.businessLocation(context.Background()); loc.String() != "Europe/Warsaw" {
+		t.Errorf("Expected the zone to be cached, got %s", loc)
+	}
+	if err := models.SetSetting(context.Background(), s.db, models.SettingTimezone, "Europe/Warsaw"); err != nil {
+		t.Fatal(err)
+	}
+
+	// users can see times in their own zone
+	w = postFormWithCookies(s, "/profile/", "name=bob&timezone=Nowhere", bob)
+	checkResponseCode(t, http.StatusBadRequest, w.Code)
+	w = postFormWithCookies(s, "/profile/", "name=bob&timezone=America/New_York", bob)
+	checkResponseCode(t, http.StatusFound, w.Code)
+	w = checkEmptyRequestWithCookies(t, s, "GET", "/", bob, http.StatusOK)
+	checkResponseBodySubstring(t, "1-07 04:00 - 05:00", w)
+
+	// generated dates keep their wall clock time across the change to
+	// summer time on 2030-03-31
+	form := "start-6=09:00&end-6=10:00&start-0=09:00&end-0=10:00&start-1=09:00&end-1=10:00"
+	w = postFormWithCookies(s, "/schedule/hours/", form, andrzej)
+	checkResponseCode(t, http.StatusFound, w.Code)
+	w = postFormWithCookies(s, "/schedule/generate/", "from=2030-03-30&to=2030-04-01&length=60", andrzej)
+	checkResponseBodySubstring(t, "Created 3 dates.", w)
+	dates, err = models.GetDatesWithNamesBetween(context.Background(), s.db, andrzejId,
+		time.Date(2030, 3, 30, 0, 0, 0, 0, time.UTC), time.Date(2030, 4, 2, 0, 0, 0, 0, time.UTC))
+	if err != nil || len(dates) != 3 {
+		t.Fatalf("Expected three dates, got %v %v", dates, err)
+	}
+	for i, hour := range []int{8, 7, 7} {
+		if h := dates[i].StartTime.Hour(); h != hour {
+			t.Errorf("Expected date %d to start at %d:00 UTC, got %d:00", i, hour, h)
+		}
+	}
+	w = checkEmptyRequestWithCookies(t, s, "GET", "/dates/?from=2030-03-30&to=2030-04-01", andrzej, http.StatusOK)
+	checkResponseBodySubstring(t, "30-03 09:00", w)
+	checkResponseBodySubstring(t, "31-03 09:00", w)
+	checkResponseBodySubstring(t, "1-04 09:00", w)
+}
+
+func TestLanguages(t *testing.T) {
+	s := initTestingServer()
+
+	// every message used in the templates has a Polish translation, plural
+	// ones are looked up by their plural form
+	files, err := fs.Glob(templates.files, "*.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages := regexp.MustCompile(`\b(?:t|tn "(?:[^"\\]|\\.)*") "((?:[^"\\]|\\.)*)"`)
+	for _, file := range files {
+		content, err := fs.ReadFile(templates.files, file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, m := range messages.FindAllStringSubmatch(string(content), -1) {
+			message, err := strconv.Unquote(`"` + m[1] + `"`)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !i18n.Has("pl", message) {
+				t.Errorf("Missing Polish translation of '%s' used in %s", message, file)
+			}
+		}
+	}
+
+	bob := loginAsBob(t, s)
+	request := func(cookies string, acceptLanguage string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/", nil)
+		setCookiesWithCsrf(s, r, cookies)
+		r.Header.Set("Accept-Language", acceptLanguage)
+		s.router.ServeHTTP(w, r)
+		checkResponseCode(t, http.StatusOK, w.Code)
+		return w
+	}
+
+	w := request(bob, "de-DE, pl;q=0.8, en;q=0.5")
+	checkResponseBodySubstring(t, "Wolne terminy:", w)
+	checkResponseBodySubstring(t, `lang="pl"`, w)
+	w = request(bob, "fr")
+	checkResponseBodySubstring(t, "Available dates:", w)
+
+	// the language chosen in the profile wins over the browser
+	w = postFormWithCookies(s, "/profile/", "name=bob&language=xx", bob)
+	checkResponseCode(t, http.StatusBadRequest, w.Code)
+	w = postFormWithCookies(s, "/profile/", "name=bob&language=pl", bob)
+	checkResponseCode(t, http.StatusFound, w.Code)
+	w = request(bob, "en-US")
+	checkResponseBodySubstring(t, "Wolne terminy:", w)
+
+	// errors are translated as well
+	w = checkEmptyRequestWithCookies(t, s, "GET", "/users/", bob, http.StatusForbidden)
+	checkResponseBodySubstring(t, "403: Brak dostępu", w)
+}
+
+func TestWebFiles(t *testing.T) {
+	s := initTestingServer()
+	w := checkEmptyRequestWithCookies(t, s, "GET", "/static/css/main.css", "", http.StatusOK)
+	if w.Body.Len() == 0 {
+		t.Error("Expected the stylesheet to be served")
+	}
+
+	if err := UseWebDir("nonexistent", false); err == nil {
+		t.Error("Expected an error for a missing directory")
+	}
+	if err := UseWebDir(t.TempDir(), false); err == nil {
+		t.Error("Expected an error for a directory without templates")
+	}
+
+	// files in the override directory are read on every request
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"templates/layout.html": `{{ block "main" . }}{{ end }}`,
+		"templates/index.html":  `{{ define "main" }}overridden index{{ end }}`,
+		"static/main.css":       "body {}",
+	} {
+		file := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := UseWebDir(dir, false); err != nil {
+		t.Fatal(err)
+	}
+	defer UseWebDir("", false)
+	s = initTestingServer()
+	w = checkEmptyRequestWithCookies(t, s, "GET", "/", "", http.StatusOK)
+	checkResponseBodySubstring(t, "overridden index", w)
+	checkEmptyRequestWithCookies(t, s, "GET", "/static/main.css", "", http.StatusOK)
+	checkEmptyRequestWithCookies(t, s, "GET", "/static/css/main.css", "", http.StatusNotFound)
+}
+
+func TestTemplates(t *testing.T) {
+	// every page rendered by the handlers exists
+	sources, err := filepath.Glob("*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rendered := regexp.MustCompile(`renderTemplate\(w, r, "([^"]+)"`)
+	for _, source := range sources {
+		content, err := os.ReadFile(source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, m := range rendered.FindAllStringSubmatch(string(content), -1) {
+			if _, err := templates.lookup(m[1]); err != nil {
+				t.Errorf("%s renders a missing template: %v", source, err)
+			}
+		}
+	}
+
+	// references to undefined templates are found when parsing
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "layout.html"), []byte(`{{ template "main" . }}`), 0644)
+	os.WriteFile(filepath.Join(dir, "index.html"), []byte(`{{ define "main" }}{{ template "missing" }}{{ end }}`), 0644)
+	if _, err := newTemplateSet(os.DirFS(dir), false); err == nil {
+		t.Error("Expected an error for a missing template")
+	}
+
+	// a page failing halfway is replaced with an error page
+	os.WriteFile(filepath.Join(dir, "index.html"), []byte(`{{ define "main" }}half{{ .Data.Missing }}{{ end }}`), 0644)
+	os.WriteFile(filepath.Join(dir, "error.html"), []byte(`{{ define "main" }}error page{{ end }}`), 0644)
+	ts, err := newTemplateSet(os.DirFS(dir), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(saved *templateSet) { templates = saved }(templates)
+	templates = ts
+	s := initTestingServer()
+	w := checkEmptyRequestWithCookies(t, s, "GET", "/", "", http.StatusInternalServerError)
+	checkResponseBodySubstring(t, "error page", w)
+	if strings.Contains(w.Body.String(), "half") {
+		t.Error("Expected no part of the failed page")
+	}
+
+	// in the reload mode changes are visible right away
+	os.WriteFile(filepath.Join(dir, "index.html"), []byte(`{{ define "main" }}fixed{{ end }}`), 0644)
+	w = checkEmptyRequestWithCookies(t, s, "GET", "/", "", http.StatusOK)
+	checkResponseBodySubstring(t, "fixed", w)
+}
+
+func TestConfig(t *testing.T) {
+	cfg := config.Default()
+	cfg.Database = "testing.db"
+	cfg.SessionTTL = config.Duration(time.Hour)
+	cfg.Features = config.Features{}
+	s := NewServer(cfg)
+	models.CreateNewTables(context.Background(), s.db)
+	models.FillWithSampleData(context.Background(), s.db)
+
+	bob := loginAsBob(t, s)
+	session, err := models.GetSessionByToken(context.Background(), s.db, strings.TrimPrefix(strings.Split(bob, ";")[0], "session_token="))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ttl := time.Until(session.ExpiresAt); ttl > time.Hour || ttl < 59*time.Minute {
+		t.Errorf("Expected the session to last an hour, got %v", ttl)
+	}
+
+	// features which are turned off are neither available nor linked
+	w := checkEmptyRequestWithCookies(t, s, "GET", "/", "", http.StatusOK)
+	if strings.Contains(w.Body.String(), "/register/") {
+		t.Error("Expected no link to the registration")
+	}
+	checkEmptyRequestWithCookies(t, s, "GET", "/register/", "", http.StatusNotFound)
+	checkEmptyRequestWithCookies(t, s, "GET", "/profile/export/", bob, http.StatusNotFound)
+	checkEmptyRequestWithCookies(t, s, "GET", "/profile/delete/", bob, http.StatusNotFound)
+	w = checkEmptyRequestWithCookies(t, s, "GET", "/profile/", bob, http.StatusOK)
+	if strings.Contains(w.Body.String(), "/profile/export/") || strings.Contains(w.Body.String(), "/profile/delete/") {
+		t.Error("Expected no links to features which are turned off")
+	}
+
+	// the zone of the business defaults to the configured one
+	cfg.Timezone = "Asia/Tokyo"
+	s = NewServer(cfg)
+	if loc := s.businessLocation(context.Background()); loc.String() != "Asia/Tokyo" {
+		t.Errorf("Expected the configured zone, got %v", loc)
+	}
+}
+
+func TestGracefulShutdown(t *testing.T) {
+	s := initTestingServer()
+	started := make(chan struct{})
+	release := make(chan struct{})
+	s.router.Get("/slow/", func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.Write([]byte("finished"))
+	})
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error)
+	go func() { served <- s.Serve(ctx, l, nil, nil) }()
+
+	type result struct {
+		body string
+		err  error
+	}
+	response := make(chan result)
+	go func() {
+		resp, err := http.Get("http://" + l.Addr().String() + "/slow/")
+		if err != nil {
+			response <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		response <- result{string(body), err}
+	}()
+
+	<-started
+	cancel()
+	select {
+	case err := <-served:
+		t.Fatalf("Expected the server to wait for the request, it returned %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	// new connections aren't accepted anymore
+	if _, err := http.Get("http://" + l.Addr().String() + "/"); err == nil {
+		t.Error("Expected new requests to be refused")
+	}
+
+	close(release)
+	if r := <-response; r.err != nil || r.body != "finished" {
+		t.Errorf("Expected the request to finish, got '%s' %v", r.body, r.err)
+	}
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("Expected the server to stop")
+	}
+}
+
+func TestTLS(t *testing.T) {
+	cfg := config.Default()
+	cfg.Database = "testing.db"
+	cfg.TLS.CertFile, cfg.TLS.KeyFile = writeTestCertificate(t)
+	s := NewServer(cfg)
+	models.CreateNewTables(context.Background(), s.db)
+	models.FillWithSampleData(context.Background(), s.db)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	redirect, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	metrics, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error)
+	go func() { served <- s.Serve(ctx, l, redirect, metrics) }()
+	defer func() {
+		cancel()
+		if err := <-served; err != nil {
+			t.Error(err)
+		}
+	}()
+
+	client := &http.Client{
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := client.Get("https://" + l.Addr().String() + "/login/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	checkResponseCode(t, http.StatusOK, resp.StatusCode)
+
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+	resp, err = client.Get("http://" + redirect.Addr().String() + "/book/1/?x=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	checkResponseCode(t, http.StatusMovedPermanently, resp.StatusCode)
+	if location := resp.Header.Get("Location"); location != "https://127.0.0.1:"+port+"/book/1/?x=1" {
+		t.Errorf("Unexpected redirect to %s", location)
+	}
+
+	resp, err = client.Get("http://" + metrics.Addr().String() + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	checkResponseCode(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestRedirectToHTTPS(t *testing.T) {
+	cases := []struct {
+		addr     string
+		host     string
+		expected string
+	}{
+		{":443", "example.com", "https://example.com/dates/?a=b"},
+		{":443", "example.com:80", "https://example.com/dates/?a=b"},
+		{":8443", "example.com:8080", "https://example.com:8443/dates/?a=b"},
+		{"[::]:8443", "[::1]:8080", "https://[::1]:8443/dates/?a=b"},
+	}
+	for _, c := range cases {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/dates/?a=b", nil)
+		r.Host = c.host
+		redirectToHTTPS(c.addr).ServeHTTP(w, r)
+		checkResponseCode(t, http.StatusMovedPermanently, w.Code)
+		if location := w.Header().Get("Location"); location != c.expected {
+			t.Errorf("Expected redirect to %s, got %s", c.expected, location)
+		}
+	}
+}
+
+// writeTestCertificate creates a self-signed certificate for 127.0.0.1
+func writeTestCertificate(t *testing.T) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "booker test"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	cert, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyBytes, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	err = os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert}), 0600)
+	if err == nil {
+		err = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyBytes}), 0600)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func TestProbes(t *testing.T) {
+	s := initTestingServer()
+
+	w := checkEmptyRequestWithCookies(t, s, "GET", "/healthz", "", http.StatusOK)
+	checkResponseBodySubstring(t, "ok", w)
+	checkEmptyRequestWithCookies(t, s, "GET", "/readyz", "", http.StatusOK)
+
+	bob := loginAsBob(t, s)
+	postFormWithCookies(s, "/book/1/", "", bob)
+	postFormWithCookies(s, "/unbook/1/", "", bob)
+	checkEmptyRequestWithCookies(t, s, "GET", "/dates/100/", loginAsAdmin(t, s), http.StatusNotFound)
+	checkEmptyRequestWithCookies(t, s, "GET", "/nothing/here/", "", http.StatusNotFound)
+
+	// the metrics are kept off the public address
+	checkEmptyRequestWithCookies(t, s, "GET", "/metrics", "", http.StatusNotFound)
+	w = httptest.NewRecorder()
+	s.metricsHandler(w, httptest.NewRequest("GET", "/metrics", nil))
+	for _, line := range []string{
+		`booker_http_requests_total{method="GET",route="/dates/{dateId:[0-9]+}/",code="404"} 1`,
+		`booker_http_requests_total{method="GET",route="unmatched",code="404"} 2`,
+		`booker_http_requests_total{method="POST",route="/login/",code="303"} 2`,
+		`booker_http_request_duration_seconds_count{method="GET",route="/readyz"} 1`,
+		`booker_bookings_total{status="booked"} 1`,
+		`booker_cancellations_total{kind="in_time"} 1`,
+		`booker_active_sessions 2`,
+		`# TYPE booker_db_query_duration_seconds histogram`,
+	} {
+		checkResponseBodySubstring(t, line, w)
+	}
+
+	// the database is needed to be ready, but not to be alive
+	s.db.Exec(`DROP TABLE notifications`)
+	checkEmptyRequestWithCookies(t, s, "GET", "/readyz", "", http.StatusServiceUnavailable)
+	s.db.Close()
+	checkEmptyRequestWithCookies(t, s, "GET", "/readyz", "", http.StatusServiceUnavailable)
+	checkEmptyRequestWithCookies(t, s, "GET", "/healthz", "", http.StatusOK)
+}
+
+func TestRequestLogging(t *testing.T) {
+	s := initTestingServer()
+	var logs bytes.Buffer
+	s.logger = logging.New(&logs, logging.FormatJSON, logging.LevelInfo)
+	bob := loginAsBob(t, s)
+
+	readLines := func() []map[string]interface{} {
+		var lines []map[string]interface{}
+		decoder := json.NewDecoder(&logs)
+		for decoder.More() {
+			var line map[string]interface{}
+			if err := decoder.Decode(&line); err != nil {
+				t.Fatal(err)
+			}
+			lines = append(lines, line)
+		}
+		return lines
+	}
+	readLines()
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/book/1/", nil)
+	setCookiesWithCsrf(s, r, bob)
+	r.Header.Set(requestIDHeader, "proxy-id.1")
+	s.router.ServeHTTP(w, r)
+	checkResponseCode(t, http.StatusOK, w.Code)
+	if id := w.Header().Get(requestIDHeader); id != "proxy-id.1" {
+		t.Errorf("Expected the request ID of the proxy, got %s", id)
+	}
+	lines := readLines()
+	if len(lines) != 1 {
+		t.Fatalf("Expected one line, got %v", lines)
+	}
+	for k, v := range map[string]interface{}{
+		"level":      "info",
+		"msg":        "request",
+		"request_id": "proxy-id.1",
+		"user_id":    float64(4),
+		"route":      "/book/{dateId:[0-9]+}/",
+		"status":     float64(200),
+	} {
+		if lines[0][k] != v {
+			t.Errorf("Expected %s to be %v, got %v", k, v, lines[0][k])
+		}
+	}
+
+	// requests rejected by the middleware are logged too, probes are not
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("POST", "/profile/", strings.NewReader("name=bob"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.Header.Set("Cookie", bob)
+	s.router.ServeHTTP(w, r)
+	checkResponseCode(t, http.StatusForbidden, w.Code)
+	checkEmptyRequestWithCookies(t, s, "GET", "/healthz", "", http.StatusOK)
+	lines = readLines()
+	if len(lines) != 1 || lines[0]["status"] != float64(403) || lines[0]["user_id"] != float64(4) {
+		t.Errorf("Expected a line of the rejected request, got %v", lines)
+	}
+
+	// IDs which don't look right are replaced
+	r = httptest.NewRequest("GET", "/", nil)
+	r.Header.Set(requestIDHeader, "not an id")
+	w = httptest.NewRecorder()
+	s.router.ServeHTTP(w, r)
+	if id := w.Header().Get(requestIDHeader); !regexp.MustCompile(`^[0-9a-f]{16}$`).MatchString(id) {
+		t.Errorf("Expected a new request ID, got %s", id)
+	}
+	readLines()
+
+	// failures are logged as errors of the request instead of stopping
+	// the server
+	s.db.Close()
+	w = checkEmptyRequestWithCookies(t, s, "GET", "/", "", http.StatusInternalServerError)
+	id := w.Header().Get(requestIDHeader)
+	lines = readLines()
+	if len(lines) < 2 || lines[len(lines)-2]["msg"] != "request failed" || lines[len(lines)-1]["level"] != "error" {
+		t.Fatalf("Unexpected lines %v", lines)
+	}
+	// the context of the request reaches everything that logs while
+	// handling it, even failures of the helpers
+	for _, line := range lines {
+		if line["request_id"] != id {
+			t.Errorf("Expected request ID %s in %v", id, line)
+		}
+	}
+}
+
+func TestFormErrors(t *testing.T) {
+	s := initTestingServer()
+
+	// forms are rendered again with the problems next to the inputs
+	w := postFormWithCookies(s, "/register/", "name=Tom&username=&password=", "")
+	checkResponseCode(t, http.StatusBadRequest, w.Code)
+	checkResponseBodySubstring(t, "please correct the marked fields", w)
+	checkResponseBodySubstring(t, `<span class="field-error">username can&#39;t be empty</span>`, w)
+	checkResponseBodySubstring(t, `<span class="field-error">password can&#39;t be empty</span>`, w)
+	checkResponseBodySubstring(t, `value="Tom"`, w)
+	if strings.Contains(w.Body.String(), `<span class="field-error">name`) {
+		t.Errorf("Expected no problem with the name")
+	}
+
+	w = postFormWithCookies(s, "/register/", "name=Bob&username=bob&password=456", "")
+	checkResponseCode(t, http.StatusConflict, w.Code)
+	checkResponseBodySubstring(t, `<span class="field-error">username is already taken</span>`, w)
+
+	bob := loginAsBob(t, s)
+	w = postFormWithCookies(s, "/profile/", "name=&email=bob&timezone=Mars", bob)
+	checkResponseCode(t, http.StatusBadRequest, w.Code)
+	checkResponseBodySubstring(t, `value="bob"`, w)
+	for _, message := range []string{"name can&#39;t be empty", "invalid email address", "unknown time zone"} {
+		checkResponseBodySubstring(t, `<span class="field-error">`+message+`</span>`, w)
+	}
+
+	w = postLogin(s, "username=bob&password=")
+	checkResponseCode(t, http.StatusBadRequest, w.Code)
+	checkResponseBodySubstring(t, `<span class="field-error">password can&#39;t be empty</span>`, w)
+	checkResponseBodySubstring(t, `value="bob"`, w)
+
+	andrzej := loginAsAndrzej(t, s)
+	w = postFormWithCookies(s, "/add-date/", "start-time=soon&end-time=2030-07-01T10:00", andrzej)
+	checkResponseCode(t, http.StatusBadRequest, w.Code)
+	checkResponseBodySubstring(t, `id="add-date-form"`, w)
+	checkResponseBodySubstring(t, `<span class="field-error">invalid start time</span>`, w)
+	checkResponseBodySubstring(t, `value="2030-07-01T10:00"`, w)
+	w = postFormWithCookies(s, "/add-date/", "start-time=2030-07-01T11:00&end-time=2030-07-01T10:00", andrzej)
+	checkResponseCode(t, http.StatusBadRequest, w.Code)
+	checkResponseBodySubstring(t, `<span class="field-error">the end has to be after the start</span>`, w)
+
+	w = postFormWithCookies(s, "/schedule/generate/", "from=2030-07-01&to=2030-06-01&length=1", andrzej)
+	checkResponseCode(t, http.StatusBadRequest, w.Code)
+	checkResponseBodySubstring(t, `id="generate-form"`, w)
+	checkResponseBodySubstring(t, `<span class="field-error">invalid length of the dates</span>`, w)
+	checkResponseBodySubstring(t, `value="2030-07-01"`, w)
+
+	w = postFormWithCookies(s, "/dates/bulk/", "action=shift&minutes=0", andrzej)
+	checkResponseCode(t, http.StatusBadRequest, w.Code)
+	checkResponseBodySubstring(t, `<span class="field-error">no dates were selected</span>`, w)
+	checkResponseBodySubstring(t, `<span class="field-error">invalid shift</span>`, w)
+
+	admin := loginAsAdmin(t, s)
+	w = postFormWithCookies(s, "/settings/", "timezone=Mars/Olympus&no_show_limit=-1", admin)
+	checkResponseCode(t, http.StatusBadRequest, w.Code)
+	checkResponseBodySubstring(t, `<span class="field-error">unknown time zone</span>`, w)
+	checkResponseBodySubstring(t, `value="Mars/Olympus"`, w)
+
+	// and the messages are translated
+	postFormWithCookies(s, "/profile/", "name=Admin&language=pl", admin)
+	w = postFormWithCookies(s, "/add-user/", "name=Tomasz&username=&password=x&role=100", admin)
+	checkResponseCode(t, http.StatusBadRequest, w.Code)
+	checkResponseBodySubstring(t, "nazwa użytkownika nie może być pusta", w)
+	checkResponseBodySubstring(t, "nieznana rola", w)
+	checkResponseBodySubstring(t, `value="Tomasz"`, w)
+}
+
+func TestJSONErrors(t *testing.T) {
+	s := initTestingServer()
+	admin := loginAsAdmin(t, s)
+
+	request := func(method string, url string, form string, accept string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(method, url, strings.NewReader(form))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.Header.Set("Accept", accept)
+		setCookiesWithCsrf(s, r, admin)
+		s.router.ServeHTTP(w, r)
+		return w
+	}
+	readError := func(w *httptest.ResponseRecorder) (e errorResponse) {
+		if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+			t.Fatalf("Expected JSON, got %s: %s", ct, w.Body.String())
+		}
+		if err := json.NewDecoder(w.Body).Decode(&e); err != nil {
+			t.Fatal(err)
+		}
+		return e
+	}
+
+	w := request("GET", "/dates/100/", "", "application/json")
+	checkResponseCode(t, http.StatusNotFound, w.Code)
+	if e := readError(w); e.Status != http.StatusNotFound || e.Error != "404: Not Found" {
+		t.Errorf("Unexpected error %+v", e)
+	}
+
+	w = request("POST", "/users/4/", "name=&username=andrzej&role=3", "application/json")
+	checkResponseCode(t, http.StatusBadRequest, w.Code)
+	e := readError(w)
+	if e.Error != "please correct the marked fields" || e.Fields["name"] != "name can't be empty" || len(e.Fields) != 1 {
+		t.Errorf("Unexpected error %+v", e)
+	}
+
+	w = request("POST", "/users/4/", "name=Bob&username=pracownik&role=3", "text/html,application/json;q=0.9")
+	checkResponseCode(t, http.StatusConflict, w.Code)
+	checkResponseBodySubstring(t, "<!DOCTYPE html>", w)
+
+	for accept, expected := range map[string]bool{
+		"": false,
+		"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8": false,
+		"*/*":                               false,
+		"application/json":                  true,
+		"application/json, text/plain, */*": false,
+		"application/json, */*;q=0.1":       true,
+		"text/html;q=0.5, application/json": true,
+	} {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Accept", accept)
+		if wantsJSON(r) != expected {
+			t.Errorf("Expected wantsJSON to be %v for %q", expected, accept)
+		}
+	}
+}
+
+func TestSearch(t *testing.T) {
+	s := initTestingServer()
+
+	w := checkEmptyRequestWithCookies(t, s, "GET", "/search/", "", http.StatusOK)
+	checkResponseBodySubstring(t, `id="search-form"`, w)
+	if strings.Contains(w.Body.String(), "Suggested dates:") {
+		t.Errorf("Expected no results before searching")
+	}
+
+	w = checkEmptyRequestWithCookies(t, s, "GET", "/search/?duration=30", "", http.StatusOK)
+	checkResponseBodySubstring(t, "Suggested dates:", w)
+	checkResponseBodySubstring(t, `action="/book/`, w)
+
+	// sample dates are an hour long
+	w = checkEmptyRequestWithCookies(t, s, "GET", "/search/?duration=120", "", http.StatusOK)
+	checkResponseBodySubstring(t, "No free dates match the search.", w)
+
+	w = httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/search/?employee=2&only=1", nil)
+	r.Header.Set("Accept", "application/json")
+	s.router.ServeHTTP(w, r)
+	checkResponseCode(t, http.StatusOK, w.Code)
+	var found []foundDate
+	if err := json.NewDecoder(w.Body).Decode(&found); err != nil {
+		t.Fatal(err)
+	}
+	if len(found) == 0 {
+		t.Errorf("Expected free dates of Andrzej")
+	}
+	for i, d := range found {
+		if d.EmployeeId != 2 || (i > 0 && d.StartTime.Before(found[i-1].StartTime)) {
+			t.Errorf("Unexpected date %+v", d)
+		}
+	}
+
+	w = checkEmptyRequestWithCookies(t, s, "GET", "/search/?after=12:00&before=10:00&to=2000-01-01", "", http.StatusBadRequest)
+	checkResponseBodySubstring(t, `id="search-form"`, w)
+	checkResponseBodySubstring(t, "the end has to be after the start", w)
+	checkResponseBodySubstring(t, "invalid last day", w)
+}
+
+func TestEmployeePage(t *testing.T) {
+	s := initTestingServer()
+	andrzej := loginAsAndrzej(t, s)
+	bob := loginAsBob(t, s)
+
+	checkEmptyRequestWithCookies(t, s, "GET", "/e/andrzej/", "", http.StatusNotFound)
+
+	w := checkEmptyRequestWithCookies(t, s, "GET", "/profile/", andrzej, http.StatusOK)
+	checkResponseBodySubstring(t, `name="slug"`, w)
+	w = postFormWithCookies(s, "/profile/", "name=Andrzej&slug=Andrzej+Nowak&photo=javascript:alert(1)", andrzej)
+	checkResponseCode(t, http.StatusBadRequest, w.Code)
+	checkResponseBodySubstring(t, "the address can contain only small letters, digits and hyphens", w)
+	checkResponseBodySubstring(t, "invalid address of the photo", w)
+
+	form := url.Values{
+		"name":     {"Andrzej"},
+		"slug":     {"Andrzej"},
+		"bio":      {"Barber since 2001."},
+		"photo":    {"https://example.com/andrzej.jpg"},
+		"services": {"Haircut\nBeard trim"},
+	}
+	w = postFormWithCookies(s, "/profile/", form.Encode(), andrzej)
+	checkResponseCode(t, http.StatusFound, w.Code)
+	w = checkEmptyRequestWithCookies(t, s, "GET", "/profile/", andrzej, http.StatusOK)
+	checkResponseBodySubstring(t, `href="/e/andrzej/"`, w)
+
+	// the page is public and shows only the dates of the employee
+	w = checkEmptyRequestWithCookies(t, s, "GET", "/e/andrzej/", "", http.StatusOK)
+	checkResponseBodySubstring(t, "Barber since 2001.", w)
+	checkResponseBodySubstring(t, `src="https://example.com/andrzej.jpg"`, w)
+	checkResponseBodySubstring(t, "<li>Beard trim</li>", w)
+	dates, err := models.GetDatesWithNamesNotBooked(context.Background(), s.db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var booked *models.DateWithNames
+	for _, d := range dates {
+		href := fmt.Sprintf(`action="/book/%d/"`, d.Id)
+		if shown := strings.Contains(w.Body.String(), href); d.AssignedTo != 2 && shown {
+			t.Errorf("Date %d of another employee is shown", d.Id)
+		} else if shown && booked == nil {
+			booked = d
+		}
+	}
+	if booked == nil {
+		t.Fatal("Expected free dates of Andrzej")
+	}
+
+	// dates are booked from the page like from anywhere else
+	w = postFormWithCookies(s, fmt.Sprintf("/book/%d/", booked.Id), "", bob)
+	checkResponseCode(t, http.StatusFound, w.Code)
+	w = checkEmptyRequestWithCookies(t, s, "GET", "/e/andrzej/", "", http.StatusOK)
+	if strings.Contains(w.Body.String(), fmt.Sprintf(`action="/book/%d/"`, booked.Id)) {
+		t.Errorf("Booked date %d is still offered", booked.Id)
+	}
+
+	// customers have no page and a page belongs to one employee
+	w = postFormWithCookies(s, "/profile/", "name=bob&slug=bob", bob)
+	checkResponseCode(t, http.StatusFound, w.Code)
+	checkEmptyRequestWithCookies(t, s, "GET", "/e/bob/", "", http.StatusNotFound)
+	w = postFormWithCookies(s, "/profile/", "name=admin&slug=andrzej", loginAsAdmin(t, s))
+	checkResponseCode(t, http.StatusConflict, w.Code)
+	checkResponseBodySubstring(t, "the address is already taken", w)
+}
+
+func TestDisconnectedDatabase(t *testing.T) {
+	s := initTestingServer()
+
+	admin := loginAsAdmin(t, s)
+
+	if err := s.db.Close(); err != nil {
+		t.Errorf("Closing the database failed")
+	}
+
+	checkEmptyRequestWithCookies(t, s, "GET", "/", admin, http.StatusInternalServerError)
+	checkEmptyRequestWithCookies(t, s, "GET", "/booked/", admin, http.StatusInternalServerError)
+	checkEmptyRequestWithCookies(t, s, "POST", "/book/1/", admin, http.StatusInternalServerError)
+	checkEmptyRequestWithCookies(t, s, "POST", "/unbook/1/", admin, http.StatusInternalServerError)
+
+	w := postLogin(s, "username=admin&password=admin")
 	checkResponseCode(t, http.StatusInternalServerError, w.Code)
 }
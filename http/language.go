@@ -0,0 +1,42 @@
+package http
+
+import (
+	"booker/i18n"
+	"booker/models"
+	"context"
+	"net/http"
+)
+
+// readLanguage stores the language of the interface in the context, the
+// one chosen in the profile or else the one preferred by the browser
+func (s *server) readLanguage(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lang := i18n.Negotiate(r.Header.Get("Accept-Language"))
+		if user := getUser(r); user != nil && i18n.IsSupported(user.Language) {
+			lang = user.Language
+		}
+		ctx := context.WithValue(r.Context(), languageKey, lang)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func getLanguage(r *http.Request) string {
+	if lang, ok := r.Context().Value(languageKey).(string); ok {
+		return lang
+	}
+	return i18n.Default
+}
+
+// tr translates the message to the language of the request
+func tr(r *http.Request, message string, args ...interface{}) string {
+	return i18n.Translate(getLanguage(r), message, args...)
+}
+
+// userLanguage returns the language in which messages are left for the
+// user, who isn't necessarily the one making the request
+func userLanguage(u *models.User) string {
+	if !i18n.IsSupported(u.Language) {
+		return i18n.Default
+	}
+	return u.Language
+}
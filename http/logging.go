@@ -0,0 +1,103 @@
+package http
+
+import (
+	"booker/logging"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+const requestIDHeader = "X-Request-ID"
+
+// IDs from a proxy in front of the server are kept if they look sane
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,64}$`)
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// assignRequestID gives the request an ID, sent back in a header and
+// added to every line logged through the context of the request
+func (s *server) assignRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID.MatchString(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(requestIDHeader, id)
+		ctx := logging.NewContext(r.Context(), s.logger.With("request_id", id))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// probeRoutes are requested so often that they're logged only for debugging
+var probeRoutes = map[string]bool{"/healthz": true, "/readyz": true}
+
+// loggedRequest collects what the middleware further down learns
+// about the request, for its line written at the end
+type loggedRequest struct {
+	userId int // -1 if nobody is signed in
+}
+
+// logRequests writes a line for every request, including those
+// rejected by other middleware
+func logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		lr := &loggedRequest{userId: -1}
+		r = r.WithContext(context.WithValue(r.Context(), loggedRequestKey, lr))
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		route := chi.RouteContext(r.Context()).RoutePattern()
+		level := logging.LevelInfo
+		if status >= 500 {
+			level = logging.LevelError
+		} else if probeRoutes[route] {
+			level = logging.LevelDebug
+		}
+		logger := requestLogger(r)
+		if lr.userId != -1 {
+			logger = logger.With("user_id", lr.userId)
+		}
+		logger.Log(level, "request",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"route", route,
+			"status", status,
+			"bytes", ww.BytesWritten(),
+			"duration", time.Since(start),
+			"remote", r.RemoteAddr,
+		)
+	})
+}
+
+// withUserLogger adds the id of the signed in user to the logs,
+// including the line of the request
+func withUserLogger(ctx context.Context, userId int) context.Context {
+	if lr, ok := ctx.Value(loggedRequestKey).(*loggedRequest); ok {
+		lr.userId = userId
+	}
+	return logging.NewContext(ctx, logging.FromContext(ctx).With("user_id", userId))
+}
+
+func requestLogger(r *http.Request) *logging.Logger {
+	return logging.FromContext(r.Context())
+}
+
+// logError logs a failure of handling the request
+func logError(r *http.Request, err error) {
+	requestLogger(r).Error("request failed", "error", err)
+}
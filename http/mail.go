@@ -0,0 +1,47 @@
+package http
+
+import (
+	"booker/config"
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+)
+
+// mailer sends a plain text email to the address
+type mailer func(to string, subject string, body string) error
+
+// smtpMailer sends emails through the configured server, signing in
+// when a user name is given. There's none without a host.
+func smtpMailer(c config.SMTP) mailer {
+	if c.Host == "" {
+		return nil
+	}
+	addr := net.JoinHostPort(c.Host, strconv.Itoa(c.Port))
+	var auth smtp.Auth
+	if c.Username != "" {
+		auth = smtp.PlainAuth("", c.Username, c.Password, c.Host)
+	}
+	return func(to string, subject string, body string) error {
+		from, err := mail.ParseAddress(c.From)
+		if err != nil {
+			return err
+		}
+		rcpt, err := mail.ParseAddress(to)
+		if err != nil {
+			return err
+		}
+		var msg strings.Builder
+		fmt.Fprintf(&msg, "From: %s\r\n", from)
+		fmt.Fprintf(&msg, "To: %s\r\n", rcpt)
+		fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+		msg.WriteString("MIME-Version: 1.0\r\n")
+		msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+		msg.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+		msg.WriteString(body + "\r\n")
+		return smtp.SendMail(addr, auth, from.Address, []string{rcpt.Address}, []byte(msg.String()))
+	}
+}
@@ -0,0 +1,92 @@
+package http
+
+import (
+	"booker/metrics"
+	"booker/models"
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+const readinessTimeout = 2 * time.Second
+
+type serverMetrics struct {
+	registry      metrics.Registry
+	requests      *metrics.Counter
+	latency       *metrics.Histogram
+	bookings      *metrics.Counter
+	cancellations *metrics.Counter
+}
+
+func (s *server) newMetrics() *serverMetrics {
+	m := &serverMetrics{
+		requests: metrics.NewCounter("booker_http_requests_total",
+			"Handled HTTP requests.", "method", "route", "code"),
+		latency: metrics.NewHistogram("booker_http_request_duration_seconds",
+			"Time spent handling HTTP requests.", metrics.DefaultBuckets, "method", "route"),
+		bookings: metrics.NewCounter("booker_bookings_total",
+			"Dates booked, pending ones wait for approval.", "status"),
+		cancellations: metrics.NewCounter("booker_cancellations_total",
+			"Cancelled bookings, late ones, because the date was removed or the customer deleted.", "kind"),
+	}
+	activeSessions := metrics.NewGaugeFunc("booker_active_sessions",
+		"Sessions which haven't expired yet.", func() (float64, error) {
+			n, err := models.CountActiveSessions(context.Background(), s.db, time.Now())
+			return float64(n), err
+		})
+	m.registry.Register(m.requests, m.latency, m.bookings, m.cancellations, activeSessions, models.QueryDuration)
+	return m
+}
+
+// measureRequests counts requests by the pattern of their route, so that
+// every date or user doesn't get a series of its own
+func (s *server) measureRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+
+		route := "unmatched"
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		s.metrics.requests.Inc(r.Method, route, strconv.Itoa(status))
+		s.metrics.latency.Observe(time.Since(start).Seconds(), r.Method, route)
+	})
+}
+
+// healthzHandler tells that the process is up, without touching the database
+func (s *server) healthzHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte("ok\n"))
+}
+
+// readyzHandler tells whether requests can be served, which needs the
+// database with the current schema
+func (s *server) readyzHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+	defer cancel()
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if err := models.CheckSchema(ctx, s.db); err != nil {
+		requestLogger(r).Warn("not ready", "error", err)
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte("not ready\n"))
+		return
+	}
+	w.Write([]byte("ok\n"))
+}
+
+func (s *server) metricsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", metrics.ContentType)
+	if err := s.metrics.registry.WriteText(w); err != nil {
+		logError(r, err)
+	}
+}
@@ -0,0 +1,311 @@
+package http
+
+import (
+	"booker/models"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// languages users can choose from, the empty one means
+// that the language of the browser is used
+var profileLanguages = []struct {
+	Code string
+	Name string
+}{
+	{"", "browser default"},
+	{"en", "English"},
+	{"pl", "Polski"},
+}
+
+func isValidLanguage(code string) bool {
+	for _, l := range profileLanguages {
+		if l.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+// profileData fills the form with the user, page is the saved
+// slug of their public page which the form may be changing.
+// Notifications by email are offered only if they can be sent.
+func (s *server) profileData(u *models.User, page string) map[string]interface{} {
+	return map[string]interface{}{
+		"user":      u,
+		"languages": profileLanguages,
+		"page":      page,
+		"email":     s.sendMail != nil,
+	}
+}
+
+func (s *server) profileView(w http.ResponseWriter, r *http.Request) error {
+	user := getUser(r)
+	if user == nil {
+		return statusError(http.StatusForbidden)
+	}
+	renderTemplate(w, r, "profile.html", s.profileData(user, user.Slug))
+	return nil
+}
+
+func (s *server) profileHandler(w http.ResponseWriter, r *http.Request) error {
+	user := getUser(r)
+	if user == nil {
+		return statusError(http.StatusForbidden)
+	}
+
+	r.ParseForm()
+
+	u := *user
+	u.Name = strings.TrimSpace(r.Form.Get("name"))
+	u.Email = strings.TrimSpace(r.Form.Get("email"))
+	u.Phone = strings.TrimSpace(r.Form.Get("phone"))
+	u.Language = r.Form.Get("language")
+	u.Timezone = strings.TrimSpace(r.Form.Get("timezone"))
+	// notifications are sent by email only if there's a server for it,
+	// and there's no SMS gateway yet, so NotifySms isn't offered
+	u.NotifyEmail = s.sendMail != nil && r.Form.Get("notify-email") != ""
+	if user.Can(models.PermOwnSlots) {
+		u.Slug = strings.ToLower(strings.TrimSpace(r.Form.Get("slug")))
+		u.Bio = strings.TrimSpace(r.Form.Get("bio"))
+		u.Photo = strings.TrimSpace(r.Form.Get("photo"))
+		u.Services = strings.TrimSpace(r.Form.Get("services"))
+	}
+
+	fields := fieldErrors{}
+	if u.Name == "" {
+		fields.add("name", "name can't be empty")
+	}
+	if _, err := mail.ParseAddress(u.Email); u.Email != "" && err != nil {
+		fields.add("email", "invalid email address")
+	}
+	if u.NotifyEmail && u.Email == "" {
+		fields.add("notify-email", "email notifications need an email address")
+	}
+	if !isValidLanguage(u.Language) {
+		fields.add("language", "unknown language")
+	}
+	if u.Timezone != "" && !isValidTimezone(u.Timezone) {
+		fields.add("timezone", "unknown time zone")
+	}
+	if u.Slug != "" && (len(u.Slug) > maxSlugLength || !validSlug.MatchString(u.Slug)) {
+		fields.add("slug", "the address can contain only small letters, digits and hyphens")
+	}
+	if u.Photo != "" && !isValidPhoto(u.Photo) {
+		fields.add("photo", "invalid address of the photo")
+	}
+	if len(fields) > 0 {
+		return formError("profile.html", s.profileData(&u, user.Slug), fields)
+	}
+
+	err := models.UpdateUserProfile(r.Context(), s.db, &u)
+	if errors.Is(err, models.ErrConflict) {
+		e := formError("profile.html", s.profileData(&u, user.Slug), fieldErrors{"slug": "the address is already taken"})
+		e.status = http.StatusConflict
+		return e
+	} else if err != nil {
+		return err
+	}
+
+	http.Redirect(w, r, "/profile/", http.StatusFound)
+	return nil
+}
+
+// structure of the personal data export, credentials like the password,
+// session tokens or the TOTP secret are deliberately left out
+type dataExport struct {
+	ExportedAt    time.Time              `json:"exportedAt"`
+	User          exportedUser           `json:"user"`
+	Bookings      []exportedBooking      `json:"bookings"`
+	Cancellations []exportedCancellation `json:"cancellations"`
+	Sessions      []exportedSession      `json:"sessions"`
+	Activity      []exportedEvent        `json:"activity"`
+}
+
+type exportedUser struct {
+	Id          int    `json:"id"`
+	Name        string `json:"name"`
+	Username    string `json:"username"`
+	Role        string `json:"role"`
+	Email       string `json:"email"`
+	Phone       string `json:"phone"`
+	Language    string `json:"language"`
+	Timezone    string `json:"timezone"`
+	NotifyEmail bool   `json:"notifyEmail"`
+	NotifySms   bool   `json:"notifySms"`
+	TotpEnabled bool   `json:"totpEnabled"`
+	Slug        string `json:"slug,omitempty"`
+	Bio         string `json:"bio,omitempty"`
+	Photo       string `json:"photo,omitempty"`
+	Services    string `json:"services,omitempty"`
+}
+
+type exportedBooking struct {
+	DateId    int               `json:"dateId"`
+	StartTime time.Time         `json:"startTime"`
+	EndTime   time.Time         `json:"endTime"`
+	Employee  string            `json:"employee"`
+	Answers   map[string]string `json:"answers"`
+}
+
+type exportedCancellation struct {
+	StartTime   time.Time `json:"startTime"`
+	Employee    string    `json:"employee"`
+	CancelledAt time.Time `json:"cancelledAt"`
+	Reason      string    `json:"reason"`
+	Late        bool      `json:"late"`
+}
+
+type exportedSession struct {
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+type exportedEvent struct {
+	Time   time.Time `json:"time"`
+	Action string    `json:"action"`
+	Target string    `json:"target"`
+	IP     string    `json:"ip"`
+}
+
+func (s *server) collectDataExport(ctx context.Context, u *models.User) (*dataExport, error) {
+	export := dataExport{
+		ExportedAt: time.Now(),
+		User: exportedUser{
+			Id:          u.Id,
+			Name:        u.Name,
+			Username:    u.Username,
+			Role:        u.RoleName,
+			Email:       u.Email,
+			Phone:       u.Phone,
+			Language:    u.Language,
+			Timezone:    u.Timezone,
+			NotifyEmail: u.NotifyEmail,
+			NotifySms:   u.NotifySms,
+			TotpEnabled: u.TotpEnabled,
+			Slug:        u.Slug,
+			Bio:         u.Bio,
+			Photo:       u.Photo,
+			Services:    u.Services,
+		},
+		Bookings:      []exportedBooking{},
+		Cancellations: []exportedCancellation{},
+		Sessions:      []exportedSession{},
+		Activity:      []exportedEvent{},
+	}
+
+	dates, err := models.GetDatesWithNamesBookedBy(ctx, s.db, u.Id)
+	if err != nil {
+		return nil, err
+	}
+	dateIds := make([]int, len(dates))
+	for i, d := range dates {
+		dateIds[i] = d.Id
+	}
+	answers, err := models.GetBookingAnswers(ctx, s.db, dateIds)
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range dates {
+		b := exportedBooking{
+			DateId:    d.Id,
+			StartTime: d.StartTime,
+			EndTime:   d.EndTime,
+			Employee:  d.AssignedToName,
+			Answers:   make(map[string]string),
+		}
+		for _, a := range answers[d.Id] {
+			b.Answers[a.Label] = a.Value
+		}
+		export.Bookings = append(export.Bookings, b)
+	}
+
+	cancellations, err := models.GetCancellationsBookedBy(ctx, s.db, u.Id)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range cancellations {
+		export.Cancellations = append(export.Cancellations,
+			exportedCancellation{c.StartTime, c.AssignedToName, c.Time, c.Reason, c.Late})
+	}
+
+	sessions, err := models.GetSessionsByUser(ctx, s.db, u.Id)
+	if err != nil {
+		return nil, err
+	}
+	for _, sess := range sessions {
+		export.Sessions = append(export.Sessions, exportedSession{sess.ExpiresAt})
+	}
+
+	entries, err := models.GetAuditEntriesByActor(ctx, s.db, u.Id)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		export.Activity = append(export.Activity, exportedEvent{e.Time, e.Action, e.Target, e.IP})
+	}
+
+	return &export, nil
+}
+
+func (s *server) exportDataHandler(w http.ResponseWriter, r *http.Request) error {
+	user := getUser(r)
+	if user == nil {
+		return statusError(http.StatusForbidden)
+	}
+
+	export, err := s.collectDataExport(r.Context(), user)
+	if err != nil {
+		return err
+	}
+	body, err := json.MarshalIndent(export, "", "  ")
+	if err != nil {
+		return err
+	}
+	s.audit(r, user.Id, models.AuditExportData, user.Id, "")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", `attachment; filename="booker-data.json"`)
+	w.Write(body)
+	return nil
+}
+
+func (s *server) eraseAccountView(w http.ResponseWriter, r *http.Request) error {
+	user := getUser(r)
+	if user == nil {
+		return statusError(http.StatusForbidden)
+	}
+	renderTemplate(w, r, "erase_account.html", user)
+	return nil
+}
+
+func (s *server) eraseAccountHandler(w http.ResponseWriter, r *http.Request) error {
+	user := getUser(r)
+	if user == nil {
+		return statusError(http.StatusForbidden)
+	}
+
+	if user.IsStaff() {
+		e := newError(http.StatusForbidden, "staff accounts can only be removed by an administrator")
+		e.template, e.data = "erase_account.html", user
+		return e
+	}
+	r.ParseForm()
+	if r.Form.Get("password") != user.Password {
+		return formError("erase_account.html", user, fieldErrors{"password": "invalid password"})
+	}
+
+	if err := models.AnonymizeUser(r.Context(), s.db, user.Id, uuid.NewString()); err != nil {
+		return err
+	}
+	s.audit(r, user.Id, models.AuditEraseAccount, user.Id, "")
+
+	http.SetCookie(w, sessionCookie(r, "", time.Now()))
+	http.Redirect(w, r, "/", http.StatusFound)
+	return nil
+}
@@ -0,0 +1,120 @@
+package http
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// failed attempts after which the backoff kicks in, each further
+	// failure doubles the delay
+	loginFreeAttemptsPerUser = 3
+	loginFreeAttemptsPerIP   = 20
+
+	loginBackoffBase = time.Second
+	loginBackoffMax  = 15 * time.Minute
+
+	// failures are forgotten after this much time without a new one
+	loginFailureWindow = time.Hour
+
+	// consecutive failures after which the account itself is locked
+	loginLockoutThreshold = 10
+	loginLockoutDuration  = 30 * time.Minute
+)
+
+type loginAttempts struct {
+	failures     int
+	lastFailure  time.Time
+	blockedUntil time.Time
+}
+
+// loginLimiter counts failed login attempts per key and enforces
+// an exponential backoff between them
+type loginLimiter struct {
+	mu           sync.Mutex
+	freeAttempts int
+	attempts     map[string]*loginAttempts
+	lastPrune    time.Time
+	now          func() time.Time
+}
+
+func newLoginLimiter(freeAttempts int) *loginLimiter {
+	return &loginLimiter{
+		freeAttempts: freeAttempts,
+		attempts:     make(map[string]*loginAttempts),
+		now:          time.Now,
+	}
+}
+
+// retryAfter returns how long the key has to wait before the next attempt
+func (l *loginLimiter) retryAfter(key string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	a, ok := l.attempts[key]
+	if !ok {
+		return 0
+	}
+	if wait := a.blockedUntil.Sub(l.now()); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+func (l *loginLimiter) fail(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.prune(now)
+
+	a, ok := l.attempts[key]
+	if !ok {
+		a = &loginAttempts{}
+		l.attempts[key] = a
+	} else if now.Sub(a.lastFailure) > loginFailureWindow {
+		a.failures = 0
+	}
+	a.failures++
+	a.lastFailure = now
+
+	if extra := a.failures - l.freeAttempts; extra >= 0 {
+		delay := loginBackoffMax
+		if extra < 32 {
+			delay = loginBackoffBase << extra
+		}
+		if delay > loginBackoffMax {
+			delay = loginBackoffMax
+		}
+		a.blockedUntil = now.Add(delay)
+	}
+}
+
+func (l *loginLimiter) reset(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.attempts, key)
+}
+
+// prune forgets keys which haven't failed recently, has to be called with l.mu held
+func (l *loginLimiter) prune(now time.Time) {
+	if now.Sub(l.lastPrune) < time.Minute {
+		return
+	}
+	l.lastPrune = now
+	for key, a := range l.attempts {
+		if now.Sub(a.lastFailure) > loginFailureWindow && now.After(a.blockedUntil) {
+			delete(l.attempts, key)
+		}
+	}
+}
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,350 @@
+package http
+
+import (
+	"booker/models"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	maxGeneratedDays = 366
+	minSlotLength    = 5 * time.Minute
+)
+
+// weekdays in the order shown in the schedule
+var scheduleWeekdays = []time.Weekday{
+	time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday, time.Saturday, time.Sunday,
+}
+
+type scheduleDay struct {
+	Weekday time.Weekday
+	Start   string
+	End     string
+}
+
+type scheduleAbsence struct {
+	*models.Absence
+	Collisions []*models.DateWithNames
+}
+
+// scheduleEmployee reads whose schedule is edited from the "employee"
+// parameter, by default it's the user's own one
+func (s *server) scheduleEmployee(r *http.Request) (*models.User, error) {
+	user := getUser(r)
+	empId := user.Id
+	if v := r.FormValue("employee"); v != "" {
+		var err error
+		if empId, err = strconv.Atoi(v); err != nil {
+			return nil, statusError(http.StatusBadRequest)
+		}
+	}
+	if empId != user.Id && !user.Can(models.PermManageSlots) {
+		return nil, statusError(http.StatusForbidden)
+	}
+
+	emp, err := models.GetUserById(r.Context(), s.db, empId)
+	if err != nil {
+		return nil, err
+	} else if !emp.Can(models.PermOwnSlots) {
+		return nil, statusError(http.StatusBadRequest)
+	}
+	return emp, nil
+}
+
+func scheduleURL(emp *models.User) string {
+	return "/schedule/?employee=" + strconv.Itoa(emp.Id)
+}
+
+func (s *server) scheduleData(r *http.Request, emp *models.User, generated int) (map[string]interface{}, error) {
+	user := getUser(r)
+
+	hours, err := models.GetWorkingHours(r.Context(), s.db, emp.Id)
+	if err != nil {
+		return nil, err
+	}
+	byDay := make(map[time.Weekday]*models.WorkingHours)
+	for _, h := range hours {
+		byDay[h.Weekday] = h
+	}
+	days := make([]scheduleDay, len(scheduleWeekdays))
+	for i, wd := range scheduleWeekdays {
+		days[i].Weekday = wd
+		if h, ok := byDay[wd]; ok {
+			days[i].Start = models.FormatMinutes(h.Start)
+			days[i].End = models.FormatMinutes(h.End)
+		}
+	}
+
+	breaks, err := models.GetBreaks(r.Context(), s.db, emp.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	absences, err := models.GetAbsences(r.Context(), s.db, emp.Id, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	withCollisions := make([]scheduleAbsence, len(absences))
+	for i, a := range absences {
+		dates, err := models.GetBookedDatesBetween(r.Context(), s.db, emp.Id, a.StartTime, a.EndTime)
+		if err != nil {
+			return nil, err
+		}
+		withCollisions[i] = scheduleAbsence{a, dates}
+	}
+
+	var emps []*models.User
+	if user.Can(models.PermManageSlots) {
+		if emps, err = models.GetUsersWithPermission(r.Context(), s.db, models.PermOwnSlots); err != nil {
+			return nil, err
+		}
+	}
+
+	return map[string]interface{}{
+		"emp":       emp,
+		"emps":      emps,
+		"days":      days,
+		"weekdays":  scheduleWeekdays,
+		"breaks":    breaks,
+		"absences":  withCollisions,
+		"kinds":     models.AbsenceKinds,
+		"generated": generated,
+		"timezone":  s.businessLocation(r.Context()).String(),
+	}, nil
+}
+
+func (s *server) renderSchedule(w http.ResponseWriter, r *http.Request, emp *models.User, generated int) error {
+	data, err := s.scheduleData(r, emp, generated)
+	if err != nil {
+		return err
+	}
+	renderTemplate(w, r, "schedule.html", data)
+	return nil
+}
+
+// scheduleError shows the problems of one of the forms of the schedule
+func (s *server) scheduleError(r *http.Request, emp *models.User, fields fieldErrors) error {
+	data, err := s.scheduleData(r, emp, -1)
+	if err != nil {
+		return err
+	}
+	return formError("schedule.html", data, fields)
+}
+
+func (s *server) scheduleView(w http.ResponseWriter, r *http.Request) error {
+	emp, err := s.scheduleEmployee(r)
+	if err != nil {
+		return err
+	}
+	return s.renderSchedule(w, r, emp, -1)
+}
+
+// readPeriod reads start and end of the day as HH:MM from the form,
+// adding the problems to the fields
+func readPeriod(r *http.Request, fields fieldErrors, startName string, endName string) (int, int) {
+	start, err := models.ParseMinutes(r.Form.Get(startName))
+	if err != nil {
+		fields.add(startName, "invalid time of day")
+	}
+	end, err := models.ParseMinutes(r.Form.Get(endName))
+	if err != nil {
+		fields.add(endName, "invalid time of day")
+	} else if end <= start {
+		fields.add(endName, "the end has to be after the start")
+	}
+	return start, end
+}
+
+func (s *server) workingHoursHandler(w http.ResponseWriter, r *http.Request) error {
+	emp, err := s.scheduleEmployee(r)
+	if err != nil {
+		return err
+	}
+
+	var hours []*models.WorkingHours
+	fields := fieldErrors{}
+	for _, wd := range scheduleWeekdays {
+		day := strconv.Itoa(int(wd))
+		if r.Form.Get("start-"+day) == "" && r.Form.Get("end-"+day) == "" {
+			continue
+		}
+		start, end := readPeriod(r, fields, "start-"+day, "end-"+day)
+		hours = append(hours, &models.WorkingHours{UserId: emp.Id, Weekday: wd, Start: start, End: end})
+	}
+	if len(fields) > 0 {
+		return s.scheduleError(r, emp, fields)
+	}
+
+	if err := models.SetWorkingHours(r.Context(), s.db, emp.Id, hours); err != nil {
+		return err
+	}
+	http.Redirect(w, r, scheduleURL(emp), http.StatusFound)
+	return nil
+}
+
+func (s *server) createBreakHandler(w http.ResponseWriter, r *http.Request) error {
+	emp, err := s.scheduleEmployee(r)
+	if err != nil {
+		return err
+	}
+
+	fields := fieldErrors{}
+	weekday, err := strconv.Atoi(r.Form.Get("weekday"))
+	if err != nil || weekday < 0 || weekday > 6 {
+		fields.add("weekday", "unknown day of the week")
+	}
+	start, end := readPeriod(r, fields, "start", "end")
+	if len(fields) > 0 {
+		return s.scheduleError(r, emp, fields)
+	}
+
+	b := models.Break{UserId: emp.Id, Weekday: time.Weekday(weekday), Start: start, End: end}
+	if err = models.CreateBreak(r.Context(), s.db, &b); err != nil {
+		return err
+	}
+	http.Redirect(w, r, scheduleURL(emp), http.StatusFound)
+	return nil
+}
+
+func (s *server) deleteBreakHandler(w http.ResponseWriter, r *http.Request) error {
+	emp, err := s.scheduleEmployee(r)
+	if err != nil {
+		return err
+	}
+	breakId, err := strconv.Atoi(chi.URLParam(r, "breakId"))
+	if err != nil {
+		return statusError(http.StatusBadRequest)
+	}
+
+	if err = models.DeleteBreak(r.Context(), s.db, breakId, emp.Id); err != nil {
+		return err
+	}
+	http.Redirect(w, r, scheduleURL(emp), http.StatusFound)
+	return nil
+}
+
+func (s *server) createAbsenceHandler(w http.ResponseWriter, r *http.Request) error {
+	emp, err := s.scheduleEmployee(r)
+	if err != nil {
+		return err
+	}
+
+	kind := r.Form.Get("kind")
+	if !models.IsValidAbsenceKind(kind) {
+		return statusError(http.StatusBadRequest)
+	}
+	fields := fieldErrors{}
+	start, err := parseFormTime(r, dateInputLayout, r.Form.Get("start-time"))
+	if err != nil {
+		fields.add("start-time", "invalid start of the absence")
+	}
+	end, err := parseFormTime(r, dateInputLayout, r.Form.Get("end-time"))
+	if err != nil || (len(fields) == 0 && !end.After(start)) {
+		fields.add("end-time", "invalid end of the absence")
+	}
+	if len(fields) > 0 {
+		return s.scheduleError(r, emp, fields)
+	}
+
+	a := models.Absence{
+		UserId:    emp.Id,
+		StartTime: start,
+		EndTime:   end,
+		Kind:      kind,
+		Note:      strings.TrimSpace(r.Form.Get("note")),
+	}
+	if err = models.CreateAbsence(r.Context(), s.db, &a); err != nil {
+		return err
+	}
+	http.Redirect(w, r, scheduleURL(emp), http.StatusFound)
+	return nil
+}
+
+func (s *server) deleteAbsenceHandler(w http.ResponseWriter, r *http.Request) error {
+	emp, err := s.scheduleEmployee(r)
+	if err != nil {
+		return err
+	}
+	absenceId, err := strconv.Atoi(chi.URLParam(r, "absenceId"))
+	if err != nil {
+		return statusError(http.StatusBadRequest)
+	}
+
+	if err = models.DeleteAbsence(r.Context(), s.db, absenceId, emp.Id); err != nil {
+		return err
+	}
+	http.Redirect(w, r, scheduleURL(emp), http.StatusFound)
+	return nil
+}
+
+// generateDatesHandler creates free dates from the working hours,
+// leaving out breaks, absences and already existing dates
+func (s *server) generateDatesHandler(w http.ResponseWriter, r *http.Request) error {
+	user := getUser(r)
+	emp, err := s.scheduleEmployee(r)
+	if err != nil {
+		return err
+	}
+
+	// working hours are kept in the zone of the business
+	const layout = "2006-01-02"
+	loc := s.businessLocation(r.Context())
+	fields := fieldErrors{}
+	from, err := time.ParseInLocation(layout, r.Form.Get("from"), loc)
+	if err != nil {
+		fields.add("from", "invalid first day")
+	}
+	to, err := time.ParseInLocation(layout, r.Form.Get("to"), loc)
+	if err != nil || (len(fields) == 0 && (to.Before(from) || to.Sub(from) > maxGeneratedDays*24*time.Hour)) {
+		fields.add("to", "invalid last day, at most a year can be filled at once")
+	}
+	minutes, err := strconv.Atoi(r.Form.Get("length"))
+	length := time.Duration(minutes) * time.Minute
+	if err != nil || length < minSlotLength {
+		fields.add("length", "invalid length of the dates")
+	}
+	if len(fields) > 0 {
+		return s.scheduleError(r, emp, fields)
+	}
+
+	hours, err := models.GetWorkingHours(r.Context(), s.db, emp.Id)
+	if err != nil {
+		return err
+	}
+	breaks, err := models.GetBreaks(r.Context(), s.db, emp.Id)
+	if err != nil {
+		return err
+	}
+	absences, err := models.GetAbsences(r.Context(), s.db, emp.Id, from)
+	if err != nil {
+		return err
+	}
+
+	// dates in the past are never generated
+	var slots []models.Slot
+	now := time.Now()
+	for _, slot := range models.PlanSlots(hours, breaks, absences, from, to, length, loc) {
+		if slot.StartTime.After(now) {
+			slots = append(slots, slot)
+		}
+	}
+
+	created, err := models.CreateDates(r.Context(), s.db, emp.Id, slots)
+	if err != nil {
+		return err
+	}
+	s.auditEntry(r, &models.AuditEntry{
+		ActorId:      user.Id,
+		Action:       models.AuditAddDate,
+		Target:       r.Form.Get("from") + " - " + r.Form.Get("to"),
+		TargetUserId: emp.Id,
+		TargetDateId: -1,
+		After:        auditValue(map[string]interface{}{"created": created, "length": minutes}),
+	})
+
+	return s.renderSchedule(w, r, emp, created)
+}
@@ -0,0 +1,164 @@
+package http
+
+import (
+	"booker/models"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultSearchDays = 7
+	maxSearchDays     = 62 // about two months
+	searchLimit       = 10
+)
+
+// searchForm keeps the search as it was sent, to fill the form again
+type searchForm struct {
+	From      string
+	To        string
+	Weekdays  map[time.Weekday]bool
+	After     string
+	Before    string
+	Employees map[int]bool
+	Only      bool
+	Duration  string
+}
+
+// parseSearch reads the search from the query, days and times of day are
+// taken in the zone in which the user sees times. The search is limited to
+// future dates.
+func parseSearch(r *http.Request) (models.DateSearch, searchForm, fieldErrors) {
+	const layout = "2006-01-02"
+	loc := getLocation(r)
+	now := time.Now().In(loc)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	q := r.URL.Query()
+	form := searchForm{
+		From:      strings.TrimSpace(q.Get("from")),
+		To:        strings.TrimSpace(q.Get("to")),
+		Weekdays:  make(map[time.Weekday]bool),
+		After:     strings.TrimSpace(q.Get("after")),
+		Before:    strings.TrimSpace(q.Get("before")),
+		Employees: make(map[int]bool),
+		Only:      q.Get("only") != "",
+		Duration:  strings.TrimSpace(q.Get("duration")),
+	}
+	search := models.DateSearch{Location: loc, Limit: searchLimit, OnlyEmployees: form.Only}
+	fields := fieldErrors{}
+
+	from := today
+	if form.From != "" {
+		var err error
+		if from, err = time.ParseInLocation(layout, form.From, loc); err != nil {
+			fields.add("from", "invalid first day")
+		}
+	}
+	to := from.AddDate(0, 0, defaultSearchDays-1)
+	if form.To != "" {
+		var err error
+		if to, err = time.ParseInLocation(layout, form.To, loc); err != nil || to.Before(from) {
+			fields.add("to", "invalid last day")
+		} else if to.After(from.AddDate(0, 0, maxSearchDays-1)) {
+			fields.add("to", "at most two months can be searched at once")
+		}
+	}
+	search.From = from
+	if search.From.Before(now) {
+		search.From = now
+	}
+	search.To = to.AddDate(0, 0, 1)
+
+	for _, v := range q["weekday"] {
+		day, err := strconv.Atoi(v)
+		if err != nil || day < 0 || day > 6 {
+			fields.add("weekday", "unknown day of the week")
+			continue
+		}
+		form.Weekdays[time.Weekday(day)] = true
+		search.Weekdays = append(search.Weekdays, time.Weekday(day))
+	}
+
+	var err error
+	if form.After != "" {
+		if search.After, err = models.ParseMinutes(form.After); err != nil {
+			fields.add("after", "invalid time of day")
+		}
+	}
+	if form.Before != "" {
+		if search.Before, err = models.ParseMinutes(form.Before); err != nil {
+			fields.add("before", "invalid time of day")
+		} else if search.Before <= search.After {
+			fields.add("before", "the end has to be after the start")
+		}
+	}
+
+	for _, v := range q["employee"] {
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			fields.add("employee", "unknown employee")
+			continue
+		}
+		form.Employees[id] = true
+		search.Employees = append(search.Employees, id)
+	}
+
+	if form.Duration != "" {
+		minutes, err := strconv.Atoi(form.Duration)
+		if err != nil || minutes <= 0 || minutes > 24*60 {
+			fields.add("duration", "invalid length of the visit")
+		}
+		search.Duration = time.Duration(minutes) * time.Minute
+	}
+	return search, form, fields
+}
+
+type foundDate struct {
+	Id         int       `json:"id"`
+	StartTime  time.Time `json:"startTime"`
+	EndTime    time.Time `json:"endTime"`
+	EmployeeId int       `json:"employeeId"`
+	Employee   string    `json:"employee"`
+}
+
+// searchView suggests the best free dates for the search, the form is
+// shown empty until something is searched for
+func (s *server) searchView(w http.ResponseWriter, r *http.Request) error {
+	employees, err := models.GetUsersWithPermission(r.Context(), s.db, models.PermOwnSlots)
+	if err != nil {
+		return err
+	}
+	search, form, fields := parseSearch(r)
+	searched := len(r.URL.Query()) > 0
+	data := map[string]interface{}{
+		"form":      form,
+		"weekdays":  scheduleWeekdays,
+		"employees": employees,
+		"searched":  searched,
+	}
+	if len(fields) > 0 {
+		return formError("search.html", data, fields)
+	}
+
+	var dates []*models.DateWithNames
+	if searched || wantsJSON(r) {
+		if dates, err = models.SearchFreeDates(r.Context(), s.db, search); err != nil {
+			return err
+		}
+	}
+
+	if wantsJSON(r) {
+		found := []foundDate{}
+		for _, d := range dates {
+			found = append(found, foundDate{d.Id, d.StartTime, d.EndTime, d.AssignedTo, d.AssignedToName})
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(w).Encode(found)
+		return nil
+	}
+	data["dates"] = dates
+	renderTemplate(w, r, "search.html", data)
+	return nil
+}
@@ -0,0 +1,140 @@
+package http
+
+import (
+	"booker/logging"
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	readHeaderTimeout = 5 * time.Second
+	readTimeout       = 15 * time.Second
+	writeTimeout      = 30 * time.Second
+	idleTimeout       = 2 * time.Minute
+	// requests still running after it are dropped on shutdown
+	shutdownTimeout = 30 * time.Second
+)
+
+func (s *server) newHTTPServer(handler http.Handler) *http.Server {
+	return &http.Server{
+		Handler:           handler,
+		ErrorLog:          s.logger.StdLogger(logging.LevelWarn),
+		ReadHeaderTimeout: readHeaderTimeout,
+		ReadTimeout:       readTimeout,
+		WriteTimeout:      writeTimeout,
+		IdleTimeout:       idleTimeout,
+	}
+}
+
+// Run listens on the configured addresses and serves requests until the
+// context is cancelled
+func (s *server) Run(ctx context.Context) error {
+	l, err := net.Listen("tcp", s.config.Listen)
+	if err != nil {
+		return err
+	}
+	var redirect, metrics net.Listener
+	if s.config.TLS.Enabled() && s.config.TLS.RedirectListen != "" {
+		if redirect, err = net.Listen("tcp", s.config.TLS.RedirectListen); err != nil {
+			l.Close()
+			return err
+		}
+	}
+	if s.config.MetricsListen != "" {
+		if metrics, err = net.Listen("tcp", s.config.MetricsListen); err != nil {
+			l.Close()
+			if redirect != nil {
+				redirect.Close()
+			}
+			return err
+		}
+	}
+	return s.Serve(ctx, l, redirect, metrics)
+}
+
+// Serve serves requests on the listener, over HTTPS when it's configured,
+// redirects plain HTTP requests to HTTPS on the redirect listener and
+// serves the metrics on the metrics listener, if they are given. When the
+// context is cancelled, it stops accepting new requests, waits for the ones
+// in progress and stops background workers.
+func (s *server) Serve(ctx context.Context, l net.Listener, redirect net.Listener, metrics net.Listener) error {
+	servers := []*http.Server{s.newHTTPServer(s.router)}
+	errs := make(chan error, 3)
+	s.logger.Info("starting server", "addr", l.Addr().String(), "tls", s.config.TLS.Enabled())
+	go func() {
+		if s.config.TLS.Enabled() {
+			errs <- servers[0].ServeTLS(l, s.config.TLS.CertFile, s.config.TLS.KeyFile)
+		} else {
+			errs <- servers[0].Serve(l)
+		}
+	}()
+	if redirect != nil {
+		srv := s.newHTTPServer(redirectToHTTPS(l.Addr().String()))
+		servers = append(servers, srv)
+		s.logger.Info("redirecting to HTTPS", "addr", redirect.Addr().String())
+		go func() { errs <- srv.Serve(redirect) }()
+	}
+	if metrics != nil {
+		mux := http.NewServeMux()
+		mux.HandleFunc("/metrics", s.metricsHandler)
+		srv := s.newHTTPServer(mux)
+		servers = append(servers, srv)
+		s.logger.Info("serving metrics", "addr", metrics.Addr().String())
+		go func() { errs <- srv.Serve(metrics) }()
+	}
+
+	var workers sync.WaitGroup
+	stop := make(chan struct{})
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		s.expirePendingBookingsPeriodically(pendingExpiryInterval, stop)
+	}()
+
+	var err error
+	select {
+	case <-ctx.Done():
+		s.logger.Info("shutting down")
+	case err = <-errs:
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	for _, srv := range servers {
+		if shutdownErr := srv.Shutdown(shutdownCtx); shutdownErr != nil {
+			s.logger.Warn("requests dropped on shutdown", "error", shutdownErr)
+			srv.Close()
+		}
+	}
+	// workers are stopped only after the last request, which may need them
+	close(stop)
+	workers.Wait()
+
+	if err == http.ErrServerClosed {
+		err = nil
+	}
+	return err
+}
+
+// redirectToHTTPS sends requests to the same path on the host of the
+// request and the port of the HTTPS listener
+func redirectToHTTPS(httpsAddr string) http.Handler {
+	_, port, _ := net.SplitHostPort(httpsAddr)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		if port != "" && port != "443" {
+			host += ":" + port
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+	})
+}
@@ -0,0 +1,212 @@
+package http
+
+import (
+	"booker/models"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func (s *server) settingsData(r *http.Request) (map[string]interface{}, error) {
+	requireTotp, err := models.GetBoolSetting(r.Context(), s.db, models.SettingRequireStaffTotp, false)
+	if err != nil {
+		return nil, err
+	}
+	policy, err := models.GetCancellationPolicy(r.Context(), s.db)
+	if err != nil {
+		return nil, err
+	}
+
+	noShowLimit, err := models.GetSetting(r.Context(), s.db, models.SettingNoShowLimit, "0")
+	if err != nil {
+		return nil, err
+	}
+	noShowAction, err := models.GetSetting(r.Context(), s.db, models.SettingNoShowAction, models.NoShowBlock)
+	if err != nil {
+		return nil, err
+	}
+	holdHours, err := models.GetSetting(r.Context(), s.db, models.SettingApprovalHoldHours, strconv.Itoa(defaultApprovalHoldHours))
+	if err != nil {
+		return nil, err
+	}
+
+	timezone, err := models.GetSetting(r.Context(), s.db, models.SettingTimezone, s.config.Timezone)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"requireStaffTotp": requireTotp,
+		"policy":           policy,
+		"noShowLimit":      noShowLimit,
+		"noShowAction":     noShowAction,
+		"holdHours":        holdHours,
+		"timezone":         timezone,
+	}, nil
+}
+
+func (s *server) settingsView(w http.ResponseWriter, r *http.Request) error {
+	data, err := s.settingsData(r)
+	if err != nil {
+		return err
+	}
+	renderTemplate(w, r, "settings.html", data)
+	return nil
+}
+
+func (s *server) settingsHandler(w http.ResponseWriter, r *http.Request) error {
+	user := getUser(r)
+	if err := r.ParseForm(); err != nil {
+		return statusError(http.StatusBadRequest)
+	}
+
+	checkbox := func(key string) string {
+		return strconv.FormatBool(r.Form.Get(key) != "")
+	}
+	values := map[string]string{
+		models.SettingRequireStaffTotp:     checkbox(models.SettingRequireStaffTotp),
+		models.SettingAllowLateCancel:      checkbox(models.SettingAllowLateCancel),
+		models.SettingRequireCancelReason:  checkbox(models.SettingRequireCancelReason),
+		models.SettingCancelMinNoticeHours: strings.TrimSpace(r.Form.Get(models.SettingCancelMinNoticeHours)),
+		models.SettingNoShowLimit:          strings.TrimSpace(r.Form.Get(models.SettingNoShowLimit)),
+		models.SettingNoShowAction:         r.Form.Get(models.SettingNoShowAction),
+		models.SettingApprovalHoldHours:    strings.TrimSpace(r.Form.Get(models.SettingApprovalHoldHours)),
+		models.SettingTimezone:             strings.TrimSpace(r.Form.Get(models.SettingTimezone)),
+	}
+	if values[models.SettingTimezone] == "" {
+		values[models.SettingTimezone] = s.config.Timezone
+	}
+	if values[models.SettingApprovalHoldHours] == "" {
+		values[models.SettingApprovalHoldHours] = strconv.Itoa(defaultApprovalHoldHours)
+	}
+	if values[models.SettingNoShowAction] == "" {
+		values[models.SettingNoShowAction] = models.NoShowBlock
+	}
+	numbers := map[string]string{
+		models.SettingCancelMinNoticeHours: "minimum notice has to be a non-negative number of hours",
+		models.SettingNoShowLimit:          "limit of missed visits has to be a non-negative number",
+		models.SettingApprovalHoldHours:    "approval time has to be a non-negative number of hours",
+	}
+	fields := fieldErrors{}
+	for key, msg := range numbers {
+		if values[key] == "" {
+			values[key] = "0"
+		}
+		if n, err := strconv.Atoi(values[key]); err != nil || n < 0 {
+			fields.add(key, msg)
+		}
+	}
+	if action := values[models.SettingNoShowAction]; action != models.NoShowBlock && action != models.NoShowApproval {
+		fields.add(models.SettingNoShowAction, "invalid action for missed visits")
+	}
+	if !isValidTimezone(values[models.SettingTimezone]) {
+		fields.add(models.SettingTimezone, "unknown time zone")
+	}
+	if len(fields) > 0 {
+		data, err := s.settingsData(r)
+		if err != nil {
+			return err
+		}
+		return formError("settings.html", data, fields)
+	}
+
+	before := make(map[string]string)
+	after := make(map[string]string)
+	for key, value := range values {
+		old, err := models.GetSetting(r.Context(), s.db, key, "")
+		if err != nil {
+			return err
+		}
+		if old == value {
+			continue
+		}
+		if err := models.SetSetting(r.Context(), s.db, key, value); err != nil {
+			return err
+		}
+		before[key] = old
+		after[key] = value
+	}
+	if _, ok := after[models.SettingTimezone]; ok {
+		s.location.forget()
+	}
+
+	if len(after) > 0 {
+		s.auditEntry(r, &models.AuditEntry{
+			ActorId:      user.Id,
+			Action:       models.AuditEditSettings,
+			Target:       "settings",
+			TargetUserId: -1,
+			TargetDateId: -1,
+			Before:       auditValue(before),
+			After:        auditValue(after),
+		})
+	}
+
+	http.Redirect(w, r, "/settings/", http.StatusFound)
+	return nil
+}
+
+func (s *server) fieldsData(r *http.Request) (map[string]interface{}, error) {
+	fields, err := models.GetBookingFields(r.Context(), s.db)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"fields":        fields,
+		"profileFields": models.ProfileFields,
+	}, nil
+}
+
+func (s *server) fieldsView(w http.ResponseWriter, r *http.Request) error {
+	data, err := s.fieldsData(r)
+	if err != nil {
+		return err
+	}
+	renderTemplate(w, r, "fields.html", data)
+	return nil
+}
+
+func (s *server) createFieldHandler(w http.ResponseWriter, r *http.Request) error {
+	user := getUser(r)
+
+	r.ParseForm()
+	label := strings.TrimSpace(r.Form.Get("label"))
+	profileField := r.Form.Get("profile-field")
+	if !models.IsValidProfileField(profileField) {
+		return statusError(http.StatusBadRequest)
+	} else if label == "" {
+		data, err := s.fieldsData(r)
+		if err != nil {
+			return err
+		}
+		return formError("fields.html", data, fieldErrors{"label": "label can't be empty"})
+	}
+
+	err := models.CreateBookingField(r.Context(), s.db, label, r.Form.Get("required") != "", profileField)
+	if err != nil {
+		return err
+	}
+	s.audit(r, user.Id, models.AuditEditSettings, -1, "booking field: "+label)
+
+	http.Redirect(w, r, "/fields/", http.StatusFound)
+	return nil
+}
+
+func (s *server) deleteFieldHandler(w http.ResponseWriter, r *http.Request) error {
+	user := getUser(r)
+
+	fieldId, err := strconv.Atoi(chi.URLParam(r, "fieldId"))
+	if err != nil {
+		return statusError(http.StatusBadRequest)
+	}
+
+	if err = models.DeleteBookingField(r.Context(), s.db, fieldId); err != nil {
+		return err
+	}
+	s.audit(r, user.Id, models.AuditEditSettings, -1, "deleted booking field "+strconv.Itoa(fieldId))
+
+	http.Redirect(w, r, "/fields/", http.StatusFound)
+	return nil
+}
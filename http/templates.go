@@ -0,0 +1,229 @@
+package http
+
+import (
+	"booker/config"
+	"booker/i18n"
+	"booker/web"
+	"bytes"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"log"
+	"net/http"
+	"path"
+	"sync"
+	"text/template/parse"
+	"time"
+)
+
+const layoutTemplate = "layout.html"
+
+// templateFuncs is the function map shared by all templates. Functions
+// depending on the request are only placeholders here, renderTemplate
+// replaces them with ones bound to the request.
+var templateFuncs = template.FuncMap{
+	"csrfField": func() template.HTML { return "" },
+	"features":  func() config.Features { return config.Features{} },
+	"t":         func(message string, args ...interface{}) string { return message },
+	"tn": func(singular string, plural string, n int, args ...interface{}) string {
+		return plural
+	},
+	"datetime": func(t time.Time) string { return "" },
+	"fulldate": func(t time.Time) string { return "" },
+	"clock":    i18n.FormatClock,
+	"weekday":  func(day time.Weekday) string { return day.String() },
+	// the problem with the input of the form and what was sent in it
+	"fieldError": func(name string) template.HTML { return "" },
+	"formValue":  func(name string) string { return "" },
+}
+
+func requestFuncs(r *http.Request) template.FuncMap {
+	lang := getLanguage(r)
+	loc := getLocation(r)
+	return template.FuncMap{
+		"csrfField": func() template.HTML { return csrfField(r) },
+		"features":  func() config.Features { return getFeatures(r) },
+		"t": func(message string, args ...interface{}) string {
+			return i18n.Translate(lang, message, args...)
+		},
+		"tn": func(singular string, plural string, n int, args ...interface{}) string {
+			return i18n.TranslatePlural(lang, n, singular, plural, args...)
+		},
+		"datetime": func(t time.Time) string { return i18n.FormatDateTime(lang, t.In(loc)) },
+		"fulldate": func(t time.Time) string { return i18n.FormatFull(lang, t.In(loc)) },
+		"clock":    func(t time.Time) string { return i18n.FormatClock(t.In(loc)) },
+		"weekday":  func(day time.Weekday) string { return i18n.Weekday(lang, day) },
+		"fieldError": func(name string) template.HTML {
+			return fieldError(r, name)
+		},
+		"formValue": func(name string) string { return r.PostFormValue(name) },
+	}
+}
+
+// templateSet keeps every page parsed together with the layout. Parsed
+// templates are never executed themselves, only their clones, so that
+// they can still get the functions of each request.
+type templateSet struct {
+	files  fs.FS
+	reload bool
+
+	mu    sync.RWMutex
+	pages map[string]*template.Template
+}
+
+// parseTemplates parses all pages and checks that every template they
+// refer to is defined
+func parseTemplates(files fs.FS) (map[string]*template.Template, error) {
+	names, err := fs.Glob(files, "*.html")
+	if err != nil {
+		return nil, err
+	}
+	pages := make(map[string]*template.Template)
+	for _, name := range names {
+		if name == layoutTemplate {
+			continue
+		}
+		t, err := template.New(layoutTemplate).Funcs(templateFuncs).ParseFS(files, layoutTemplate, name)
+		if err != nil {
+			return nil, err
+		}
+		if err = checkReferences(t); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		pages[name] = t
+	}
+	return pages, nil
+}
+
+func checkReferences(t *template.Template) error {
+	for _, defined := range t.Templates() {
+		if defined.Tree == nil {
+			continue
+		}
+		var missing error
+		var walk func(node parse.Node)
+		walk = func(node parse.Node) {
+			switch n := node.(type) {
+			case *parse.TemplateNode:
+				if t.Lookup(n.Name) == nil && missing == nil {
+					missing = fmt.Errorf("template %q used in %q is not defined", n.Name, defined.Name())
+				}
+			case *parse.ListNode:
+				if n != nil {
+					for _, child := range n.Nodes {
+						walk(child)
+					}
+				}
+			case *parse.IfNode:
+				walk(n.List)
+				walk(n.ElseList)
+			case *parse.RangeNode:
+				walk(n.List)
+				walk(n.ElseList)
+			case *parse.WithNode:
+				walk(n.List)
+				walk(n.ElseList)
+			}
+		}
+		walk(defined.Tree.Root)
+		if missing != nil {
+			return missing
+		}
+	}
+	return nil
+}
+
+func newTemplateSet(files fs.FS, reload bool) (*templateSet, error) {
+	pages, err := parseTemplates(files)
+	if err != nil {
+		return nil, err
+	}
+	return &templateSet{files: files, reload: reload, pages: pages}, nil
+}
+
+// lookup returns a copy of the page ready to be executed, in the reload
+// mode all templates are parsed again first to show their latest version
+func (ts *templateSet) lookup(name string) (*template.Template, error) {
+	if ts.reload {
+		pages, err := parseTemplates(ts.files)
+		if err != nil {
+			return nil, err
+		}
+		ts.mu.Lock()
+		ts.pages = pages
+		ts.mu.Unlock()
+	}
+	ts.mu.RLock()
+	t, ok := ts.pages[name]
+	ts.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("template %s not found", name)
+	}
+	return t.Clone()
+}
+
+// templates and static files, embedded in the binary unless UseWebDir
+// points somewhere else
+var (
+	templates   *templateSet
+	staticFiles fs.FS
+)
+
+// the embedded templates are checked when the program starts
+func init() {
+	if err := UseWebDir("", false); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// UseWebDir makes the server read templates and static files from the
+// directory, which has to be laid out like web/ in the repository. With
+// reload templates are parsed again on every request, which is meant for
+// development. It has to be called before NewServer.
+func UseWebDir(dir string, reload bool) error {
+	templateFiles, static, err := web.FS(dir)
+	if err != nil {
+		return err
+	}
+	ts, err := newTemplateSet(templateFiles, reload)
+	if err != nil {
+		return err
+	}
+	templates, staticFiles = ts, static
+	return nil
+}
+
+// renderTemplate renders the page into a buffer first, so that a failure
+// results in an error page instead of a half-rendered one
+func renderTemplate(w http.ResponseWriter, r *http.Request, filename string, data interface{}) {
+	if path.Base(filename) == "error.html" && wantsJSON(r) {
+		writeJSONError(w, r)
+		return
+	}
+
+	var buf bytes.Buffer
+	t, err := templates.lookup(filename)
+	if err == nil {
+		err = t.Funcs(requestFuncs(r)).Execute(&buf, templateContext{
+			Lang:  getLanguage(r),
+			User:  getUser(r),
+			Error: readErrorMessage(r),
+			Data:  data,
+		})
+	}
+	if err != nil {
+		logError(r, err)
+		if path.Base(filename) != "error.html" {
+			setError(r, http.StatusInternalServerError, errorMessageFromStatus(r, http.StatusInternalServerError))
+			renderTemplate(w, r, "error.html", nil)
+		} else {
+			http.Error(w, errorMessageFromStatus(r, http.StatusInternalServerError),
+				http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(readStatus(r))
+	buf.WriteTo(w)
+}
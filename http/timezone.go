@@ -0,0 +1,89 @@
+package http
+
+import (
+	"booker/logging"
+	"booker/models"
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Times are stored in UTC. Forms are read and times are shown in the zone
+// chosen by the user or, if they haven't chosen one, in the zone of the
+// business, which is also used for working hours and notifications.
+
+const visitLayout = "2006-01-02 15:04"
+
+// locationCache keeps the zone of the business, which is needed on every
+// request, until the settings change it
+type locationCache struct {
+	mu  sync.Mutex
+	loc *time.Location
+}
+
+// forget makes the zone be read again from the settings
+func (c *locationCache) forget() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.loc = nil
+}
+
+// businessLocation returns the zone of the business,
+// the zone of the server if it can't be read
+func (s *server) businessLocation(ctx context.Context) *time.Location {
+	s.location.mu.Lock()
+	defer s.location.mu.Unlock()
+	if s.location.loc != nil {
+		return s.location.loc
+	}
+
+	loc, err := models.GetLocation(ctx, s.db, s.config.Timezone)
+	if err != nil {
+		logging.FromContext(ctx).Error("time zone of the business not read", "error", err)
+		return time.Local
+	}
+	s.location.loc = loc
+	return loc
+}
+
+// readLocation stores the zone in which the user sees times in the context,
+// the zone of the user is the one of the user read by readUser
+func (s *server) readLocation(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		loc := s.businessLocation(r.Context())
+		if user := getUser(r); user != nil && user.Timezone != "" {
+			if userLoc, err := time.LoadLocation(user.Timezone); err != nil {
+				logError(r, err)
+			} else {
+				loc = userLoc
+			}
+		}
+		ctx := context.WithValue(r.Context(), locationKey, loc)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func getLocation(r *http.Request) *time.Location {
+	if loc, ok := r.Context().Value(locationKey).(*time.Location); ok {
+		return loc
+	}
+	return time.Local
+}
+
+// parseFormTime parses the value of a date or datetime-local input,
+// which carries no zone, in the zone of the user
+func parseFormTime(r *http.Request, layout string, value string) (time.Time, error) {
+	return time.ParseInLocation(layout, value, getLocation(r))
+}
+
+func isValidTimezone(name string) bool {
+	_, err := time.LoadLocation(name)
+	return name != "" && err == nil
+}
+
+// formatVisit formats the start of the date in the zone of the business,
+// it's used in messages stored for later, like notifications
+func (s *server) formatVisit(ctx context.Context, d *models.Date) string {
+	return d.StartTime.In(s.businessLocation(ctx)).Format(visitLayout)
+}
@@ -0,0 +1,404 @@
+package http
+
+import (
+	"booker/models"
+	"booker/totp"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	totpIssuer          = "Booker"
+	recoveryCodesCount  = 10
+	pendingLoginTimeout = 5 * time.Minute
+	trustedDeviceTTL    = 30 * 24 * time.Hour
+
+	invalidCodeMessage = "invalid authentication code"
+)
+
+func (s *server) isTrustedDevice(r *http.Request, u *models.User) bool {
+	c, err := r.Cookie("trusted_device")
+	if err != nil {
+		return false
+	}
+	trusted, err := models.IsTrustedDevice(r.Context(), s.db, c.Value, u.Id)
+	if err != nil {
+		logError(r, err)
+		return false
+	}
+	return trusted
+}
+
+// startSecondFactor remembers that the password was correct
+// and asks the user for the one-time code
+func (s *server) startSecondFactor(w http.ResponseWriter, r *http.Request, u *models.User) error {
+	token := uuid.NewString()
+	expiresAt := time.Now().Add(pendingLoginTimeout)
+
+	if err := models.CreatePendingLogin(r.Context(), s.db, token, u.Id, expiresAt); err != nil {
+		return err
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     "pending_login",
+		Value:    token,
+		Expires:  expiresAt,
+		Path:     "/login/",
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	http.Redirect(w, r, "/login/totp/", http.StatusSeeOther)
+	return nil
+}
+
+func (s *server) getPendingLogin(r *http.Request) *models.PendingLogin {
+	c, err := r.Cookie("pending_login")
+	if err != nil {
+		return nil
+	}
+	p, err := models.GetPendingLoginByToken(r.Context(), s.db, c.Value)
+	if err != nil {
+		if err != models.ErrNotFound {
+			logError(r, err)
+		}
+		return nil
+	}
+	if p.IsExpired() {
+		return nil
+	}
+	return p
+}
+
+func (s *server) loginTotpView(w http.ResponseWriter, r *http.Request) {
+	if s.getPendingLogin(r) == nil {
+		http.Redirect(w, r, "/login/", http.StatusFound)
+		return
+	}
+	renderTemplate(w, r, "login_totp.html", nil)
+}
+
+// loginTotpError shows the error above the form for the code
+func loginTotpError(status int, message string) error {
+	e := newError(status, message)
+	e.template = "login_totp.html"
+	return e
+}
+
+func (s *server) loginTotpHandler(w http.ResponseWriter, r *http.Request) error {
+	p := s.getPendingLogin(r)
+	if p == nil {
+		http.Redirect(w, r, "/login/", http.StatusFound)
+		return nil
+	}
+
+	r.ParseForm()
+	if r.Form.Get("code") == "" {
+		return formError("login_totp.html", nil, fieldErrors{"code": "code can't be empty"})
+	}
+
+	u, err := models.GetUserById(r.Context(), s.db, p.UserId)
+	if err != nil {
+		return err
+	}
+
+	if u.Disabled {
+		return statusError(http.StatusForbidden)
+	} else if s.userLimiter.retryAfter(u.Username) > 0 || u.IsLocked() {
+		s.audit(r, u.Id, models.AuditLoginFailed, u.Id, "")
+		return loginTotpError(http.StatusTooManyRequests, tooManyAttemptsMessage)
+	}
+
+	ok, err := s.verifySecondFactor(r.Context(), u, r.Form.Get("code"))
+	if err != nil {
+		return err
+	} else if !ok {
+		s.loginFailed(r, u, u.Username)
+		return loginTotpError(http.StatusBadRequest, invalidCodeMessage)
+	}
+
+	s.userLimiter.reset(u.Username)
+	if err = models.DeletePendingLogin(r.Context(), s.db, p.Token); err != nil {
+		logError(r, err)
+	}
+
+	if r.Form.Get("remember") != "" {
+		token := uuid.NewString()
+		expiresAt := time.Now().Add(trustedDeviceTTL)
+		if err = models.CreateTrustedDevice(r.Context(), s.db, token, u.Id, expiresAt); err != nil {
+			logError(r, err)
+		} else {
+			http.SetCookie(w, &http.Cookie{
+				Name:     "trusted_device",
+				Value:    token,
+				Expires:  expiresAt,
+				Path:     "/login/",
+				HttpOnly: true,
+				Secure:   r.TLS != nil,
+				SameSite: http.SameSiteLaxMode,
+			})
+		}
+	}
+
+	return s.startSession(w, r, u)
+}
+
+// verifySecondFactor accepts either the current one-time code
+// or one of the unused recovery codes
+func (s *server) verifySecondFactor(ctx context.Context, u *models.User, code string) (bool, error) {
+	if counter, ok := totp.Validate(u.TotpSecret, code, time.Now()); u.TotpSecret != "" && ok {
+		return models.UseTotpCounter(ctx, s.db, u.Id, counter)
+	}
+	return models.UseRecoveryCode(ctx, s.db, u.Id, hashRecoveryCode(code))
+}
+
+// verifyTotp accepts only the current one-time code, each code once
+func (s *server) verifyTotp(ctx context.Context, u *models.User, code string) (bool, error) {
+	counter, ok := totp.Validate(u.TotpSecret, code, time.Now())
+	if !ok {
+		return false, nil
+	}
+	return models.UseTotpCounter(ctx, s.db, u.Id, counter)
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+func hashRecoveryCode(code string) string {
+	sum := sha256.Sum256([]byte(normalizeRecoveryCode(code)))
+	return hex.EncodeToString(sum[:])
+}
+
+// newRecoveryCodes generates and stores a fresh set of recovery codes,
+// returning them in plain text so that they can be shown once
+func (s *server) newRecoveryCodes(ctx context.Context, userId int) ([]string, error) {
+	codes := make([]string, recoveryCodesCount)
+	hashes := make([]string, recoveryCodesCount)
+	for i := range codes {
+		b := make([]byte, 5)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		code := strings.ToLower(base32.StdEncoding.EncodeToString(b))
+		codes[i] = code[:4] + "-" + code[4:]
+		hashes[i] = hashRecoveryCode(code)
+	}
+	if err := models.SetRecoveryCodes(ctx, s.db, userId, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func (s *server) isTotpRequired(ctx context.Context, u *models.User) (bool, error) {
+	if !u.IsStaff() {
+		return false, nil
+	}
+	return models.GetBoolSetting(ctx, s.db, models.SettingRequireStaffTotp, false)
+}
+
+// middleware redirecting staff to the enrolment page
+// when two-factor authentication is required for them
+func (s *server) enforceTwoFactor(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := getUser(r)
+		if user != nil && !user.TotpEnabled &&
+			!strings.HasPrefix(r.URL.Path, "/2fa/") &&
+			!strings.HasPrefix(r.URL.Path, "/static/") &&
+			r.URL.Path != "/logout/" {
+			required, err := s.isTotpRequired(r.Context(), user)
+			if err != nil {
+				logError(r, err)
+			} else if required {
+				http.Redirect(w, r, "/2fa/", http.StatusFound)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *server) twoFactorData(r *http.Request, user *models.User, recoveryCodes []string) (map[string]interface{}, error) {
+	required, err := s.isTotpRequired(r.Context(), user)
+	if err != nil {
+		return nil, err
+	}
+	remaining, err := models.CountRecoveryCodes(r.Context(), s.db, user.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	data := map[string]interface{}{
+		"enabled":       user.TotpEnabled,
+		"required":      required,
+		"remaining":     remaining,
+		"recoveryCodes": recoveryCodes,
+	}
+	if !user.TotpEnabled && user.TotpSecret != "" {
+		data["secret"] = user.TotpSecret
+		// otpauth:// is not considered safe by html/template
+		data["uri"] = template.URL(totp.ProvisioningURI(totpIssuer, user.Username, user.TotpSecret))
+	}
+	return data, nil
+}
+
+func (s *server) renderTwoFactor(w http.ResponseWriter, r *http.Request, user *models.User, recoveryCodes []string) error {
+	data, err := s.twoFactorData(r, user, recoveryCodes)
+	if err != nil {
+		return err
+	}
+	renderTemplate(w, r, "two_factor.html", data)
+	return nil
+}
+
+// twoFactorError shows the error above the forms of the page
+func (s *server) twoFactorError(r *http.Request, user *models.User, e *appError) error {
+	data, err := s.twoFactorData(r, user, nil)
+	if err != nil {
+		return err
+	}
+	e.template, e.data = "two_factor.html", data
+	return e
+}
+
+func (s *server) twoFactorView(w http.ResponseWriter, r *http.Request) error {
+	user := getUser(r)
+	if user == nil {
+		return statusError(http.StatusForbidden)
+	}
+	return s.renderTwoFactor(w, r, user, nil)
+}
+
+func (s *server) twoFactorSetupHandler(w http.ResponseWriter, r *http.Request) error {
+	user := getUser(r)
+	if user == nil {
+		return statusError(http.StatusForbidden)
+	} else if user.TotpEnabled {
+		return statusError(http.StatusBadRequest)
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err == nil {
+		err = models.SetUserTotp(r.Context(), s.db, user.Id, secret, false)
+	}
+	if err != nil {
+		return err
+	}
+
+	http.Redirect(w, r, "/2fa/", http.StatusFound)
+	return nil
+}
+
+// twoFactorCode reads the code sent with one of the forms of the page,
+// its problems are shown next to the form named by the field
+func (s *server) twoFactorCode(r *http.Request, user *models.User, field string) (string, error) {
+	r.ParseForm()
+	code := r.Form.Get("code")
+	if code == "" {
+		return "", s.twoFactorError(r, user, formError("", nil, fieldErrors{field: "code can't be empty"}))
+	}
+	return code, nil
+}
+
+func (s *server) twoFactorEnableHandler(w http.ResponseWriter, r *http.Request) error {
+	user := getUser(r)
+	if user == nil {
+		return statusError(http.StatusForbidden)
+	} else if user.TotpEnabled || user.TotpSecret == "" {
+		return statusError(http.StatusBadRequest)
+	}
+	code, err := s.twoFactorCode(r, user, "enable")
+	if err != nil {
+		return err
+	}
+
+	if ok, err := s.verifyTotp(r.Context(), user, code); err != nil {
+		return err
+	} else if !ok {
+		return s.twoFactorError(r, user, newError(http.StatusBadRequest, invalidCodeMessage))
+	}
+
+	if err := models.SetUserTotp(r.Context(), s.db, user.Id, user.TotpSecret, true); err != nil {
+		return err
+	}
+	codes, err := s.newRecoveryCodes(r.Context(), user.Id)
+	if err != nil {
+		return err
+	}
+	s.audit(r, user.Id, models.AuditEnableTotp, user.Id, "")
+
+	user.TotpEnabled = true
+	return s.renderTwoFactor(w, r, user, codes)
+}
+
+func (s *server) twoFactorRecoveryCodesHandler(w http.ResponseWriter, r *http.Request) error {
+	user := getUser(r)
+	if user == nil {
+		return statusError(http.StatusForbidden)
+	} else if !user.TotpEnabled {
+		return statusError(http.StatusBadRequest)
+	}
+	code, err := s.twoFactorCode(r, user, "recovery-codes")
+	if err != nil {
+		return err
+	}
+
+	if ok, err := s.verifyTotp(r.Context(), user, code); err != nil {
+		return err
+	} else if !ok {
+		return s.twoFactorError(r, user, newError(http.StatusBadRequest, invalidCodeMessage))
+	}
+
+	codes, err := s.newRecoveryCodes(r.Context(), user.Id)
+	if err != nil {
+		return err
+	}
+	return s.renderTwoFactor(w, r, user, codes)
+}
+
+func (s *server) twoFactorDisableHandler(w http.ResponseWriter, r *http.Request) error {
+	user := getUser(r)
+	if user == nil {
+		return statusError(http.StatusForbidden)
+	} else if !user.TotpEnabled {
+		return statusError(http.StatusBadRequest)
+	}
+	code, err := s.twoFactorCode(r, user, "disable")
+	if err != nil {
+		return err
+	}
+
+	required, err := s.isTotpRequired(r.Context(), user)
+	if err != nil {
+		return err
+	} else if required {
+		return s.twoFactorError(r, user, newError(http.StatusForbidden,
+			"two-factor authentication is required for your account"))
+	}
+
+	ok, err := s.verifySecondFactor(r.Context(), user, code)
+	if err != nil {
+		return err
+	} else if !ok {
+		return s.twoFactorError(r, user, newError(http.StatusBadRequest, invalidCodeMessage))
+	}
+
+	if err = models.DisableUserTotp(r.Context(), s.db, user.Id); err != nil {
+		return err
+	}
+	s.audit(r, user.Id, models.AuditDisableTotp, user.Id, "")
+
+	http.Redirect(w, r, "/2fa/", http.StatusFound)
+	return nil
+}
@@ -0,0 +1,504 @@
+package http
+
+import (
+	"booker/models"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func (s *server) lockedUsersView(w http.ResponseWriter, r *http.Request) error {
+	users, err := models.GetLockedUsers(r.Context(), s.db)
+	if err != nil {
+		return err
+	}
+
+	renderTemplate(w, r, "locked_users.html", users)
+	return nil
+}
+
+func (s *server) unlockUserHandler(w http.ResponseWriter, r *http.Request) error {
+	user := getUser(r)
+
+	u, err := s.userFromURL(r)
+	if err != nil {
+		return err
+	}
+
+	if err = models.UnlockUser(r.Context(), s.db, u.Id); err != nil {
+		return err
+	}
+	s.userLimiter.reset(u.Username)
+	s.audit(r, user.Id, models.AuditUnlockUser, u.Id, "")
+
+	http.Redirect(w, r, "/users/locked/", http.StatusFound)
+	return nil
+}
+
+func (s *server) rolesData(r *http.Request) (map[string]interface{}, error) {
+	roles, err := models.GetRoles(r.Context(), s.db)
+	if err != nil {
+		return nil, err
+	}
+	users, err := models.GetUsers(r.Context(), s.db)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"roles":       roles,
+		"users":       users,
+		"permissions": models.Permissions,
+	}, nil
+}
+
+func (s *server) rolesView(w http.ResponseWriter, r *http.Request) error {
+	data, err := s.rolesData(r)
+	if err != nil {
+		return err
+	}
+	renderTemplate(w, r, "roles.html", data)
+	return nil
+}
+
+// rolesError shows the error above the forms of the roles
+func (s *server) rolesError(r *http.Request, e *appError) error {
+	data, err := s.rolesData(r)
+	if err != nil {
+		return err
+	}
+	e.template, e.data = "roles.html", data
+	return e
+}
+
+// readPermissions returns the permissions checked in the form
+func readPermissions(r *http.Request) ([]string, bool) {
+	perms := r.Form["permission"]
+	for _, p := range perms {
+		if !models.IsValidPermission(p) {
+			return nil, false
+		}
+	}
+	return perms, true
+}
+
+// permissions are shared only by those who have them, so that nobody
+// can give themselves or others more than they have
+const (
+	grantForbiddenMessage  = "you can't grant permissions you don't have yourself"
+	adminForbiddenMessage  = "only administrators can assign the admin role"
+	manageForbiddenMessage = "you can't manage users with permissions you don't have yourself"
+)
+
+// assignForbidden returns why the user can't assign the role,
+// or an empty string if they can
+func assignForbidden(user *models.User, role *models.Role) string {
+	if role.Id == models.RoleAdmin && user.RoleId != models.RoleAdmin {
+		return adminForbiddenMessage
+	} else if !user.CanAssign(role) {
+		return grantForbiddenMessage
+	}
+	return ""
+}
+
+func permissionSet(perms []string) map[string]bool {
+	set := make(map[string]bool, len(perms))
+	for _, p := range perms {
+		set[p] = true
+	}
+	return set
+}
+
+func (s *server) createRoleHandler(w http.ResponseWriter, r *http.Request) error {
+	user := getUser(r)
+
+	r.ParseForm()
+	name := strings.TrimSpace(r.Form.Get("name"))
+	perms, ok := readPermissions(r)
+	if !ok {
+		return statusError(http.StatusBadRequest)
+	} else if name == "" {
+		return s.rolesError(r, formError("", nil, fieldErrors{"name": "name can't be empty"}))
+	} else if !user.CanGrant(permissionSet(perms)) {
+		return s.rolesError(r, newError(http.StatusForbidden, grantForbiddenMessage))
+	}
+
+	_, err := models.CreateRole(r.Context(), s.db, name, perms)
+	if errors.Is(err, models.ErrConflict) {
+		e := formError("", nil, fieldErrors{"name": "a role with this name already exists"})
+		e.status = http.StatusConflict
+		return s.rolesError(r, e)
+	} else if err != nil {
+		return err
+	}
+	s.audit(r, user.Id, models.AuditEditRole, -1, name)
+
+	http.Redirect(w, r, "/roles/", http.StatusFound)
+	return nil
+}
+
+func (s *server) updateRoleHandler(w http.ResponseWriter, r *http.Request) error {
+	user := getUser(r)
+
+	roleId, err := strconv.Atoi(chi.URLParam(r, "roleId"))
+	if err != nil || r.ParseForm() != nil {
+		return statusError(http.StatusBadRequest)
+	}
+	role, err := models.GetRoleById(r.Context(), s.db, roleId)
+	if err != nil {
+		return err
+	} else if role.Id == models.RoleAdmin {
+		// nobody should be able to lock everyone out
+		return statusError(http.StatusForbidden)
+	}
+
+	perms, ok := readPermissions(r)
+	if !ok {
+		return statusError(http.StatusBadRequest)
+	} else if !user.CanAssign(role) || !user.CanGrant(permissionSet(perms)) {
+		return s.rolesError(r, newError(http.StatusForbidden, grantForbiddenMessage))
+	}
+
+	if err = models.SetRolePermissions(r.Context(), s.db, role.Id, perms); err != nil {
+		return err
+	}
+	s.audit(r, user.Id, models.AuditEditRole, -1, role.Name)
+
+	http.Redirect(w, r, "/roles/", http.StatusFound)
+	return nil
+}
+
+func (s *server) assignRoleHandler(w http.ResponseWriter, r *http.Request) error {
+	user := getUser(r)
+
+	r.ParseForm()
+	userId, err := strconv.Atoi(r.Form.Get("user"))
+	if err != nil {
+		return statusError(http.StatusBadRequest)
+	}
+	roleId, err := strconv.Atoi(r.Form.Get("role"))
+	if err != nil {
+		return statusError(http.StatusBadRequest)
+	}
+
+	u, err := models.GetUserById(r.Context(), s.db, userId)
+	if err == models.ErrNotFound {
+		return statusError(http.StatusBadRequest)
+	} else if err != nil {
+		return err
+	}
+	role, err := models.GetRoleById(r.Context(), s.db, roleId)
+	if err == models.ErrNotFound {
+		return statusError(http.StatusBadRequest)
+	} else if err != nil {
+		return err
+	}
+
+	message := assignForbidden(user, role)
+	if u.Id == user.Id {
+		message = "you can't change your own role or disable your own account"
+	} else if !user.CanManage(u) {
+		message = manageForbiddenMessage
+	}
+	if message != "" {
+		return s.rolesError(r, newError(http.StatusForbidden, message))
+	}
+
+	if err = models.SetUserRole(r.Context(), s.db, u.Id, role.Id); err != nil {
+		return err
+	}
+	s.audit(r, user.Id, models.AuditAssignRole, u.Id, role.Name)
+
+	http.Redirect(w, r, "/roles/", http.StatusFound)
+	return nil
+}
+
+func (s *server) usersView(w http.ResponseWriter, r *http.Request) error {
+	query := r.URL.Query().Get("q")
+	users, err := models.SearchUsers(r.Context(), s.db, query)
+	if err != nil {
+		return err
+	}
+
+	renderTemplate(w, r, "users.html", map[string]interface{}{
+		"query": query,
+		"users": users,
+	})
+	return nil
+}
+
+// userFromURL reads the user given by the userId URL parameter
+func (s *server) userFromURL(r *http.Request) (*models.User, error) {
+	userId, err := strconv.Atoi(chi.URLParam(r, "userId"))
+	if err != nil {
+		return nil, statusError(http.StatusBadRequest)
+	}
+	return models.GetUserById(r.Context(), s.db, userId)
+}
+
+func (s *server) editUserData(r *http.Request, u *models.User) (map[string]interface{}, error) {
+	roles, err := models.GetRoles(r.Context(), s.db)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"user":  u,
+		"roles": roles,
+		"self":  u.Id == getUser(r).Id,
+	}, nil
+}
+
+func (s *server) editUserView(w http.ResponseWriter, r *http.Request) error {
+	u, err := s.userFromURL(r)
+	if err != nil {
+		return err
+	}
+	data, err := s.editUserData(r, u)
+	if err != nil {
+		return err
+	}
+	renderTemplate(w, r, "edit_user.html", data)
+	return nil
+}
+
+// editUserError shows the error above the form with the values sent in it
+func (s *server) editUserError(r *http.Request, u *models.User, e *appError) error {
+	data, err := s.editUserData(r, u)
+	if err != nil {
+		return err
+	}
+	e.template, e.data = "edit_user.html", data
+	return e
+}
+
+func (s *server) editUserHandler(w http.ResponseWriter, r *http.Request) error {
+	user := getUser(r)
+	u, err := s.userFromURL(r)
+	if err != nil {
+		return err
+	}
+
+	r.ParseForm()
+	roleId, err := strconv.Atoi(r.Form.Get("role"))
+	if err != nil {
+		return statusError(http.StatusBadRequest)
+	}
+	role, err := models.GetRoleById(r.Context(), s.db, roleId)
+	if err == models.ErrNotFound {
+		return statusError(http.StatusBadRequest)
+	} else if err != nil {
+		return err
+	}
+
+	disabled := r.Form.Get("disabled") != ""
+	if u.Id == user.Id && (roleId != u.RoleId || disabled) {
+		return s.editUserError(r, u, newError(http.StatusForbidden,
+			"you can't change your own role or disable your own account"))
+	}
+	if !user.CanManage(u) {
+		return s.editUserError(r, u, newError(http.StatusForbidden, manageForbiddenMessage))
+	}
+	if message := assignForbidden(user, role); roleId != u.RoleId && message != "" {
+		return s.editUserError(r, u, newError(http.StatusForbidden, message))
+	}
+
+	before := auditUser(u)
+	u.Name = strings.TrimSpace(r.Form.Get("name"))
+	u.Username = strings.TrimSpace(r.Form.Get("username"))
+	u.RoleId = roleId
+	wasDisabled := u.Disabled
+	u.Disabled = disabled
+	u.RequiresApproval = r.Form.Get("requires-approval") != ""
+	fields := fieldErrors{}
+	if u.Name == "" {
+		fields.add("name", "name can't be empty")
+	}
+	if u.Username == "" {
+		fields.add("username", "username can't be empty")
+	}
+	if len(fields) > 0 {
+		return s.editUserError(r, u, formError("", nil, fields))
+	}
+
+	if err = models.UpdateUser(r.Context(), s.db, u); errors.Is(err, models.ErrConflict) {
+		return s.editUserError(r, u, usernameTaken("", nil))
+	} else if err != nil {
+		return err
+	}
+	if password := r.Form.Get("password"); password != "" {
+		if err = models.SetUserPassword(r.Context(), s.db, u.Id, password); err != nil {
+			return err
+		}
+	}
+	if u.Disabled && !wasDisabled {
+		if err = models.DeleteUserSessions(r.Context(), s.db, u.Id); err != nil {
+			logError(r, err)
+		}
+	}
+	after := auditUser(u)
+	s.auditEntry(r, &models.AuditEntry{
+		ActorId:      user.Id,
+		Action:       models.AuditEditUser,
+		TargetUserId: u.Id,
+		TargetDateId: -1,
+		Before:       auditValue(before),
+		After:        auditValue(after),
+	})
+
+	http.Redirect(w, r, "/users/", http.StatusFound)
+	return nil
+}
+
+func (s *server) deleteUserData(r *http.Request, u *models.User) (map[string]interface{}, error) {
+	assigned, assignedBooked, err := models.CountFutureDatesAssignedTo(r.Context(), s.db, u.Id)
+	if err != nil {
+		return nil, err
+	}
+	booked, err := models.CountFutureDatesBookedBy(r.Context(), s.db, u.Id)
+	if err != nil {
+		return nil, err
+	}
+	emps, err := models.GetUsersWithPermission(r.Context(), s.db, models.PermOwnSlots)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"user":           u,
+		"assigned":       assigned,
+		"assignedBooked": assignedBooked,
+		"booked":         booked,
+		"emps":           emps,
+	}, nil
+}
+
+// deleteUserError shows the error above the confirmation of the deletion
+func (s *server) deleteUserError(r *http.Request, u *models.User, e *appError) error {
+	data, err := s.deleteUserData(r, u)
+	if err != nil {
+		return err
+	}
+	e.template, e.data = "delete_user.html", data
+	return e
+}
+
+func (s *server) deleteUserView(w http.ResponseWriter, r *http.Request) error {
+	u, err := s.userFromURL(r)
+	if err != nil {
+		return err
+	}
+	data, err := s.deleteUserData(r, u)
+	if err != nil {
+		return err
+	}
+	renderTemplate(w, r, "delete_user.html", data)
+	return nil
+}
+
+func (s *server) deleteUserHandler(w http.ResponseWriter, r *http.Request) error {
+	user := getUser(r)
+	u, err := s.userFromURL(r)
+	if err != nil {
+		return err
+	}
+
+	if u.Id == user.Id {
+		return s.deleteUserError(r, u, newError(http.StatusForbidden, "you can't delete your own account"))
+	} else if !user.CanManage(u) {
+		return s.deleteUserError(r, u, newError(http.StatusForbidden, manageForbiddenMessage))
+	}
+
+	r.ParseForm()
+	reassignTo := -1
+	var emp *models.User
+	switch r.Form.Get("dates") {
+	case "delete":
+	case "reassign":
+		empId, err := strconv.Atoi(r.Form.Get("reassign-to"))
+		if err != nil || empId == u.Id {
+			empId = -1
+		}
+		emp, err = models.GetUserById(r.Context(), s.db, empId)
+		if err == models.ErrNotFound || (err == nil && !emp.Can(models.PermOwnSlots)) {
+			return s.deleteUserError(r, u, formError("", nil, fieldErrors{"reassign-to": "unknown employee"}))
+		} else if err != nil {
+			return err
+		}
+		reassignTo = emp.Id
+	default:
+		return statusError(http.StatusBadRequest)
+	}
+
+	dates, err := models.GetFutureDatesAssignedTo(r.Context(), s.db, u.Id)
+	if err != nil {
+		return err
+	}
+	bookings, err := models.GetFutureDatesBookedBy(r.Context(), s.db, u.Id)
+	if err != nil {
+		return err
+	}
+	var booked []*models.Date
+	for _, d := range dates {
+		if d.BookedBy != -1 {
+			booked = append(booked, d)
+		}
+	}
+	if len(booked)+len(bookings) > 0 && r.Form.Get("confirm") != "1" {
+		renderTemplate(w, r, "delete_user_confirm.html", map[string]interface{}{
+			"user":       u,
+			"booked":     booked,
+			"bookings":   bookings,
+			"dates":      r.Form.Get("dates"),
+			"reassignTo": r.Form.Get("reassign-to"),
+			"reason":     r.Form.Get("reason"),
+			"emp":        emp,
+		})
+		return nil
+	}
+
+	reason := strings.TrimSpace(r.Form.Get("reason"))
+	dates, bookings, err = models.DeleteUser(r.Context(), s.db, u.Id, reassignTo, user.Id, reason)
+	if err == models.ErrEmployeeAbsent {
+		return s.deleteUserError(r, u, newError(http.StatusBadRequest,
+			"some of the dates would fall into an absence of the employee"))
+	} else if err == models.ErrDatesOverlap {
+		return s.deleteUserError(r, u, newError(http.StatusBadRequest,
+			"some of the dates would overlap other dates of the employee"))
+	} else if err != nil {
+		return err
+	}
+	s.userLimiter.reset(u.Username)
+
+	s.metrics.cancellations.Add(float64(len(bookings)), "user_deleted")
+	for _, d := range bookings {
+		s.notifyWithReason(r.Context(), d.AssignedTo, reason,
+			"The booking of %s by %s has been cancelled because their account was deleted.",
+			s.formatVisit(r.Context(), d), u.Name)
+	}
+	if emp != nil {
+		moved := make([]*models.Date, len(dates))
+		for i, d := range dates {
+			m := *d
+			m.AssignedTo = emp.Id
+			moved[i] = &m
+		}
+		s.notifyMovedBookings(r.Context(), dates, moved, emp, reason)
+		s.auditDates(r, models.AuditEditDate, dates, moved)
+	} else {
+		for _, d := range dates {
+			if d.BookedBy != -1 {
+				s.metrics.cancellations.Inc("date_removed")
+				s.notifyWithReason(r.Context(), d.BookedBy, reason,
+					"Your booking of %s has been cancelled because the date was removed.", s.formatVisit(r.Context(), d))
+			}
+		}
+		s.auditDates(r, models.AuditDeleteDate, dates, nil)
+	}
+	s.audit(r, user.Id, models.AuditDeleteUser, u.Id, "")
+
+	http.Redirect(w, r, "/users/", http.StatusFound)
+	return nil
+}
@@ -2,39 +2,87 @@ package http
 
 import (
 	"booker/models"
-	"log"
+	"errors"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 )
 
-func (s *server) indexView(w http.ResponseWriter, r *http.Request) {
-	dates, err := models.GetDatesWithNamesNotBooked(s.db)
+func (s *server) indexView(w http.ResponseWriter, r *http.Request) error {
+	dates, err := models.GetDatesWithNamesNotBooked(r.Context(), s.db)
 	if err != nil {
-		renderError(w, r, http.StatusInternalServerError)
-		log.Print(err)
-		return
+		return err
 	}
 	renderTemplate(w, r, "index.html", dates)
+	return nil
 }
 
-func (s *server) bookedView(w http.ResponseWriter, r *http.Request) {
-	user := getUser(r)
-	if user == nil {
-		renderError(w, r, http.StatusForbidden)
-		return
+func (s *server) bookedData(r *http.Request, user *models.User) (map[string]interface{}, error) {
+	dates, err := models.GetDatesBookedBy(r.Context(), s.db, user.Id)
+	if err != nil {
+		return nil, err
+	}
+	cancellations, err := models.GetCancellationsBookedBy(r.Context(), s.db, user.Id)
+	if err != nil {
+		return nil, err
+	}
+	policy, err := models.GetCancellationPolicy(r.Context(), s.db)
+	if err != nil {
+		return nil, err
+	}
+
+	dateIds := make([]int, len(dates))
+	for i, d := range dates {
+		dateIds[i] = d.Id
 	}
+	attendance, err := models.GetAttendance(r.Context(), s.db, dateIds)
+	if err != nil {
+		return nil, err
+	}
+	pending, err := models.GetPendingBookings(r.Context(), s.db, dateIds)
+	if err != nil {
+		return nil, err
+	}
+	notifications, err := models.GetUnreadNotifications(r.Context(), s.db, user.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"dates":         dates,
+		"attendance":    attendance,
+		"pending":       pending,
+		"notifications": notifications,
+		"cancellations": cancellations,
+		"policy":        policy,
+		"now":           time.Now(),
+	}, nil
+}
 
-	dates, err := models.GetDatesBookedBy(s.db, user.Id)
+// bookedError shows the error above the bookings of the user
+func (s *server) bookedError(r *http.Request, user *models.User, e *appError) error {
+	data, err := s.bookedData(r, user)
 	if err != nil {
-		renderError(w, r, http.StatusInternalServerError)
-		log.Print(err)
-		return
+		return err
 	}
+	e.template, e.data = "booked.html", data
+	return e
+}
 
-	renderTemplate(w, r, "booked.html", dates)
+func (s *server) bookedView(w http.ResponseWriter, r *http.Request) error {
+	user := getUser(r)
+	if user == nil {
+		return statusError(http.StatusForbidden)
+	}
+	data, err := s.bookedData(r, user)
+	if err != nil {
+		return err
+	}
+	renderTemplate(w, r, "booked.html", data)
+	return nil
 }
 
 func (s *server) loginView(w http.ResponseWriter, r *http.Request) {
@@ -45,233 +93,498 @@ func (s *server) loginView(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (s *server) bookHandler(w http.ResponseWriter, r *http.Request) {
+// bookingFieldValue is a booking field together with the value
+// shown in the booking form
+type bookingFieldValue struct {
+	*models.BookingField
+	Name  string
+	Value string
+}
+
+func bookingFormData(date *models.DateWithNames, fields []bookingFieldValue, approval bool) map[string]interface{} {
+	return map[string]interface{}{
+		"date":     date,
+		"fields":   fields,
+		"approval": approval,
+	}
+}
+
+// freeDate reads the date given in the URL,
+// which mustn't be booked already
+func (s *server) freeDate(r *http.Request) (*models.DateWithNames, error) {
+	dateId, err := strconv.Atoi(chi.URLParam(r, "dateId"))
+	if err != nil {
+		return nil, statusError(http.StatusBadRequest)
+	}
+
+	date, err := models.GetDateWithNamesById(r.Context(), s.db, dateId)
+	if err != nil || date.BookedBy != -1 {
+		return nil, statusError(http.StatusBadRequest)
+	}
+	return date, nil
+}
+
+// bookingApproval tells whether booking the date has to be approved,
+// customers blocked for missed visits can't book it at all
+func (s *server) bookingApproval(r *http.Request, user *models.User, date *models.DateWithNames) (bool, error) {
+	approval, err := s.bookingNeedsApproval(r.Context(), user, date)
+	if err == errBookingBlocked {
+		return false, newError(http.StatusForbidden, noShowBlockedMessage)
+	}
+	return approval, err
+}
+
+func (s *server) bookView(w http.ResponseWriter, r *http.Request) error {
 	user := getUser(r)
 	if user == nil {
 		http.Redirect(w, r, "/login/", http.StatusFound)
-		return
+		return nil
 	}
 
-	dateId, err := strconv.Atoi(chi.URLParam(r, "dateId"))
+	date, err := s.freeDate(r)
 	if err != nil {
-		renderError(w, r, http.StatusBadRequest)
-		return
+		return err
+	}
+	approval, err := s.bookingApproval(r, user, date)
+	if err != nil {
+		return err
 	}
 
-	date, err := models.GetDateById(s.db, dateId)
-	if err != nil || date.BookedBy != -1 {
-		renderError(w, r, http.StatusBadRequest)
-		return
+	fields, err := models.GetBookingFields(r.Context(), s.db)
+	if err != nil {
+		return err
+	}
+
+	values := make([]bookingFieldValue, len(fields))
+	for i, f := range fields {
+		values[i] = bookingFieldValue{f, "field-" + strconv.Itoa(f.Id), user.ProfileValue(f.ProfileField)}
+	}
+	renderTemplate(w, r, "book.html", bookingFormData(date, values, approval))
+	return nil
+}
+
+func (s *server) bookHandler(w http.ResponseWriter, r *http.Request) error {
+	user := getUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/login/", http.StatusFound)
+		return nil
+	}
+
+	date, err := s.freeDate(r)
+	if err != nil {
+		return err
+	}
+	approval, err := s.bookingApproval(r, user, date)
+	if err != nil {
+		return err
 	}
 
-	// TODO: remove race condition
-	err = models.SetDateBookedBy(s.db, dateId, user.Id)
+	fields, err := models.GetBookingFields(r.Context(), s.db)
 	if err != nil {
-		renderError(w, r, http.StatusInternalServerError)
-		return
+		return err
+	}
+
+	r.ParseForm()
+	answers := make(map[int]string)
+	values := make([]bookingFieldValue, len(fields))
+	missing := fieldErrors{}
+	for i, f := range fields {
+		name := "field-" + strconv.Itoa(f.Id)
+		value := strings.TrimSpace(r.Form.Get(name))
+		values[i] = bookingFieldValue{f, name, value}
+		if value != "" {
+			answers[f.Id] = value
+		} else if f.Required {
+			missing.add(name, "this field is required")
+		}
+	}
+	if len(missing) > 0 {
+		e := formError("book.html", bookingFormData(date, values, approval), missing)
+		e.message = "please fill in all required fields"
+		return e
+	}
+
+	if approval {
+		var deadline time.Time
+		deadline, err = s.approvalDeadline(r.Context(), &date.Date)
+		if err == nil {
+			err = models.RequestBooking(r.Context(), s.db, date.Id, user.Id, answers, deadline)
+		}
+	} else {
+		err = models.BookDate(r.Context(), s.db, date.Id, user.Id, answers)
+	}
+	if err == models.ErrDateTaken {
+		return newError(http.StatusBadRequest, "this date has just been booked by someone else")
+	} else if err != nil {
+		return err
 	}
 
+	before := auditDate(&date.Date)
+	after := before
+	after.BookedBy = user.Id
+	s.auditEntry(r, &models.AuditEntry{
+		ActorId:      user.Id,
+		Action:       models.AuditBook,
+		Target:       s.formatVisit(r.Context(), &date.Date),
+		TargetUserId: date.AssignedTo,
+		TargetDateId: date.Id,
+		Before:       auditValue(before),
+		After:        auditValue(map[string]interface{}{"date": after, "pending": approval}),
+	})
+
+	if approval {
+		s.metrics.bookings.Inc("pending")
+		s.notify(r.Context(), date.AssignedTo, "%s asks to book %s.", user.Name, s.formatVisit(r.Context(), &date.Date))
+		http.Redirect(w, r, "/booked/", http.StatusFound)
+		return nil
+	}
+	s.metrics.bookings.Inc("booked")
 	http.Redirect(w, r, "/", http.StatusFound)
+	return nil
 }
 
-func (s *server) unbookHandler(w http.ResponseWriter, r *http.Request) {
+func (s *server) unbookHandler(w http.ResponseWriter, r *http.Request) error {
 	user := getUser(r)
 	if user == nil {
-		renderError(w, r, http.StatusForbidden)
-		return
+		return statusError(http.StatusForbidden)
 	}
 
 	dateId, err := strconv.Atoi(chi.URLParam(r, "dateId"))
 	if err != nil {
-		renderError(w, r, http.StatusBadRequest)
-		return
+		return statusError(http.StatusBadRequest)
 	}
 
-	date, err := models.GetDateById(s.db, dateId)
-	if err != nil || (date.BookedBy != user.Id && !user.IsAdmin()) || date.BookedBy == -1 {
-		renderError(w, r, http.StatusBadRequest)
-		return
+	// staff allowed to cancel any booking can override the policy
+	override := user.Can(models.PermCancelAnyBooking)
+	date, err := models.GetDateById(r.Context(), s.db, dateId)
+	if err != nil || (date.BookedBy != user.Id && !override) || date.BookedBy == -1 {
+		return statusError(http.StatusBadRequest)
 	}
 
-	err = models.SetDateBookedBy(s.db, dateId, -1)
+	policy, err := models.GetCancellationPolicy(r.Context(), s.db)
 	if err != nil {
-		renderError(w, r, http.StatusInternalServerError)
-		return
+		return err
 	}
 
+	now := time.Now()
+	late := policy.IsLate(date.StartTime, now)
+	reason := strings.TrimSpace(r.PostFormValue("reason"))
+	if !override {
+		if !now.Before(date.StartTime) {
+			return s.bookedError(r, user, newError(http.StatusBadRequest,
+				"this visit has already started and can't be cancelled"))
+		} else if late && !policy.AllowLate {
+			return s.bookedError(r, user, newError(http.StatusForbidden,
+				"bookings can't be cancelled less than %d hours before the visit", policy.MinNoticeHours()))
+		} else if policy.RequireReason && reason == "" {
+			return s.bookedError(r, user, newError(http.StatusBadRequest,
+				"please give a reason for the cancellation"))
+		}
+	}
+
+	err = models.CancelBooking(r.Context(), s.db, date, user.Id, reason, late)
+	if err == models.ErrNotBooked {
+		return statusError(http.StatusBadRequest)
+	} else if err != nil {
+		return err
+	}
+	if late {
+		s.metrics.cancellations.Inc("late")
+	} else {
+		s.metrics.cancellations.Inc("in_time")
+	}
+
+	after := auditDate(date)
+	after.BookedBy = -1
+	s.auditEntry(r, &models.AuditEntry{
+		ActorId:      user.Id,
+		Action:       models.AuditUnbook,
+		Target:       s.formatVisit(r.Context(), date),
+		TargetUserId: date.BookedBy,
+		TargetDateId: date.Id,
+		Before:       auditValue(auditDate(date)),
+		After: auditValue(map[string]interface{}{
+			"date":        after,
+			"reasonGiven": reason != "",
+			"late":        late,
+		}),
+	})
+
 	http.Redirect(w, r, "/booked/", http.StatusFound)
+	return nil
 }
 
-func (s *server) addDateView(w http.ResponseWriter, r *http.Request) {
+// addDateData lists the employees for users adding dates for anyone
+func (s *server) addDateData(r *http.Request) (map[string]interface{}, error) {
 	user := getUser(r)
-	if user == nil || !user.IsEmployee() {
-		renderError(w, r, http.StatusForbidden)
-	} else if user.IsAdmin() {
-		emps, err := models.GetUsersByType(s.db, models.UserTypeEmployee)
-		if err != nil {
-			renderError(w, r, http.StatusInternalServerError)
-			log.Println(err)
-		} else {
-			renderTemplate(w, r, "add_date.html", map[string]interface{}{
-				"emps":   emps,
-				"userId": user.Id,
-			})
-		}
-	} else {
-		renderTemplate(w, r, "add_date.html", nil)
+	if !user.Can(models.PermManageSlots) {
+		return nil, nil
+	}
+	emps, err := models.GetUsersWithPermission(r.Context(), s.db, models.PermOwnSlots)
+	if err != nil {
+		return nil, err
 	}
+	return map[string]interface{}{
+		"emps":   emps,
+		"userId": user.Id,
+	}, nil
 }
 
-func (s *server) addDateHandler(w http.ResponseWriter, r *http.Request) {
-	user := getUser(r)
-	if user == nil || !user.IsEmployee() {
-		renderError(w, r, http.StatusForbidden)
-		return
+// addDateError shows the error with the form for adding dates
+func (s *server) addDateError(r *http.Request, e *appError) error {
+	data, err := s.addDateData(r)
+	if err != nil {
+		return err
 	}
+	e.template, e.data = "add_date.html", data
+	return e
+}
 
-	if !verifyForm(r, "start-time", "end-time") {
-		renderError(w, r, http.StatusBadRequest)
-		return
+func (s *server) addDateView(w http.ResponseWriter, r *http.Request) error {
+	data, err := s.addDateData(r)
+	if err != nil {
+		return err
 	}
+	renderTemplate(w, r, "add_date.html", data)
+	return nil
+}
 
-	empId := user.Id
-	if user.IsAdmin() {
-		if !r.Form.Has("employee") {
-			renderError(w, r, http.StatusBadRequest)
-			return
-		}
+func (s *server) addDateHandler(w http.ResponseWriter, r *http.Request) error {
+	user := getUser(r)
+	r.ParseForm()
 
-		var err error
-		empId, err = strconv.Atoi(r.Form.Get("employee"))
+	fields := fieldErrors{}
+	empId := user.Id
+	if user.Can(models.PermManageSlots) {
+		id, err := strconv.Atoi(r.Form.Get("employee"))
 		if err != nil {
-			renderError(w, r, http.StatusBadRequest)
-			return
+			id = -1
+		}
+		emp, err := models.GetUserById(r.Context(), s.db, id)
+		if err == models.ErrNotFound || (err == nil && !emp.Can(models.PermOwnSlots)) {
+			fields.add("employee", "unknown employee")
+		} else if err != nil {
+			return err
+		} else {
+			empId = emp.Id
 		}
 	} else if r.Form.Has("employee") {
-		renderError(w, r, http.StatusForbidden)
-		return
+		return statusError(http.StatusForbidden)
 	}
 
-	const layout = "2006-01-02T15:04"
-	startTime, err := time.Parse(layout, r.Form.Get("start-time"))
+	startTime, err := parseFormTime(r, dateInputLayout, r.Form.Get("start-time"))
 	if err != nil {
-		renderError(w, r, http.StatusBadRequest)
-		return
+		fields.add("start-time", "invalid start time")
 	}
-	endTime, err := time.Parse(layout, r.Form.Get("end-time"))
-	if err != nil || startTime.After(endTime) {
-		renderError(w, r, http.StatusBadRequest)
-		return
+	endTime, err := parseFormTime(r, dateInputLayout, r.Form.Get("end-time"))
+	if err != nil {
+		fields.add("end-time", "invalid end time")
+	} else if len(fields) == 0 && startTime.After(endTime) {
+		fields.add("end-time", "the end has to be after the start")
+	}
+	if len(fields) > 0 {
+		return s.addDateError(r, formError("", nil, fields))
 	}
 
-	// TODO: check if user[empID].isEmployee()
-
-	err = models.CreateDate(s.db, startTime, endTime, empId)
-	if err != nil {
-		log.Println(err)
-		renderError(w, r, http.StatusInternalServerError)
-		return
+	dateId, err := models.CreateDate(r.Context(), s.db, startTime, endTime, empId)
+	if err == models.ErrEmployeeAbsent {
+		return s.addDateError(r, newError(http.StatusBadRequest, "the employee is absent at that time"))
+	} else if err != nil {
+		return err
 	}
+	s.auditEntry(r, &models.AuditEntry{
+		ActorId:      user.Id,
+		Action:       models.AuditAddDate,
+		Target:       startTime.In(s.businessLocation(r.Context())).Format(visitLayout),
+		TargetUserId: empId,
+		TargetDateId: dateId,
+		After:        auditValue(auditedDate{startTime, endTime, empId, -1}),
+	})
 
 	http.Redirect(w, r, "/add-date/", http.StatusFound)
+	return nil
 }
 
-func (s *server) addUserView(w http.ResponseWriter, r *http.Request) {
-	user := getUser(r)
-	if user == nil || !user.IsAdmin() {
-		renderError(w, r, http.StatusForbidden)
-	} else {
-		renderTemplate(w, r, "add_user.html", nil)
+func (s *server) addUserView(w http.ResponseWriter, r *http.Request) error {
+	roles, err := models.GetRoles(r.Context(), s.db)
+	if err != nil {
+		return err
 	}
+	renderTemplate(w, r, "add_user.html", roles)
+	return nil
 }
 
-func (s *server) addUserHandler(w http.ResponseWriter, r *http.Request) {
-	user := getUser(r)
-	if user == nil || !user.IsAdmin() {
-		renderError(w, r, http.StatusForbidden)
-		return
+// validateNewUser checks the form adding a user, whether the username is
+// taken is only known once the user is created
+func validateNewUser(r *http.Request) fieldErrors {
+	fields := fieldErrors{}
+	if strings.TrimSpace(r.Form.Get("name")) == "" {
+		fields.add("name", "name can't be empty")
+	}
+	if strings.TrimSpace(r.Form.Get("username")) == "" {
+		fields.add("username", "username can't be empty")
+	}
+	if r.Form.Get("password") == "" {
+		fields.add("password", "password can't be empty")
 	}
+	return fields
+}
+
+// usernameTaken is the error of a form creating a user with a taken username
+func usernameTaken(template string, data interface{}) *appError {
+	e := formError(template, data, fieldErrors{"username": "username is already taken"})
+	e.status = http.StatusConflict
+	return e
+}
 
+func (s *server) addUserHandler(w http.ResponseWriter, r *http.Request) error {
 	r.ParseForm()
 
-	var err error
-	var userType int
-	userType, err = strconv.Atoi(r.Form.Get("type"));
+	roles, err := models.GetRoles(r.Context(), s.db)
 	if err != nil {
-		renderError(w, r, http.StatusBadRequest)
-		return
+		return err
 	}
-
-	err = models.CreateUser(s.db, r.Form.Get("name"), r.Form.Get("username"), r.Form.Get("password"), userType)
+	fields := validateNewUser(r)
+	roleId, err := strconv.Atoi(r.Form.Get("role"))
 	if err != nil {
-		log.Println(err);
-		renderError(w, r, http.StatusBadRequest)
-		return
+		fields.add("role", "unknown role")
+	} else if role, err := models.GetRoleById(r.Context(), s.db, roleId); err == models.ErrNotFound {
+		fields.add("role", "unknown role")
+	} else if err != nil {
+		return err
+	} else if message := assignForbidden(getUser(r), role); message != "" {
+		fields.add("role", message)
+	}
+	if len(fields) > 0 {
+		return formError("add_user.html", roles, fields)
 	}
 
-	log.Println("User added");
+	err = models.CreateUser(r.Context(), s.db, strings.TrimSpace(r.Form.Get("name")),
+		strings.TrimSpace(r.Form.Get("username")), r.Form.Get("password"), roleId)
+	if errors.Is(err, models.ErrConflict) {
+		return usernameTaken("add_user.html", roles)
+	} else if err != nil {
+		return err
+	}
 
-	s.addUserView(w, r)
-    http.Redirect(w, r, "/", http.StatusFound)
+	if u, err := models.GetUserByUsername(r.Context(), s.db, strings.TrimSpace(r.Form.Get("username"))); err != nil {
+		logError(r, err)
+	} else {
+		s.auditEntry(r, &models.AuditEntry{
+			ActorId:      getUser(r).Id,
+			Action:       models.AuditAddUser,
+			TargetUserId: u.Id,
+			TargetDateId: -1,
+			After:        auditValue(auditUser(u)),
+		})
+	}
+
+	http.Redirect(w, r, "/users/", http.StatusSeeOther)
+	return nil
 }
 
-func (s *server) registerView(w http.ResponseWriter, r *http.Request) {
-	user := getUser(r)
-	if user != nil {
-		renderError(w, r, http.StatusForbidden)
-	} else {
-		renderTemplate(w, r, "register.html", nil)
+func (s *server) registerView(w http.ResponseWriter, r *http.Request) error {
+	if getUser(r) != nil {
+		return statusError(http.StatusForbidden)
 	}
+	renderTemplate(w, r, "register.html", nil)
+	return nil
 }
 
-func (s *server) registerHandler(w http.ResponseWriter, r *http.Request) {
-	user := getUser(r)
-	if user != nil {
-		renderError(w, r, http.StatusForbidden)
-		return
+func (s *server) registerHandler(w http.ResponseWriter, r *http.Request) error {
+	if getUser(r) != nil {
+		return statusError(http.StatusForbidden)
 	}
 
 	r.ParseForm()
-
-	var err error
-
-	err = models.CreateUser(s.db, r.Form.Get("name"), r.Form.Get("username"), r.Form.Get("password"), models.UserTypeCustomer)
-	if err != nil {
-		log.Println(err);
-		renderError(w, r, http.StatusBadRequest)
-		return
+	if fields := validateNewUser(r); len(fields) > 0 {
+		return formError("register.html", nil, fields)
 	}
 
-	log.Println("User registered");
+	username := strings.TrimSpace(r.Form.Get("username"))
+	err := models.CreateUser(r.Context(), s.db, strings.TrimSpace(r.Form.Get("name")),
+		username, r.Form.Get("password"), models.RoleCustomer)
+	if errors.Is(err, models.ErrConflict) {
+		return usernameTaken("register.html", nil)
+	} else if err != nil {
+		return err
+	}
+	requestLogger(r).Info("user registered", "username", username)
 
-	// s.addUserView(w, r)
-    http.Redirect(w, r, "/login/", http.StatusFound)
+	http.Redirect(w, r, "/login/", http.StatusFound)
+	return nil
 }
 
-func (s *server) assignedView(w http.ResponseWriter, r *http.Request) {
+func (s *server) assignedView(w http.ResponseWriter, r *http.Request) error {
 	user := getUser(r)
-	if user == nil || !user.IsEmployee() {
-		renderError(w, r, http.StatusForbidden)
-		return
-	}
 
 	var dates []*models.DateWithNames
 	var err error
-	if user.IsAdmin() {
-		dates, err = models.GetDatesWithNamesAll(s.db)
+	if user.Can(models.PermViewAllBookings) {
+		dates, err = models.GetDatesWithNamesAll(r.Context(), s.db)
 		if err != nil {
-			log.Println(err)
-			renderError(w, r, http.StatusInternalServerError)
-			return
+			return err
 		}
 	} else {
-		dates, err = models.GetDatesWithNamesAssignedTo(s.db, user.Id)
+		dates, err = models.GetDatesWithNamesAssignedTo(r.Context(), s.db, user.Id)
 		if err != nil {
-			log.Println(err)
-			renderError(w, r, http.StatusInternalServerError)
-			return
+			return err
+		}
+	}
+
+	dateIds := make([]int, len(dates))
+	for i, d := range dates {
+		dateIds[i] = d.Id
+	}
+	answers, err := models.GetBookingAnswers(r.Context(), s.db, dateIds)
+	if err != nil {
+		return err
+	}
+
+	var cancellations []*models.Cancellation
+	if user.Can(models.PermViewAllBookings) {
+		cancellations, err = models.GetCancellationsAll(r.Context(), s.db)
+	} else {
+		cancellations, err = models.GetCancellationsAssignedTo(r.Context(), s.db, user.Id)
+	}
+	if err != nil {
+		return err
+	}
+	attendance, err := models.GetAttendance(r.Context(), s.db, dateIds)
+	if err != nil {
+		return err
+	}
+	noShows, err := models.GetNoShowCounts(r.Context(), s.db)
+	if err != nil {
+		return err
+	}
+	pending, err := models.GetPendingBookings(r.Context(), s.db, dateIds)
+	if err != nil {
+		return err
+	}
+	notifications, err := models.GetUnreadNotifications(r.Context(), s.db, user.Id)
+	if err != nil {
+		return err
+	}
+
+	lateCancellations := 0
+	for _, c := range cancellations {
+		if c.Late {
+			lateCancellations++
 		}
 	}
 
-	renderTemplate(w, r, "assigned.html", dates)
+	renderTemplate(w, r, "assigned.html", map[string]interface{}{
+		"dates":             dates,
+		"answers":           answers,
+		"attendance":        attendance,
+		"statuses":          models.AttendanceStatuses,
+		"noShows":           noShows,
+		"pending":           pending,
+		"notifications":     notifications,
+		"now":               time.Now(),
+		"cancellations":     cancellations,
+		"lateCancellations": lateCancellations,
+	})
+	return nil
 }
@@ -5,95 +5,73 @@ import (
 	"context"
 	"fmt"
 	"html/template"
-	"log"
 	"net/http"
-	"path"
-	"path/filepath"
-	"runtime"
 )
 
-func getTemplatesDir() string {
-	_, b, _, _ := runtime.Caller(0)
-	basepath := filepath.Dir(b)
-	basepath = path.Join(basepath, "../web/templates/")
-	return basepath
-}
-
-var templatesDir = getTemplatesDir()
-
 type templateContext struct {
+	Lang  string
 	User  *models.User
 	Data  interface{}
-	Error interface{}
+	Error string
 }
 
-func readErrorMessage(r *http.Request) interface{} {
-	if r.Context().Value("error") == nil {
-		return nil
-	} else {
-		return r.Context().Value("error").(string)
-	}
+// page keeps what handlers want shown besides the data of the template.
+// One is stored in the context of every request, so that handlers can
+// add to it without replacing the request.
+type page struct {
+	status int
+	err    string
+	fields map[string]string // translated messages by the name of the input
 }
 
-func getUser(r *http.Request) *models.User {
-	val := r.Context().Value("user")
-	if val != nil {
-		return val.(*models.User)
-	} else {
-		return nil
-	}
+// preparePage gives the request its page
+func preparePage(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), pageKey, &page{})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
 }
 
-func renderTemplate(w http.ResponseWriter, r *http.Request, filename string, data interface{}) {
-	t, err := template.ParseFiles(
-		path.Join(templatesDir, "layout.html"),
-		path.Join(templatesDir, filename),
-	)
-	if err != nil {
-		log.Println(err)
-		return
-	}
-
-	err = t.Execute(w, templateContext{
-		User:  getUser(r),
-		Error: readErrorMessage(r),
-		Data:  data,
-	})
-	if err != nil {
-		log.Println(err)
+func getPage(r *http.Request) *page {
+	if p, ok := r.Context().Value(pageKey).(*page); ok {
+		return p
 	}
+	return &page{}
 }
 
-func addError(w http.ResponseWriter, r *http.Request, statusCode int, err string) {
-	w.WriteHeader(statusCode)
-	ctx := context.WithValue(r.Context(), "error", err)
-	*r = *r.WithContext(ctx)
+func readErrorMessage(r *http.Request) string {
+	return getPage(r).err
 }
 
-func errorMessageFromStatus(statusCode int) string {
-	return fmt.Sprintf("%d: %s", statusCode, http.StatusText(statusCode))
+// fieldError renders the problem with the input next to it
+func fieldError(r *http.Request, name string) template.HTML {
+	message, ok := getPage(r).fields[name]
+	if !ok {
+		return ""
+	}
+	return template.HTML(`<span class="field-error">` + template.HTMLEscapeString(message) + `</span>`)
 }
 
-func addStatusCodeError(w http.ResponseWriter, r *http.Request, statusCode int) {
-	addError(w, r, statusCode, errorMessageFromStatus(statusCode))
+func getUser(r *http.Request) *models.User {
+	user, _ := r.Context().Value(userKey).(*models.User)
+	return user
 }
 
-func renderError(w http.ResponseWriter, r *http.Request, statusCode int) {
-	addStatusCodeError(w, r, statusCode)
-	renderTemplate(w, r, "error.html", nil)
+// setError stores the message and the status code, which is sent once the
+// page is rendered
+func setError(r *http.Request, statusCode int, err string) {
+	p := getPage(r)
+	p.status = statusCode
+	p.err = err
 }
 
-func verifyForm(r *http.Request, fields ...string) bool {
-	err := r.ParseForm()
-	if err != nil {
-		return false
-	}
-
-	for _, field := range fields {
-		if !r.Form.Has(field) {
-			return false
-		}
+func readStatus(r *http.Request) int {
+	if status := getPage(r).status; status != 0 {
+		return status
 	}
+	return http.StatusOK
+}
 
-	return true
+func errorMessageFromStatus(r *http.Request, statusCode int) string {
+	return fmt.Sprintf("%d: %s", statusCode, tr(r, http.StatusText(statusCode)))
 }
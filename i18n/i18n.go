@@ -0,0 +1,175 @@
+// Package i18n translates the user interface. Messages are written in
+// English in the code and the templates and serve as keys of catalogues
+// with their translations to other languages.
+package i18n
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Default is the language of the messages in the code
+const Default = "en"
+
+// Languages lists supported languages, the default one first
+var Languages = []string{Default, "pl"}
+
+var catalogues = map[string]map[string]string{
+	"pl": pl,
+}
+
+// locale specific formats of dates
+type locale struct {
+	dateTime string // short date with the time
+	full     string // full date with the time
+	date     string
+	weekdays [7]string
+}
+
+var locales = map[string]locale{
+	"en": {
+		dateTime: "2-01 15:04",
+		full:     "2006-01-02 15:04",
+		date:     "2006-01-02",
+		weekdays: [7]string{"Sunday", "Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday"},
+	},
+	"pl": {
+		dateTime: "2.01 15:04",
+		full:     "02.01.2006 15:04",
+		date:     "02.01.2006",
+		weekdays: [7]string{"niedziela", "poniedziałek", "wtorek", "środa", "czwartek", "piątek", "sobota"},
+	},
+}
+
+func IsSupported(lang string) bool {
+	_, ok := locales[lang]
+	return ok
+}
+
+// Has tells whether the catalogue of the language contains the message,
+// every message is available in the default language
+func Has(lang string, message string) bool {
+	if lang == Default {
+		return true
+	}
+	_, ok := catalogues[lang][message]
+	return ok
+}
+
+// Translate returns the message in the language, or unchanged if it has
+// no translation. With arguments the message is used as a format.
+func Translate(lang string, message string, args ...interface{}) string {
+	if translated, ok := catalogues[lang][message]; ok {
+		message = translated
+	}
+	if len(args) > 0 {
+		return fmt.Sprintf(message, args...)
+	}
+	return message
+}
+
+// TranslatePlural picks the form of the message fitting the number, which
+// is also the first argument of the format. Translations of the plural
+// form list all forms of the language separated by "|".
+func TranslatePlural(lang string, n int, singular string, plural string, args ...interface{}) string {
+	forms := []string{singular, plural}
+	if translated, ok := catalogues[lang][plural]; ok {
+		forms = strings.Split(translated, "|")
+	}
+	form := pluralForm(lang, n)
+	if form >= len(forms) {
+		form = len(forms) - 1
+	}
+	return fmt.Sprintf(forms[form], append([]interface{}{n}, args...)...)
+}
+
+// pluralForm returns the index of the plural form used for the number
+func pluralForm(lang string, n int) int {
+	if n < 0 {
+		n = -n
+	}
+	switch lang {
+	case "pl":
+		if n == 1 {
+			return 0
+		} else if n%10 >= 2 && n%10 <= 4 && (n%100 < 12 || n%100 > 14) {
+			return 1
+		}
+		return 2
+	default:
+		if n == 1 {
+			return 0
+		}
+		return 1
+	}
+}
+
+// Negotiate picks the supported language preferred in the Accept-Language
+// header, the default one if there is none
+func Negotiate(header string) string {
+	type choice struct {
+		lang    string
+		quality float64
+	}
+	var choices []choice
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		lang := strings.ToLower(strings.TrimSpace(fields[0]))
+		if i := strings.IndexByte(lang, '-'); i >= 0 {
+			lang = lang[:i]
+		}
+		quality := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				q, err := strconv.ParseFloat(param[2:], 64)
+				if err != nil {
+					q = 0
+				}
+				quality = q
+			}
+		}
+		if IsSupported(lang) && quality > 0 {
+			choices = append(choices, choice{lang, quality})
+		}
+	}
+	if len(choices) == 0 {
+		return Default
+	}
+	sort.SliceStable(choices, func(i, j int) bool {
+		return choices[i].quality > choices[j].quality
+	})
+	return choices[0].lang
+}
+
+func getLocale(lang string) locale {
+	if l, ok := locales[lang]; ok {
+		return l
+	}
+	return locales[Default]
+}
+
+// FormatDateTime formats a short date with the time, like in lists of dates
+func FormatDateTime(lang string, t time.Time) string {
+	return t.Format(getLocale(lang).dateTime)
+}
+
+// FormatFull formats the full date with the time
+func FormatFull(lang string, t time.Time) string {
+	return t.Format(getLocale(lang).full)
+}
+
+func FormatDate(lang string, t time.Time) string {
+	return t.Format(getLocale(lang).date)
+}
+
+func FormatClock(t time.Time) string {
+	return t.Format("15:04")
+}
+
+func Weekday(lang string, day time.Weekday) string {
+	return getLocale(lang).weekdays[day]
+}
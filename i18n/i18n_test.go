@@ -0,0 +1,92 @@
+package i18n
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNegotiate(t *testing.T) {
+	cases := map[string]string{
+		"":                        Default,
+		"pl":                      "pl",
+		"pl-PL,pl;q=0.9,en;q=0.8": "pl",
+		"en-US,en;q=0.9,pl;q=0.8": "en",
+		"de, pl;q=0.5, en;q=0.4":  "pl",
+		"de, fr":                  Default,
+		"en;q=0.2, PL;q=0.7":      "pl",
+		"pl;q=0, en":              "en",
+		"pl;q=invalid, en;q=0.1":  "en",
+	}
+	for header, expected := range cases {
+		if lang := Negotiate(header); lang != expected {
+			t.Errorf("Expected %s for '%s', got %s", expected, header, lang)
+		}
+	}
+}
+
+func TestTranslate(t *testing.T) {
+	if m := Translate("pl", "Available dates:"); m != "Wolne terminy:" {
+		t.Errorf("Unexpected translation: %s", m)
+	}
+	if m := Translate("en", "Created %d dates.", 3); m != "Created 3 dates." {
+		t.Errorf("Unexpected message: %s", m)
+	}
+	// messages without a translation are shown unchanged
+	if m := Translate("pl", "100% unknown"); m != "100% unknown" {
+		t.Errorf("Unexpected message: %s", m)
+	}
+	if !Has("en", "anything") || Has("pl", "anything") {
+		t.Error("Unexpected contents of the catalogues")
+	}
+}
+
+func TestTranslatePlural(t *testing.T) {
+	cases := []struct {
+		lang     string
+		n        int
+		expected string
+	}{
+		{"en", 1, "Created 1 date."},
+		{"en", 0, "Created 0 dates."},
+		{"en", 3, "Created 3 dates."},
+		{"pl", 1, "Utworzono 1 termin."},
+		{"pl", 3, "Utworzono 3 terminy."},
+		{"pl", 5, "Utworzono 5 terminów."},
+		{"pl", 12, "Utworzono 12 terminów."},
+		{"pl", 22, "Utworzono 22 terminy."},
+		{"pl", 111, "Utworzono 111 terminów."},
+	}
+	for _, c := range cases {
+		if m := TranslatePlural(c.lang, c.n, "Created %d date.", "Created %d dates."); m != c.expected {
+			t.Errorf("Expected '%s' for %d in %s, got '%s'", c.expected, c.n, c.lang, m)
+		}
+	}
+	// further arguments follow the number
+	m := TranslatePlural("pl", 2, "%d failed attempt, locked until %s", "%d failed attempts, locked until %s", "10:00")
+	if m != "2 nieudane próby, zablokowane do 10:00" {
+		t.Errorf("Unexpected translation: %s", m)
+	}
+}
+
+func TestFormats(t *testing.T) {
+	date := time.Date(2030, 7, 1, 9, 5, 0, 0, time.UTC)
+	cases := []struct {
+		got      string
+		expected string
+	}{
+		{FormatDateTime("en", date), "1-07 09:05"},
+		{FormatDateTime("pl", date), "1.07 09:05"},
+		{FormatFull("en", date), "2030-07-01 09:05"},
+		{FormatFull("pl", date), "01.07.2030 09:05"},
+		{FormatDate("pl", date), "01.07.2030"},
+		{FormatDate("xx", date), "2030-07-01"},
+		{FormatClock(date), "09:05"},
+		{Weekday("en", date.Weekday()), "Monday"},
+		{Weekday("pl", date.Weekday()), "poniedziałek"},
+	}
+	for _, c := range cases {
+		if c.got != c.expected {
+			t.Errorf("Expected %s, got %s", c.expected, c.got)
+		}
+	}
+}
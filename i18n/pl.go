@@ -0,0 +1,327 @@
+package i18n
+
+var pl = map[string]string{
+	// navigation and titles
+	"Public page":                     "Strona publiczna",
+	"Services:":                       "Usługi:",
+	"show the page":                   "pokaż stronę",
+	"Find a date":                     "Znajdź termin",
+	"Suggested dates:":                "Proponowane terminy:",
+	"assigned dates":                  "przydzielone terminy",
+	"add date":                        "dodaj termin",
+	"dates":                           "terminy",
+	"schedule":                        "grafik",
+	"add user":                        "dodaj użytkownika",
+	"users":                           "użytkownicy",
+	"roles":                           "role",
+	"locked accounts":                 "zablokowane konta",
+	"settings":                        "ustawienia",
+	"booking fields":                  "pola rezerwacji",
+	"audit log":                       "dziennik zdarzeń",
+	"profile":                         "profil",
+	"two-factor authentication":       "weryfikacja dwuetapowa",
+	"Logout":                          "Wyloguj",
+	"Sign in":                         "Zaloguj się",
+	"Register":                        "Zarejestruj się",
+	"Profile":                         "Profil",
+	"Settings":                        "Ustawienia",
+	"Schedule":                        "Grafik",
+	"Dates":                           "Terminy",
+	"Users":                           "Użytkownicy",
+	"Roles":                           "Role",
+	"Locked accounts":                 "Zablokowane konta",
+	"Booking fields":                  "Pola rezerwacji",
+	"Audit log":                       "Dziennik zdarzeń",
+	"Two-factor authentication":       "Weryfikacja dwuetapowa",
+	"Add date":                        "Dodaj termin",
+	"Edit date":                       "Edytuj termin",
+	"Add user":                        "Dodaj użytkownika",
+	"Edit user":                       "Edytuj użytkownika",
+	"Delete user":                     "Usuń użytkownika",
+	"Delete account":                  "Usuń konto",
+	"Delete your account":             "Usuń swoje konto",
+	"Booking approval":                "Zatwierdzanie rezerwacji",
+	"Cancellation policy":             "Zasady odwoływania",
+	"Missed visits":                   "Nieodbyte wizyty",
+	"Available dates:":                "Wolne terminy:",
+	"Booked dates:":                   "Zarezerwowane terminy:",
+	"Cancelled dates:":                "Odwołane terminy:",
+	"All assigned dates:":             "Wszystkie przydzielone terminy:",
+	"Audit log:":                      "Dziennik zdarzeń:",
+	"Booking fields:":                 "Pola rezerwacji:",
+	"Locked accounts:":                "Zablokowane konta:",
+	"Roles:":                          "Role:",
+	"Users:":                          "Użytkownicy:",
+	"Breaks:":                         "Przerwy:",
+	"Absences:":                       "Nieobecności:",
+	"Notifications:":                  "Powiadomienia:",
+	"Above the limit:":                "Po przekroczeniu limitu:",
+	"Generate dates:":                 "Generuj terminy:",
+	"New field:":                      "Nowe pole:",
+	"New role:":                       "Nowa rola:",
+	"Working hours of %s:":            "Godziny pracy: %s",
+	"No accounts are locked.":         "Żadne konto nie jest zablokowane.",
+	"No entries found.":               "Nie znaleziono wpisów.",
+	"No users found.":                 "Nie znaleziono użytkowników.",
+	"Created %d dates.":               "Utworzono %d termin.|Utworzono %d terminy.|Utworzono %d terminów.",
+	"The customers will be notified.": "Klienci zostaną powiadomieni.",
+	"Notification from Booker":        "Powiadomienie z Bookera",
+	"The employees will be notified.": "Pracownicy zostaną powiadomieni.",
+	"These bookings made by the user will be cancelled:":                            "Te rezerwacje użytkownika zostaną odwołane:",
+	"The booking of %s by %s has been cancelled because their account was deleted.": "Rezerwacja terminu %s przez %s została odwołana, ponieważ konto usunięto.",
+
+	// buttons
+	"Add":                         "Dodaj",
+	"Add absence":                 "Dodaj nieobecność",
+	"Add break":                   "Dodaj przerwę",
+	"Apply":                       "Zastosuj",
+	"Approve":                     "Zatwierdź",
+	"Assign":                      "Przypisz",
+	"Book":                        "Zarezerwuj",
+	"Confirm":                     "Potwierdź",
+	"Delete":                      "Usuń",
+	"Delete my account":           "Usuń moje konto",
+	"Delete upcoming dates":       "Usuń nadchodzące terminy",
+	"Disable":                     "Wyłącz",
+	"Dismiss":                     "Zamknij",
+	"Enable":                      "Włącz",
+	"Filter":                      "Filtruj",
+	"Generate":                    "Generuj",
+	"Generate new recovery codes": "Wygeneruj nowe kody zapasowe",
+	"Reject":                      "Odrzuć",
+	"Save":                        "Zapisz",
+	"Search":                      "Szukaj",
+	"Set up":                      "Skonfiguruj",
+	"Show":                        "Pokaż",
+	"Submit":                      "Wyślij",
+	"Unbook":                      "Odwołaj",
+	"Unlock":                      "Odblokuj",
+	"Verify":                      "Sprawdź",
+	"Reassign upcoming dates to":  "Przekaż nadchodzące terminy do",
+	"cancel":                      "odwołaj",
+	"delete":                      "usuń",
+	"edit":                        "edytuj",
+	"reassign":                    "przekaż",
+	"shift":                       "przesuń",
+	"download my data":            "pobierz moje dane",
+	"delete my account":           "usuń moje konto",
+	"delete user":                 "usuń użytkownika",
+	"export as CSV":               "eksportuj jako CSV",
+
+	// form labels
+	"Address of the page:":                  "Adres strony:",
+	"About me:":                             "O mnie:",
+	"Address of the photo:":                 "Adres zdjęcia:",
+	"Services, one per line:":               "Usługi, po jednej w wierszu:",
+	"From:":                                 "Od:",
+	"To:":                                   "Do:",
+	"Days of the week:":                     "Dni tygodnia:",
+	"Between:":                              "Między:",
+	"Length of the visit in minutes:":       "Długość wizyty w minutach:",
+	"Preferred employees:":                  "Preferowani pracownicy:",
+	"only the preferred employees":          "tylko preferowani pracownicy",
+	"Username:":                             "Nazwa użytkownika:",
+	"Password:":                             "Hasło:",
+	"Name:":                                 "Imię i nazwisko:",
+	"Email:":                                "E-mail:",
+	"Phone:":                                "Telefon:",
+	"Language:":                             "Język:",
+	"Label:":                                "Etykieta:",
+	"Role:":                                 "Rola:",
+	"Assign role:":                          "Przypisz rolę:",
+	"Secret:":                               "Sekret:",
+	"Fill from profile:":                    "Uzupełnij z profilu:",
+	"filled from profile:":                  "uzupełniane z profilu:",
+	"Required":                              "Wymagane",
+	"(required)":                            "(wymagane)",
+	"Authentication code:":                  "Kod uwierzytelniający:",
+	"Authentication code or recovery code:": "Kod uwierzytelniający lub kod zapasowy:",
+	"Authentication or recovery code:":      "Kod uwierzytelniający lub zapasowy:",
+	"New password (leave empty to keep the current one):":                                   "Nowe hasło (puste, aby zachować obecne):",
+	"Time zone (e.g. Europe/Warsaw, leave empty to use the one of the business):":           "Strefa czasowa (np. Europe/Warsaw, puste, aby użyć strefy firmy):",
+	"Time zone of the business (e.g. Europe/Warsaw, \"Local\" for the zone of the server):": "Strefa czasowa firmy (np. Europe/Warsaw, \"Local\" dla strefy serwera):",
+	"Minimum notice (hours before the visit):":                                              "Minimalne wyprzedzenie (godziny przed wizytą):",
+	"Limit of missed visits (0 turns it off):":                                              "Limit nieodbytych wizyt (0 go wyłącza):",
+	"Pending bookings expire after (hours, at the latest when the visit starts):":           "Oczekujące rezerwacje wygasają po (godzinach, najpóźniej z początkiem wizyty):",
+	"Allow late cancellations (they are flagged)":                                           "Zezwalaj na późne odwołania (są oznaczane)",
+	"Require a reason for cancellations":                                                    "Wymagaj podania powodu odwołania",
+	"Require two-factor authentication for employees and admins":                            "Wymagaj weryfikacji dwuetapowej od pracowników i administratorów",
+	"Bookings require approval":                                                             "Rezerwacje wymagają zatwierdzenia",
+	"require approval of bookings":                                                          "wymagaj zatwierdzania rezerwacji",
+	"Send me notifications by email":                                                        "Wysyłaj mi powiadomienia e-mailem",
+	"Remember this device for 30 days":                                                      "Zapamiętaj to urządzenie na 30 dni",
+	"start time:":                                                                           "początek:",
+	"end time:":                                                                             "koniec:",
+	"assign to:":                                                                            "przydziel do:",
+	"employee:":                                                                             "pracownik:",
+	"from:":                                                                                 "od:",
+	"to:":                                                                                   "do:",
+	"note:":                                                                                 "uwagi:",
+	"length in minutes:":                                                                    "długość w minutach:",
+	"reason shown to customers:":                                                            "powód widoczny dla klientów:",
+	"reassign to:":                                                                          "przekaż do:",
+	"shift by minutes (may be negative):":                                                   "przesuń o minut (może być ujemne):",
+	"with the selected dates:":                                                              "z zaznaczonymi terminami:",
+	"before:":                                                                               "przed:",
+	"after:":                                                                                "po:",
+	"name or username":                                                                      "imię lub nazwa użytkownika",
+	"actor id":                                                                              "id wykonującego",
+	"user id":                                                                               "id użytkownika",
+	"date id":                                                                               "id terminu",
+	"any action":                                                                            "dowolna akcja",
+	"date":                                                                                  "termin",
+	"user":                                                                                  "użytkownik",
+	"reason":                                                                                "powód",
+	"anonymous":                                                                             "anonimowy",
+	"everyone":                                                                              "wszyscy",
+	"nothing":                                                                               "nic",
+	"disabled":                                                                              "wyłączone",
+	"Disabled":                                                                              "Wyłączone",
+	"locked":                                                                                "zablokowane",
+	"not marked":                                                                            "nieoznaczone",
+	"block online booking":                                                                  "zablokuj rezerwacje online",
+	"browser default":                                                                       "jak w przeglądarce",
+	"English":                                                                               "English",
+	"Polski":                                                                                "Polski",
+
+	// descriptions
+	"No free dates in the next two weeks.":  "Brak wolnych terminów w najbliższych dwóch tygodniach.",
+	"No free dates match the search.":       "Żaden wolny termin nie pasuje do wyszukiwania.",
+	"Find the earliest date that suits you": "Znajdź najwcześniejszy pasujący termin",
+	"(late)":                                "(późno)",
+	"(%d missed visits)":                    "(nieodbyte wizyty: %d)",
+	"is booked by %s":                       "zarezerwowany przez: %s",
+	"booked by %s":                          "zarezerwowany przez: %s",
+	"booked by %s, cancelled %s by %s":      "zarezerwowany przez: %s, odwołany %s przez: %s",
+	"with %s, cancelled %s":                 "u: %s, odwołany %s",
+	"from %s":                               "od %s",
+	"awaiting approval until %s":            "czeka na zatwierdzenie do %s",
+	"collides with booked visits:":          "koliduje z zarezerwowanymi wizytami:",
+	"Cancellations (%d late):":              "Odwołania (późne: %d):",
+	"%d failed attempts, locked until %s":   "%d nieudana próba, zablokowane do %s|%d nieudane próby, zablokowane do %s|%d nieudanych prób, zablokowane do %s",
+	"%d upcoming bookings made by this user will be cancelled.": "Zostanie odwołana %d nadchodząca rezerwacja tego użytkownika.|Zostaną odwołane %d nadchodzące rezerwacje tego użytkownika.|Zostanie odwołanych %d nadchodzących rezerwacji tego użytkownika.",
+	"This user has %d upcoming dates, %d of them booked.":       "Ten użytkownik ma nadchodzące terminy: %d, w tym zarezerwowane: %d.",
+	"Delete %s (%s)?": "Usunąć %s (%s)?",
+	"Bookings should be cancelled at least %d hours before the visit.":                   "Rezerwacje należy odwoływać co najmniej %d godz. przed wizytą.",
+	"Later cancellations are not possible.":                                              "Późniejsze odwołanie nie jest możliwe.",
+	"Customers book dates without any additional questions.":                             "Klienci rezerwują terminy bez dodatkowych pytań.",
+	"Deleting these booked dates will cancel their bookings:":                            "Usunięcie tych zarezerwowanych terminów odwoła ich rezerwacje:",
+	"These booked dates will be handled by %s:":                                          "Tymi zarezerwowanymi terminami zajmie się: %s",
+	"These booked dates will be moved by %s minutes:":                                    "Te zarezerwowane terminy zostaną przesunięte o %s min:",
+	"Leave both times empty on days off.":                                                "W dni wolne zostaw oba pola puste.",
+	"Working hours and breaks are in the time zone of the business, %s.":                 "Godziny pracy i przerwy są w strefie czasowej firmy, %s.",
+	"This booking has to be confirmed, you will find the outcome on your bookings page.": "Ta rezerwacja musi zostać zatwierdzona, wynik znajdziesz na stronie swoich rezerwacji.",
+	"Past dates stay in the history of the other side.":                                  "Minione terminy pozostaną w historii drugiej strony.",
+	"You may want to download your data first.":                                          "Możesz najpierw pobrać swoje dane.",
+	"Your personal details and answers given when booking will be erased and your upcoming bookings cancelled. Past visits stay in the calendar of the employees as made by \"Deleted user\". This can't be undone.": "Twoje dane osobowe i odpowiedzi udzielone przy rezerwacji zostaną usunięte, a nadchodzące rezerwacje odwołane. Minione wizyty pozostaną w kalendarzu pracowników jako wizyty \"Usuniętego użytkownika\". Tego nie można cofnąć.",
+	"Two-factor authentication is disabled.":                                                                                                "Weryfikacja dwuetapowa jest wyłączona.",
+	"Two-factor authentication is enabled, %d recovery codes left.":                                                                         "Weryfikacja dwuetapowa jest włączona, został %d kod zapasowy.|Weryfikacja dwuetapowa jest włączona, zostały %d kody zapasowe.|Weryfikacja dwuetapowa jest włączona, zostało %d kodów zapasowych.",
+	"Two-factor authentication is required for your account.":                                                                               "Twoje konto wymaga weryfikacji dwuetapowej.",
+	"Scan the QR code generated from the link below with your authenticator app, or enter the secret manually.":                             "Zeskanuj w aplikacji uwierzytelniającej kod QR utworzony z poniższego linku albo wpisz sekret ręcznie.",
+	"Save these recovery codes somewhere safe, each of them can be used once instead of an authentication code. They won't be shown again.": "Zapisz te kody zapasowe w bezpiecznym miejscu, każdego z nich można raz użyć zamiast kodu uwierzytelniającego. Nie zostaną pokazane ponownie.",
+
+	// attendance, absences, profile fields and permissions
+	"attended":                               "obecny",
+	"no_show":                                "nieobecny",
+	"late":                                   "spóźniony",
+	"vacation":                               "urlop",
+	"sick_leave":                             "zwolnienie lekarskie",
+	"other":                                  "inna",
+	"name":                                   "imię i nazwisko",
+	"email":                                  "e-mail",
+	"phone":                                  "telefon",
+	"has own dates which customers can book": "ma własne terminy, które klienci mogą rezerwować",
+	"adds dates for any employee":            "dodaje terminy dowolnym pracownikom",
+	"creates users and assigns roles":        "tworzy użytkowników i przypisuje role",
+	"sees dates and bookings of all employees": "widzi terminy i rezerwacje wszystkich pracowników",
+	"cancels bookings of any customer":         "odwołuje rezerwacje dowolnych klientów",
+	"changes application settings":             "zmienia ustawienia aplikacji",
+	"browses and exports the audit log":        "przegląda i eksportuje dziennik zdarzeń",
+
+	// errors
+	"the date would overlap another date of the employee":             "termin nakładałby się na inny termin pracownika",
+	"some of the dates would overlap other dates of the employee":     "niektóre terminy nakładałyby się na inne terminy pracownika",
+	"you can't grant permissions you don't have yourself":             "nie możesz nadawać uprawnień, których sam nie masz",
+	"only administrators can assign the admin role":                   "tylko administratorzy mogą nadawać rolę administratora",
+	"you can't manage users with permissions you don't have yourself": "nie możesz zarządzać użytkownikami z uprawnieniami, których sam nie masz",
+	"the address can contain only small letters, digits and hyphens":  "adres może zawierać tylko małe litery, cyfry i myślniki",
+	"invalid address of the photo":                                    "nieprawidłowy adres zdjęcia",
+	"the address is already taken":                                    "ten adres jest już zajęty",
+	"invalid last day":                                                "nieprawidłowy ostatni dzień",
+	"at most two months can be searched at once":                      "jednorazowo można przeszukać najwyżej dwa miesiące",
+	"unknown day of the week":                                         "nieznany dzień tygodnia",
+	"invalid time of day":                                             "nieprawidłowa godzina",
+	"the end has to be after the start":                               "koniec musi być po początku",
+	"unknown employee":                                                "nieznany pracownik",
+	"invalid length of the visit":                                     "nieprawidłowa długość wizyty",
+	"Bad Request":                                                     "Nieprawidłowe żądanie",
+	"Forbidden":                                                       "Brak dostępu",
+	"Not Found":                                                       "Nie znaleziono",
+	"Method Not Allowed":                                              "Niedozwolona metoda",
+	"Too Many Requests":                                               "Zbyt wiele żądań",
+	"Internal Server Error":                                           "Wewnętrzny błąd serwera",
+	"Unauthorized":                                                    "Brak autoryzacji",
+	"invalid username or password":                                    "nieprawidłowa nazwa użytkownika lub hasło",
+	"too many failed login attempts, try again later":                 "zbyt wiele nieudanych prób logowania, spróbuj później",
+	"this account is disabled":                                        "to konto jest wyłączone",
+	"invalid or missing security token, please reload the page and try again": "nieprawidłowy lub brakujący token bezpieczeństwa, odśwież stronę i spróbuj ponownie",
+	"invalid authentication code":                                       "nieprawidłowy kod uwierzytelniający",
+	"two-factor authentication is required for your account":            "twoje konto wymaga weryfikacji dwuetapowej",
+	"you can't book online because of missed visits, please contact us": "nie możesz rezerwować online z powodu nieodbytych wizyt, skontaktuj się z nami",
+	"please fill in all required fields":                                "wypełnij wszystkie wymagane pola",
+	"this date has just been booked by someone else":                    "ten termin został właśnie zarezerwowany przez kogoś innego",
+	"this visit has already started and can't be cancelled":             "ta wizyta już się rozpoczęła i nie można jej odwołać",
+	"bookings can't be cancelled less than %d hours before the visit":   "rezerwacji nie można odwołać później niż %d godz. przed wizytą",
+	"please give a reason for the cancellation":                         "podaj powód odwołania",
+	"the employee is absent at that time":                               "pracownik jest wtedy nieobecny",
+	"this booking doesn't wait for approval anymore":                    "ta rezerwacja nie czeka już na zatwierdzenie",
+	"attendance can be marked only after the visit starts":              "obecność można oznaczyć dopiero po rozpoczęciu wizyty",
+	"invalid id":         "nieprawidłowy identyfikator",
+	"invalid start date": "nieprawidłowa data początkowa",
+	"invalid end date":   "nieprawidłowa data końcowa",
+	"booked dates can only be changed with bulk operations": "zarezerwowane terminy można zmieniać tylko operacjami zbiorczymi",
+	"booked dates can only be deleted with bulk operations": "zarezerwowane terminy można usuwać tylko operacjami zbiorczymi",
+	"invalid start time":                       "nieprawidłowy początek",
+	"invalid end time":                         "nieprawidłowy koniec",
+	"the date has been booked in the meantime": "termin został w międzyczasie zarezerwowany",
+	"no dates were selected":                   "nie zaznaczono żadnych terminów",
+	"invalid shift":                            "nieprawidłowe przesunięcie",
+	"some of the dates would fall into an absence of the employee": "niektóre terminy wypadłyby podczas nieobecności pracownika",
+	"name can't be empty":                                        "imię i nazwisko nie może być puste",
+	"username can't be empty":                                    "nazwa użytkownika nie może być pusta",
+	"password can't be empty":                                    "hasło nie może być puste",
+	"code can't be empty":                                        "kod nie może być pusty",
+	"this field is required":                                     "to pole jest wymagane",
+	"a role with this name already exists":                       "rola o tej nazwie już istnieje",
+	"label can't be empty":                                       "etykieta nie może być pusta",
+	"unknown role":                                               "nieznana rola",
+	"please correct the marked fields":                           "popraw zaznaczone pola",
+	"invalid email address":                                      "nieprawidłowy adres e-mail",
+	"email notifications need an email address":                  "powiadomienia e-mail wymagają adresu e-mail",
+	"unknown language":                                           "nieznany język",
+	"unknown time zone":                                          "nieznana strefa czasowa",
+	"staff accounts can only be removed by an administrator":     "konta personelu może usunąć tylko administrator",
+	"invalid password":                                           "nieprawidłowe hasło",
+	"invalid start of the absence":                               "nieprawidłowy początek nieobecności",
+	"invalid end of the absence":                                 "nieprawidłowy koniec nieobecności",
+	"invalid first day":                                          "nieprawidłowy pierwszy dzień",
+	"invalid last day, at most a year can be filled at once":     "nieprawidłowy ostatni dzień, jednorazowo można wypełnić najwyżej rok",
+	"invalid length of the dates":                                "nieprawidłowa długość terminów",
+	"minimum notice has to be a non-negative number of hours":    "minimalne wyprzedzenie musi być nieujemną liczbą godzin",
+	"limit of missed visits has to be a non-negative number":     "limit nieodbytych wizyt musi być nieujemną liczbą",
+	"approval time has to be a non-negative number of hours":     "czas na zatwierdzenie musi być nieujemną liczbą godzin",
+	"invalid action for missed visits":                           "nieprawidłowe działanie dla nieodbytych wizyt",
+	"you can't change your own role or disable your own account": "nie możesz zmienić własnej roli ani wyłączyć własnego konta",
+	"username is already taken":                                  "nazwa użytkownika jest już zajęta",
+	"you can't delete your own account":                          "nie możesz usunąć własnego konta",
+
+	// notifications
+	"%s asks to book %s.":                                                 "%s prosi o rezerwację terminu %s.",
+	"Your booking of %s has been confirmed.":                              "Twoja rezerwacja terminu %s została zatwierdzona.",
+	"Your booking of %s has been declined.":                               "Twoja rezerwacja terminu %s została odrzucona.",
+	"Your booking of %s wasn't confirmed in time and has been cancelled.": "Twoja rezerwacja terminu %s nie została zatwierdzona na czas i została odwołana.",
+	"Your booking of %s has been cancelled because the date was removed.": "Twoja rezerwacja terminu %s została odwołana, ponieważ termin usunięto.",
+	"Your booking of %s has been moved to %s.":                            "Twoja rezerwacja terminu %s została przeniesiona na %s.",
+	"Your visit on %s will be handled by %s.":                             "Twoją wizytą %s zajmie się: %s.",
+	"Reason: %s": "Powód: %s",
+}
@@ -0,0 +1,85 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+func newTestLogger(format Format, level Level) (*Logger, *bytes.Buffer) {
+	var buf bytes.Buffer
+	l := New(&buf, format, level)
+	l.out.now = func() time.Time { return time.Date(2030, 7, 1, 10, 0, 0, 0, time.UTC) }
+	return l, &buf
+}
+
+func TestLogfmt(t *testing.T) {
+	l, buf := newTestLogger(FormatLogfmt, LevelInfo)
+	l = l.With("request_id", "abc")
+	l.Debug("hidden")
+	l.Info("request", "path", "/book/1/", "status", 200, "duration", 1500*time.Millisecond)
+	l.Error("request failed", "error", errors.New(`no "such" table`), "odd key", "", "missing")
+
+	expected := `time=2030-07-01T10:00:00Z level=info msg=request request_id=abc path=/book/1/ status=200 duration=1.5s
+time=2030-07-01T10:00:00Z level=error msg="request failed" request_id=abc error="no \"such\" table" odd_key="" missing=!MISSING
+`
+	if buf.String() != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, buf.String())
+	}
+}
+
+func TestJSON(t *testing.T) {
+	l, buf := newTestLogger(FormatJSON, LevelDebug)
+	l.With("user_id", 4).Debug("query", "duration", time.Millisecond, "error", errors.New("failed"), "n", 1.5)
+
+	var line map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatalf("Invalid JSON %s: %v", buf.String(), err)
+	}
+	expected := map[string]interface{}{
+		"time":     "2030-07-01T10:00:00Z",
+		"level":    "debug",
+		"msg":      "query",
+		"user_id":  float64(4),
+		"duration": "1ms",
+		"error":    "failed",
+		"n":        1.5,
+	}
+	for k, v := range expected {
+		if line[k] != v {
+			t.Errorf("Expected %s to be %v, got %v", k, v, line[k])
+		}
+	}
+}
+
+func TestContext(t *testing.T) {
+	l, buf := newTestLogger(FormatLogfmt, LevelWarn)
+	if FromContext(context.Background()) != Default() {
+		t.Error("Expected the default logger without one in the context")
+	}
+	ctx := NewContext(context.Background(), l.With("request_id", "x"))
+	FromContext(ctx).Info("hidden")
+	FromContext(ctx).StdLogger(LevelWarn).Println("from the log package")
+	expected := "time=2030-07-01T10:00:00Z level=warn msg=\"from the log package\" request_id=x\n"
+	if buf.String() != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, buf.String())
+	}
+}
+
+func TestParse(t *testing.T) {
+	if level, err := ParseLevel("WARN"); err != nil || level != LevelWarn {
+		t.Errorf("Unexpected level %v %v", level, err)
+	}
+	if _, err := ParseLevel("loud"); err == nil {
+		t.Error("Expected an error for an unknown level")
+	}
+	if format, err := ParseFormat("json"); err != nil || format != FormatJSON {
+		t.Errorf("Unexpected format %v %v", format, err)
+	}
+	if _, err := ParseFormat("xml"); err == nil {
+		t.Error("Expected an error for an unknown format")
+	}
+}
@@ -0,0 +1,78 @@
+package metrics
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestTextFormat(t *testing.T) {
+	var r Registry
+	requests := NewCounter("requests_total", "Handled requests.", "route", "code")
+	latency := NewHistogram("latency_seconds", "Time of requests.", []float64{1, 0.1}, "route")
+	gauge := NewGaugeFunc("sessions", "Active\nsessions.", func() (float64, error) { return 3, nil })
+	r.Register(requests, latency, gauge)
+
+	requests.Inc("/b/", "200")
+	requests.Add(2, "/a/{id}/", "404")
+	requests.Inc("/quote\"/", "200")
+	latency.Observe(0.05, "/a/")
+	latency.Observe(0.5, "/a/")
+	latency.Observe(5, "/a/")
+
+	var out bytes.Buffer
+	if err := r.WriteText(&out); err != nil {
+		t.Fatal(err)
+	}
+	expected := `# HELP requests_total Handled requests.
+# TYPE requests_total counter
+requests_total{route="/a/{id}/",code="404"} 2
+requests_total{route="/b/",code="200"} 1
+requests_total{route="/quote\"/",code="200"} 1
+# HELP latency_seconds Time of requests.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{route="/a/",le="0.1"} 1
+latency_seconds_bucket{route="/a/",le="1"} 2
+latency_seconds_bucket{route="/a/",le="+Inf"} 3
+latency_seconds_sum{route="/a/"} 5.55
+latency_seconds_count{route="/a/"} 3
+# HELP sessions Active\nsessions.
+# TYPE sessions gauge
+sessions 3
+`
+	if out.String() != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, out.String())
+	}
+	if v := requests.Value("/a/{id}/", "404"); v != 2 {
+		t.Errorf("Expected 2, got %v", v)
+	}
+	if n := latency.Count("/a/"); n != 3 {
+		t.Errorf("Expected 3, got %v", n)
+	}
+}
+
+func TestFailingGauge(t *testing.T) {
+	var r Registry
+	failing := NewGaugeFunc("failing", "Fails.", func() (float64, error) { return 0, errors.New("broken") })
+	counter := NewCounter("after_total", "Written anyway.")
+	counter.Inc()
+	r.Register(failing, counter)
+
+	var out bytes.Buffer
+	if err := r.WriteText(&out); err == nil {
+		t.Error("Expected the error of the gauge")
+	}
+	if strings.Contains(out.String(), "failing") || !strings.Contains(out.String(), "after_total 1\n") {
+		t.Errorf("Unexpected output:\n%s", out.String())
+	}
+}
+
+func TestWrongLabels(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected a panic")
+		}
+	}()
+	NewCounter("c", "Counter.", "a", "b").Inc("only one")
+}
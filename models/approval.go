@@ -0,0 +1,147 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// a booking is pending while it has a row here, the date stays
+// booked by the customer so that nobody else can take it meanwhile
+const sqlPendingBookingTable = `
+DROP TABLE IF EXISTS pendingBookings;
+CREATE TABLE pendingBookings (
+	dateId    INTEGER PRIMARY KEY,
+	expiresAt INTEGER NOT NULL,
+	FOREIGN KEY(dateId) REFERENCES dates(id)
+);
+CREATE INDEX pendingBookingsExpiresAt ON pendingBookings(expiresAt);`
+
+// ErrNotPending is returned when approving or rejecting
+// a booking which doesn't wait for approval
+var ErrNotPending error = conflictError("booking is not pending")
+
+// RequestBooking atomically books a free date like BookDate,
+// but the booking waits for approval until expiresAt
+func RequestBooking(ctx context.Context, db *sql.DB, dateId int, userId int, answers map[int]string, expiresAt time.Time) error {
+	return bookDate(ctx, db, dateId, userId, answers, expiresAt)
+}
+
+const sqlPendingByDates = `
+SELECT dateId, expiresAt FROM pendingBookings WHERE dateId IN (%s)`
+
+// GetPendingBookings returns the expiration times of the given dates
+// which wait for approval, keyed by date id
+func GetPendingBookings(ctx context.Context, db *sql.DB, dateIds []int) (map[int]time.Time, error) {
+	pending := make(map[int]time.Time)
+	if len(dateIds) == 0 {
+		return pending, nil
+	}
+
+	args := make([]interface{}, len(dateIds))
+	for i, id := range dateIds {
+		args[i] = id
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(dateIds)), ",")
+	rows, err := db.QueryContext(ctx, strings.Replace(sqlPendingByDates, "%s", placeholders, 1), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		var expiresAt int64
+		if err := rows.Scan(&id, &expiresAt); err != nil {
+			return nil, err
+		}
+		pending[id] = fromUnix(expiresAt)
+	}
+	return pending, rows.Err()
+}
+
+// ApproveBooking confirms a pending booking
+func ApproveBooking(ctx context.Context, db *sql.DB, dateId int) error {
+	res, err := db.ExecContext(ctx, `DELETE FROM pendingBookings WHERE dateId = ?`, dateId)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n != 1 {
+		return ErrNotPending
+	}
+	return nil
+}
+
+// RejectBooking releases the date of a pending booking
+// and drops the answers given when booking
+func RejectBooking(ctx context.Context, db *sql.DB, dateId int) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = releasePending(ctx, tx, dateId); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func releasePending(ctx context.Context, tx *sql.Tx, dateId int) error {
+	res, err := tx.ExecContext(ctx, `DELETE FROM pendingBookings WHERE dateId = ?`, dateId)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n != 1 {
+		return ErrNotPending
+	}
+
+	if _, err = tx.ExecContext(ctx, `DELETE FROM bookingAnswers WHERE dateId = ?`, dateId); err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `UPDATE dates SET bookedBy = NULL WHERE id = ?`, dateId)
+	return err
+}
+
+const sqlPendingExpired = `
+SELECT dates.*
+FROM pendingBookings
+JOIN dates ON pendingBookings.dateId = dates.id
+WHERE pendingBookings.expiresAt <= ?`
+
+// ExpirePendingBookings releases the dates of pending bookings which
+// weren't approved in time and returns them as they were before
+func ExpirePendingBookings(ctx context.Context, db *sql.DB, now time.Time) ([]*Date, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, sqlPendingExpired, now.Unix())
+	if err != nil {
+		return nil, err
+	}
+	dates, err := readFromRows(rows, dateFromRow)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, d := range dates {
+		if err = releasePending(ctx, tx, d.Id); err != nil {
+			return nil, err
+		}
+	}
+	// holds of dates which were removed meanwhile
+	_, err = tx.ExecContext(ctx, `DELETE FROM pendingBookings WHERE expiresAt <= ?
+		AND dateId NOT IN (SELECT id FROM dates)`, now.Unix())
+	if err != nil {
+		return nil, err
+	}
+	return dates, tx.Commit()
+}
@@ -0,0 +1,117 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+const sqlAttendanceTable = `
+DROP TABLE IF EXISTS attendance;
+CREATE TABLE attendance (
+	dateId   INTEGER PRIMARY KEY,
+	status   TEXT NOT NULL,
+	markedBy INTEGER NOT NULL,
+	time     INTEGER NOT NULL,
+	FOREIGN KEY(dateId) REFERENCES dates(id)
+);`
+
+// statuses of past bookings set by employees
+const (
+	AttendanceAttended = "attended"
+	AttendanceNoShow   = "no_show"
+	AttendanceLate     = "late"
+)
+
+var AttendanceStatuses = []string{AttendanceAttended, AttendanceNoShow, AttendanceLate}
+
+func IsValidAttendance(status string) bool {
+	for _, s := range AttendanceStatuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+const sqlAttendanceSet = `
+INSERT INTO attendance (dateId, status, markedBy, time) VALUES (?, ?, ?, ?)
+ON CONFLICT(dateId) DO UPDATE SET
+	status = excluded.status, markedBy = excluded.markedBy, time = excluded.time`
+
+func SetAttendance(ctx context.Context, db *sql.DB, dateId int, status string, markedBy int) error {
+	_, err := db.ExecContext(ctx, sqlAttendanceSet, dateId, status, markedBy, time.Now().Unix())
+	return err
+}
+
+const sqlAttendanceByDates = `
+SELECT dateId, status FROM attendance WHERE dateId IN (%s)`
+
+// GetAttendance returns the statuses of the given dates keyed by date id,
+// dates without a status are left out
+func GetAttendance(ctx context.Context, db *sql.DB, dateIds []int) (map[int]string, error) {
+	statuses := make(map[int]string)
+	if len(dateIds) == 0 {
+		return statuses, nil
+	}
+
+	args := make([]interface{}, len(dateIds))
+	for i, id := range dateIds {
+		args[i] = id
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(dateIds)), ",")
+	rows, err := db.QueryContext(ctx, strings.Replace(sqlAttendanceByDates, "%s", placeholders, 1), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		var status string
+		if err := rows.Scan(&id, &status); err != nil {
+			return nil, err
+		}
+		statuses[id] = status
+	}
+	return statuses, rows.Err()
+}
+
+const sqlNoShowsByCustomer = `
+SELECT dates.bookedBy, COUNT(*)
+FROM attendance
+JOIN dates ON attendance.dateId = dates.id
+WHERE attendance.status = 'no_show' AND dates.bookedBy IS NOT NULL
+GROUP BY dates.bookedBy`
+
+// GetNoShowCounts returns the number of missed visits keyed by customer id
+func GetNoShowCounts(ctx context.Context, db *sql.DB) (map[int]int, error) {
+	rows, err := db.QueryContext(ctx, sqlNoShowsByCustomer)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[int]int)
+	for rows.Next() {
+		var userId, count int
+		if err := rows.Scan(&userId, &count); err != nil {
+			return nil, err
+		}
+		counts[userId] = count
+	}
+	return counts, rows.Err()
+}
+
+const sqlNoShowsOfCustomer = `
+SELECT COUNT(*)
+FROM attendance
+JOIN dates ON attendance.dateId = dates.id
+WHERE attendance.status = 'no_show' AND dates.bookedBy = ?`
+
+func CountNoShows(ctx context.Context, db *sql.DB, userId int) (int, error) {
+	var count int
+	err := db.QueryRowContext(ctx, sqlNoShowsOfCustomer, userId).Scan(&count)
+	return count, err
+}
@@ -0,0 +1,195 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// the audit log is append-only, the triggers reject any change to past
+// entries. Users are referenced only by their ids so that their names
+// disappear from the log with their accounts.
+const sqlAuditTable = `
+DROP TABLE IF EXISTS audit;
+CREATE TABLE audit (
+	id           INTEGER PRIMARY KEY AUTOINCREMENT,
+	time         INTEGER NOT NULL,
+	actorId      INTEGER,
+	action       TEXT NOT NULL,
+	target       TEXT NOT NULL,
+	targetUserId INTEGER,
+	targetDateId INTEGER,
+	before       TEXT NOT NULL,
+	after        TEXT NOT NULL,
+	ip           TEXT NOT NULL,
+	FOREIGN KEY(actorId) REFERENCES USER(id)
+);
+CREATE INDEX auditTime ON audit(time);
+CREATE TRIGGER auditNoUpdate BEFORE UPDATE ON audit
+BEGIN
+	SELECT RAISE(ABORT, 'audit log is append-only');
+END;
+CREATE TRIGGER auditNoDelete BEFORE DELETE ON audit
+BEGIN
+	SELECT RAISE(ABORT, 'audit log is append-only');
+END;`
+
+const (
+	AuditLogin        = "login"
+	AuditLoginFailed  = "login_failed"
+	AuditUnlockUser   = "unlock_user"
+	AuditEnableTotp   = "enable_totp"
+	AuditDisableTotp  = "disable_totp"
+	AuditEditSettings = "edit_settings"
+	AuditEditRole     = "edit_role"
+	AuditAssignRole   = "assign_role"
+	AuditAddUser      = "add_user"
+	AuditEditUser     = "edit_user"
+	AuditDeleteUser   = "delete_user"
+	AuditExportData   = "export_data"
+	AuditEraseAccount = "erase_account"
+	AuditBook         = "book"
+	AuditUnbook       = "unbook"
+	AuditAddDate      = "add_date"
+	AuditEditDate     = "edit_date"
+	AuditDeleteDate   = "delete_date"
+	AuditAttendance   = "attendance"
+	AuditApprove      = "approve_booking"
+	AuditReject       = "reject_booking"
+	AuditExpire       = "expire_booking"
+)
+
+// AuditActions lists all actions, for filtering the log
+var AuditActions = []string{
+	AuditLogin, AuditLoginFailed, AuditUnlockUser, AuditEnableTotp, AuditDisableTotp,
+	AuditEditSettings, AuditEditRole, AuditAssignRole, AuditAddUser, AuditEditUser,
+	AuditDeleteUser, AuditExportData, AuditEraseAccount, AuditBook, AuditUnbook, AuditAddDate,
+	AuditEditDate, AuditDeleteDate, AuditAttendance, AuditApprove, AuditReject, AuditExpire,
+}
+
+type AuditEntry struct {
+	Id           int
+	Time         time.Time
+	ActorId      int // NULL is translated to -1
+	ActorName    string
+	Action       string
+	Target       string // human readable description of the target, without names of users
+	TargetUserId int    // NULL is translated to -1
+	TargetName   string // the current name of the target user
+	TargetDateId int    // NULL is translated to -1
+	Before       string // state before the change, usually JSON
+	After        string // state after the change, usually JSON
+	IP           string // network of the client
+}
+
+func nullableId(id int) interface{} {
+	if id == -1 {
+		return nil
+	}
+	return id
+}
+
+func idFromNullable(id sql.NullInt32) int {
+	if !id.Valid {
+		return -1
+	}
+	return int(id.Int32)
+}
+
+func auditEntryFromRow(row scannable) (*AuditEntry, error) {
+	var e AuditEntry
+	var t int64
+	var actorId, targetUserId, targetDateId sql.NullInt32
+	err := row.Scan(&e.Id, &t, &actorId, &e.Action, &e.Target, &targetUserId, &targetDateId,
+		&e.Before, &e.After, &e.IP, &e.ActorName, &e.TargetName)
+	e.Time = fromUnix(t)
+	e.ActorId = idFromNullable(actorId)
+	e.TargetUserId = idFromNullable(targetUserId)
+	e.TargetDateId = idFromNullable(targetDateId)
+	return &e, err
+}
+
+const sqlAuditCreate = `
+INSERT INTO audit (time, actorId, action, target, targetUserId, targetDateId, before, after, ip)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+// AddAuditEntry appends the entry to the audit log. ActorId -1 means
+// that the action was performed anonymously, target ids -1 that there
+// is no such target. The time is set to now if it's zero.
+func AddAuditEntry(ctx context.Context, db *sql.DB, e *AuditEntry) error {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	_, err := db.ExecContext(ctx, sqlAuditCreate, e.Time.Unix(), nullableId(e.ActorId), e.Action, e.Target,
+		nullableId(e.TargetUserId), nullableId(e.TargetDateId), e.Before, e.After, e.IP)
+	return err
+}
+
+// AuditFilter restricts the entries returned by GetAuditEntries,
+// zero values match everything
+type AuditFilter struct {
+	Action       string
+	ActorId      int
+	TargetUserId int
+	TargetDateId int
+	From         time.Time
+	To           time.Time
+	Limit        int
+}
+
+const sqlAuditSelect = `
+SELECT audit.*, IFNULL(actor.name, ''), IFNULL(targetUser.name, '')
+FROM audit
+LEFT JOIN users actor ON audit.actorId = actor.id
+LEFT JOIN users targetUser ON audit.targetUserId = targetUser.id`
+
+// GetAuditEntries returns entries matching the filter, newest first
+func GetAuditEntries(ctx context.Context, db *sql.DB, f AuditFilter) ([]*AuditEntry, error) {
+	var conds []string
+	var args []interface{}
+	if f.Action != "" {
+		conds = append(conds, "audit.action = ?")
+		args = append(args, f.Action)
+	}
+	if f.ActorId != 0 {
+		conds = append(conds, "audit.actorId = ?")
+		args = append(args, f.ActorId)
+	}
+	if f.TargetUserId != 0 {
+		conds = append(conds, "audit.targetUserId = ?")
+		args = append(args, f.TargetUserId)
+	}
+	if f.TargetDateId != 0 {
+		conds = append(conds, "audit.targetDateId = ?")
+		args = append(args, f.TargetDateId)
+	}
+	if !f.From.IsZero() {
+		conds = append(conds, "audit.time >= ?")
+		args = append(args, f.From.Unix())
+	}
+	if !f.To.IsZero() {
+		conds = append(conds, "audit.time < ?")
+		args = append(args, f.To.Unix())
+	}
+
+	query := sqlAuditSelect
+	if len(conds) > 0 {
+		query += "\nWHERE " + strings.Join(conds, " AND ")
+	}
+	query += "\nORDER BY audit.id DESC"
+	if f.Limit > 0 {
+		query += "\nLIMIT ?"
+		args = append(args, f.Limit)
+	}
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return readFromRows(rows, auditEntryFromRow)
+}
+
+func GetAuditEntriesByActor(ctx context.Context, db *sql.DB, actorId int) ([]*AuditEntry, error) {
+	return GetAuditEntries(ctx, db, AuditFilter{ActorId: actorId})
+}
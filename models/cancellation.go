@@ -0,0 +1,186 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"time"
+)
+
+// cancellations keep a copy of the cancelled date,
+// as the date itself may be booked again or removed
+const sqlCancellationTable = `
+DROP TABLE IF EXISTS cancellations;
+CREATE TABLE cancellations (
+	id          INTEGER PRIMARY KEY AUTOINCREMENT,
+	dateId      INTEGER NOT NULL,
+	startTime   INTEGER NOT NULL,
+	endTime     INTEGER NOT NULL,
+	assignedTo  INTEGER NOT NULL,
+	bookedBy    INTEGER NOT NULL,
+	cancelledBy INTEGER NOT NULL,
+	time        INTEGER NOT NULL,
+	reason      TEXT NOT NULL,
+	late        BOOL NOT NULL
+);
+CREATE INDEX cancellationsBookedBy ON cancellations(bookedBy);
+CREATE INDEX cancellationsAssignedTo ON cancellations(assignedTo);`
+
+// CancellationPolicy decides when customers may cancel their bookings
+type CancellationPolicy struct {
+	MinNotice     time.Duration // cancelling later than this before the start is late
+	AllowLate     bool
+	RequireReason bool
+}
+
+// IsLate tells whether cancelling a date starting at start is late at the given time
+func (p *CancellationPolicy) IsLate(start time.Time, now time.Time) bool {
+	return now.Add(p.MinNotice).After(start)
+}
+
+// MinNoticeHours is used to display and edit the policy
+func (p *CancellationPolicy) MinNoticeHours() int {
+	return int(p.MinNotice / time.Hour)
+}
+
+// GetCancellationPolicy reads the policy from the settings,
+// by default cancelling is allowed at any time before the start
+func GetCancellationPolicy(ctx context.Context, db *sql.DB) (*CancellationPolicy, error) {
+	var p CancellationPolicy
+
+	hours, err := GetSetting(ctx, db, SettingCancelMinNoticeHours, "0")
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(hours)
+	if err != nil {
+		return nil, err
+	}
+	p.MinNotice = time.Duration(n) * time.Hour
+
+	if p.AllowLate, err = GetBoolSetting(ctx, db, SettingAllowLateCancel, true); err != nil {
+		return nil, err
+	}
+	if p.RequireReason, err = GetBoolSetting(ctx, db, SettingRequireCancelReason, false); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+type Cancellation struct {
+	Id              int
+	DateId          int
+	StartTime       time.Time
+	EndTime         time.Time
+	AssignedTo      int
+	BookedBy        int
+	CancelledBy     int
+	Time            time.Time
+	Reason          string
+	Late            bool
+	AssignedToName  string
+	BookedByName    string
+	CancelledByName string
+}
+
+func cancellationFromRow(row scannable) (*Cancellation, error) {
+	var c Cancellation
+	var start, end, t int64
+	err := row.Scan(&c.Id, &c.DateId, &start, &end, &c.AssignedTo, &c.BookedBy, &c.CancelledBy,
+		&t, &c.Reason, &c.Late, &c.AssignedToName, &c.BookedByName, &c.CancelledByName)
+	c.StartTime = fromUnix(start)
+	c.EndTime = fromUnix(end)
+	c.Time = fromUnix(t)
+	return &c, err
+}
+
+// ErrNotBooked is returned when cancelling a booking which no longer exists
+var ErrNotBooked error = conflictError("date is not booked")
+
+const sqlCancellationCreate = `
+INSERT INTO cancellations
+	(dateId, startTime, endTime, assignedTo, bookedBy, cancelledBy, time, reason, late)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+// CancelBooking atomically releases the date booked by date.BookedBy,
+// drops the answers and attendance of the booking and records the cancellation
+func CancelBooking(ctx context.Context, db *sql.DB, date *Date, cancelledBy int, reason string, late bool) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = cancelBooking(ctx, tx, date, cancelledBy, reason, late); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func cancelBooking(ctx context.Context, tx *sql.Tx, date *Date, cancelledBy int, reason string, late bool) error {
+	res, err := tx.ExecContext(ctx, `UPDATE dates SET bookedBy = NULL WHERE id = ? AND bookedBy = ?`,
+		date.Id, date.BookedBy)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n != 1 {
+		return ErrNotBooked
+	}
+
+	if _, err = tx.ExecContext(ctx, `DELETE FROM bookingAnswers WHERE dateId = ?`, date.Id); err != nil {
+		return err
+	}
+	if _, err = tx.ExecContext(ctx, `DELETE FROM attendance WHERE dateId = ?`, date.Id); err != nil {
+		return err
+	}
+	if _, err = tx.ExecContext(ctx, `DELETE FROM pendingBookings WHERE dateId = ?`, date.Id); err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, sqlCancellationCreate, date.Id, date.StartTime.Unix(), date.EndTime.Unix(),
+		date.AssignedTo, date.BookedBy, cancelledBy, time.Now().Unix(), reason, late)
+	return err
+}
+
+const sqlCancellationSelect = `
+SELECT cancellations.*, IFNULL(emp.name, ''), IFNULL(cus.name, ''), IFNULL(actor.name, '')
+FROM cancellations
+LEFT JOIN users emp ON cancellations.assignedTo = emp.id
+LEFT JOIN users cus ON cancellations.bookedBy = cus.id
+LEFT JOIN users actor ON cancellations.cancelledBy = actor.id`
+
+const sqlCancellationsBookedBy = sqlCancellationSelect + `
+WHERE cancellations.bookedBy = ?
+ORDER BY cancellations.startTime DESC`
+
+func GetCancellationsBookedBy(ctx context.Context, db *sql.DB, userId int) ([]*Cancellation, error) {
+	rows, err := db.QueryContext(ctx, sqlCancellationsBookedBy, userId)
+	if err != nil {
+		return nil, err
+	}
+	return readFromRows(rows, cancellationFromRow)
+}
+
+const sqlCancellationsAssignedTo = sqlCancellationSelect + `
+WHERE cancellations.assignedTo = ?
+ORDER BY cancellations.startTime DESC`
+
+func GetCancellationsAssignedTo(ctx context.Context, db *sql.DB, empId int) ([]*Cancellation, error) {
+	rows, err := db.QueryContext(ctx, sqlCancellationsAssignedTo, empId)
+	if err != nil {
+		return nil, err
+	}
+	return readFromRows(rows, cancellationFromRow)
+}
+
+const sqlCancellationsAll = sqlCancellationSelect + `
+ORDER BY cancellations.startTime DESC`
+
+func GetCancellationsAll(ctx context.Context, db *sql.DB) ([]*Cancellation, error) {
+	rows, err := db.QueryContext(ctx, sqlCancellationsAll)
+	if err != nil {
+		return nil, err
+	}
+	return readFromRows(rows, cancellationFromRow)
+}
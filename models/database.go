@@ -1,41 +1,38 @@
 package models
 
 import (
+	"context"
 	"database/sql"
 	"log"
 	"time"
-	"path"
-	"path/filepath"
-	"runtime"
-
-	_ "github.com/mattn/go-sqlite3"
 )
 
-func ConnectToDatabase(dbfilename string) *sql.DB {
-	_, b, _, _ := runtime.Caller(0)
-	basepath := filepath.Dir(b)
-	db, err := sql.Open("sqlite3", path.Join(basepath, "..", dbfilename))
-	if err != nil {
-		log.Fatal(err)
-	}
-	return db
-}
-
 type dbtype interface {
-	Exec(string, ...interface{}) (sql.Result, error)	
-	Query(string, ...interface{}) (*sql.Rows, error)
-	QueryRow(string, ...interface{}) *sql.Row
+	ExecContext(context.Context, string, ...interface{}) (sql.Result, error)
+	QueryContext(context.Context, string, ...interface{}) (*sql.Rows, error)
+	QueryRowContext(context.Context, string, ...interface{}) *sql.Row
 }
 
-func CreateNewTables(db *sql.DB) {
-	tables := []string{
-		sqlDateTable,
-		sqlUserTable,
-		sqlSessionTable,
-	}
+// tableQueries create the whole schema
+var tableQueries = []string{
+	sqlDateTable,
+	sqlRoleTable,
+	sqlUserTable,
+	sqlSessionTable,
+	sqlAuditTable,
+	sqlSettingTable,
+	sqlTwoFactorTables,
+	sqlFieldTables,
+	sqlCancellationTable,
+	sqlAttendanceTable,
+	sqlPendingBookingTable,
+	sqlNotificationTable,
+	sqlScheduleTables,
+}
 
-	for _, query := range tables {
-		if _, err := db.Exec(query); err != nil {
+func CreateNewTables(ctx context.Context, db *sql.DB) {
+	for _, query := range tableQueries {
+		if _, err := db.ExecContext(ctx, query); err != nil {
 			log.Print("query:", query, "\n")
 			log.Fatal(err)
 		}
@@ -59,21 +56,27 @@ func readFromRows[T any](rows *sql.Rows, callback func(scannable) (*T, error)) (
 	return items, nil
 }
 
-func FillWithSampleData(db *sql.DB) {
+// fromUnix reads a stored time, times are kept as Unix seconds and
+// returned in UTC so that they never depend on the zone of the server
+func fromUnix(t int64) time.Time {
+	return time.Unix(t, 0).UTC()
+}
+
+func FillWithSampleData(ctx context.Context, db *sql.DB) {
 	users := []User{
-		{Name: "Admin", Username: "admin", Password: "admin", UserType: UserTypeAdmin},
-		{Name: "Andrzej", Username: "pracownik", Password: "roku", UserType: UserTypeEmployee},
-		{Name: "Fabian", Username: "pracownik2", Password: "miesiaca", UserType: UserTypeEmployee},
-		{Name: "bob", Username: "bob", Password: "123", UserType: UserTypeCustomer},
+		{Name: "Admin", Username: "admin", Password: "admin", RoleId: RoleAdmin},
+		{Name: "Andrzej", Username: "pracownik", Password: "roku", RoleId: RoleEmployee},
+		{Name: "Fabian", Username: "pracownik2", Password: "miesiaca", RoleId: RoleEmployee},
+		{Name: "bob", Username: "bob", Password: "123", RoleId: RoleCustomer},
 	}
 	for _, c := range users {
-		if err := CreateUser(db, c.Name, c.Username, c.Password, c.UserType); err != nil {
+		if err := CreateUser(ctx, db, c.Name, c.Username, c.Password, c.RoleId); err != nil {
 			log.Fatal(err)
 		}
 	}
 
 	for _, username := range []string {"pracownik", "pracownik2"} {
-		emp, err := GetUserByUsername(db, username)
+		emp, err := GetUserByUsername(ctx, db, username)
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -81,7 +84,7 @@ func FillWithSampleData(db *sql.DB) {
 		for i := 1; i <= 5; i++ {
 			startTime := time.Now().Add(time.Duration(i) * time.Hour)
 			endTime := time.Now().Add(time.Duration(i+1) * time.Hour)
-			if err := CreateDate(db, startTime, endTime, emp.Id); err != nil {
+			if _, err := CreateDate(ctx, db, startTime, endTime, emp.Id); err != nil {
 				log.Fatal(err)
 			}
 		}
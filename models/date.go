@@ -1,7 +1,9 @@
 package models
 
 import (
+	"context"
 	"database/sql"
+	"strings"
 	"time"
 )
 
@@ -15,7 +17,9 @@ CREATE TABLE dates (
 	assignedTo INTEGER NOT NULL,
 	FOREIGN KEY(bookedBy) REFERENCES USER(id),
 	FOREIGN KEY(assignedTo) REFERENCES USER(id)
-);`
+);
+-- free dates are searched by their start, see SearchFreeDates
+CREATE INDEX datesFree ON dates(startTime) WHERE bookedBy IS NULL;`
 
 type Date struct {
 	Id         int
@@ -30,8 +34,8 @@ func dateFromRow(row scannable) (*Date, error) {
 	var start, end int64
 	var bookedBy sql.NullInt32
 	err := row.Scan(&u.Id, &start, &end, &bookedBy, &u.AssignedTo)
-	u.StartTime = time.Unix(start, 0)
-	u.EndTime = time.Unix(end, 0)
+	u.StartTime = fromUnix(start)
+	u.EndTime = fromUnix(end)
 	u.BookedBy = int(bookedBy.Int32)
 	if !bookedBy.Valid {
 		u.BookedBy = -1
@@ -50,8 +54,8 @@ func dateUserNamesFromRow(row scannable) (*DateWithNames, error) {
 	var start, end int64
 	var bookedBy sql.NullInt32
 	err := row.Scan(&u.Id, &start, &end, &bookedBy, &u.AssignedTo, &u.BookedByName, &u.AssignedToName)
-	u.StartTime = time.Unix(start, 0)
-	u.EndTime = time.Unix(end, 0)
+	u.StartTime = fromUnix(start)
+	u.EndTime = fromUnix(end)
 	u.BookedBy = int(bookedBy.Int32)
 	if !bookedBy.Valid {
 		u.BookedBy = -1
@@ -60,13 +64,13 @@ func dateUserNamesFromRow(row scannable) (*DateWithNames, error) {
 }
 
 const sqlDateAllNotBooked = `
-SELECT dates.*, '', emp.name
+SELECT dates.*, '', IFNULL(emp.name, '')
 FROM dates 
 LEFT JOIN users emp ON dates.assignedTo = emp.id
 WHERE bookedBy IS NULL`
 
-func GetDatesWithNamesNotBooked(db *sql.DB) ([]*DateWithNames, error) {
-	rows, err := db.Query(sqlDateAllNotBooked)
+func GetDatesWithNamesNotBooked(ctx context.Context, db *sql.DB) ([]*DateWithNames, error) {
+	rows, err := db.QueryContext(ctx, sqlDateAllNotBooked)
 	if err != nil {
 		return nil, err
 	}
@@ -74,18 +78,34 @@ func GetDatesWithNamesNotBooked(db *sql.DB) ([]*DateWithNames, error) {
 }
 
 const sqlDateCreate = `
-INSERT INTO dates (startTime, endTime, assignedTo) VALUES (?, ?, ?)`
+INSERT INTO dates (startTime, endTime, assignedTo)
+SELECT ?, ?, ?
+WHERE NOT EXISTS (SELECT 1 FROM absences WHERE userId = ? AND startTime < ? AND endTime > ?)`
 
-func CreateDate(db *sql.DB, startTime time.Time, endTime time.Time, assignedTo int) error {
-	_, err := db.Exec(sqlDateCreate, startTime.Unix(), endTime.Unix(), assignedTo)
-	return err
+// ErrEmployeeAbsent is returned when creating a date during an absence of the employee
+var ErrEmployeeAbsent error = conflictError("employee is absent at that time")
+
+// CreateDate adds a free date and returns its id
+func CreateDate(ctx context.Context, db *sql.DB, startTime time.Time, endTime time.Time, assignedTo int) (int, error) {
+	start, end := startTime.Unix(), endTime.Unix()
+	res, err := db.ExecContext(ctx, sqlDateCreate, start, end, assignedTo, assignedTo, end, start)
+	if err != nil {
+		return 0, err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return 0, err
+	} else if n != 1 {
+		return 0, ErrEmployeeAbsent
+	}
+	id, err := res.LastInsertId()
+	return int(id), err
 }
 
 const sqlDateBookedBy = `
 SELECT * FROM dates WHERE bookedBy = ?`
 
-func GetDatesBookedBy(db *sql.DB, userId int) ([]*Date, error) {
-	rows, err := db.Query(sqlDateBookedBy, userId)
+func GetDatesBookedBy(ctx context.Context, db *sql.DB, userId int) ([]*Date, error) {
+	rows, err := db.QueryContext(ctx, sqlDateBookedBy, userId)
 	if err != nil {
 		return nil, err
 	}
@@ -95,33 +115,106 @@ func GetDatesBookedBy(db *sql.DB, userId int) ([]*Date, error) {
 const sqlDateById = `
 SELECT * FROM dates WHERE id = ?`
 
-func GetDateById(db *sql.DB, id int) (*Date, error) {
-	row := db.QueryRow(sqlDateById, id)
-	return dateFromRow(row)
+func GetDateById(ctx context.Context, db *sql.DB, id int) (*Date, error) {
+	row := db.QueryRowContext(ctx, sqlDateById, id)
+	return single(dateFromRow(row))
+}
+
+const sqlDateWithNamesById = `
+SELECT dates.*, IFNULL(cus.name, ''), IFNULL(emp.name, '')
+FROM dates
+LEFT JOIN users cus ON dates.bookedBy = cus.Id
+LEFT JOIN users emp ON dates.assignedTo = emp.Id
+WHERE dates.id = ?`
+
+func GetDateWithNamesById(ctx context.Context, db *sql.DB, id int) (*DateWithNames, error) {
+	row := db.QueryRowContext(ctx, sqlDateWithNamesById, id)
+	return single(dateUserNamesFromRow(row))
 }
 
 const sqlDateSetBookedBy = `
 UPDATE dates SET bookedBy = ? WHERE id = ?`
 
-func SetDateBookedBy(db *sql.DB, dateId int, userId int) error {
-	var err error
+// SetDateBookedBy changes who booked the date, userId -1 releases it
+// and drops the answers given when booking
+func SetDateBookedBy(ctx context.Context, db *sql.DB, dateId int, userId int) error {
 	if userId != -1 {
-		_, err = db.Exec(sqlDateSetBookedBy, userId, dateId)
-	} else {
-		_, err = db.Exec(sqlDateSetBookedBy, nil, dateId)
+		_, err := db.ExecContext(ctx, sqlDateSetBookedBy, userId, dateId)
+		return err
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.ExecContext(ctx, sqlDateSetBookedBy, nil, dateId); err != nil {
+		return err
+	}
+	if _, err = tx.ExecContext(ctx, `DELETE FROM bookingAnswers WHERE dateId = ?`, dateId); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ErrDateTaken is returned when booking a date which is already booked
+var ErrDateTaken error = conflictError("date is already booked")
+
+const sqlDateBook = `
+UPDATE dates SET bookedBy = ? WHERE id = ? AND bookedBy IS NULL`
+
+// BookDate atomically books a free date and stores the answers
+// to the booking fields, keyed by field id
+func BookDate(ctx context.Context, db *sql.DB, dateId int, userId int, answers map[int]string) error {
+	return bookDate(ctx, db, dateId, userId, answers, time.Time{})
+}
+
+// bookDate books the date, holding it only until expiresAt
+// waiting for approval unless expiresAt is zero
+func bookDate(ctx context.Context, db *sql.DB, dateId int, userId int, answers map[int]string, expiresAt time.Time) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, sqlDateBook, userId, dateId)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n != 1 {
+		return ErrDateTaken
+	}
+
+	for fieldId, value := range answers {
+		_, err := tx.ExecContext(ctx, `INSERT INTO bookingAnswers (dateId, fieldId, value) VALUES (?, ?, ?)`,
+			dateId, fieldId, value)
+		if err != nil {
+			return err
+		}
+	}
+	if !expiresAt.IsZero() {
+		_, err := tx.ExecContext(ctx, `INSERT INTO pendingBookings (dateId, expiresAt) VALUES (?, ?)`,
+			dateId, expiresAt.Unix())
+		if err != nil {
+			return err
+		}
 	}
-	return err
+	return tx.Commit()
 }
 
 const sqlDateAssignedTo = `
-SELECT dates.*, IFNULL(cus.name, ''), emp.name
+SELECT dates.*, IFNULL(cus.name, ''), IFNULL(emp.name, '')
 FROM dates 
 LEFT JOIN users cus ON dates.bookedBy = cus.Id
 LEFT JOIN users emp ON dates.assignedTo = emp.Id
 WHERE assignedTo = ?`
 
-func GetDatesWithNamesAssignedTo(db *sql.DB, empId int) ([]*DateWithNames, error) {
-	rows, err := db.Query(sqlDateAssignedTo, empId)
+func GetDatesWithNamesAssignedTo(ctx context.Context, db *sql.DB, empId int) ([]*DateWithNames, error) {
+	rows, err := db.QueryContext(ctx, sqlDateAssignedTo, empId)
 	if err != nil {
 		return nil, err
 	}
@@ -129,15 +222,259 @@ func GetDatesWithNamesAssignedTo(db *sql.DB, empId int) ([]*DateWithNames, error
 }
 
 const sqlDateAll = `
-SELECT dates.*, IFNULL(cus.name, ''), emp.name
+SELECT dates.*, IFNULL(cus.name, ''), IFNULL(emp.name, '')
 FROM dates 
 LEFT JOIN users cus ON dates.bookedBy = cus.Id
 LEFT JOIN users emp ON dates.assignedTo = emp.Id`
 
-func GetDatesWithNamesAll(db *sql.DB) ([]*DateWithNames, error) {
-	rows, err := db.Query(sqlDateAll)
+func GetDatesWithNamesAll(ctx context.Context, db *sql.DB) ([]*DateWithNames, error) {
+	rows, err := db.QueryContext(ctx, sqlDateAll)
+	if err != nil {
+		return nil, err
+	}
+	return readFromRows(rows, dateUserNamesFromRow)
+}
+
+const sqlDateCountFutureAssignedTo = `
+SELECT COUNT(*), COUNT(bookedBy) FROM dates WHERE assignedTo = ? AND startTime > ?`
+
+// CountFutureDatesAssignedTo returns the number of upcoming dates
+// of the employee and how many of them are booked
+func CountFutureDatesAssignedTo(ctx context.Context, db *sql.DB, empId int) (int, int, error) {
+	var all, booked int
+	err := db.QueryRowContext(ctx, sqlDateCountFutureAssignedTo, empId, time.Now().Unix()).Scan(&all, &booked)
+	return all, booked, err
+}
+
+const sqlDateCountFutureBookedBy = `
+SELECT COUNT(*) FROM dates WHERE bookedBy = ? AND startTime > ?`
+
+func CountFutureDatesBookedBy(ctx context.Context, db *sql.DB, userId int) (int, error) {
+	var n int
+	err := db.QueryRowContext(ctx, sqlDateCountFutureBookedBy, userId, time.Now().Unix()).Scan(&n)
+	return n, err
+}
+
+const sqlDateFutureAssignedTo = `
+SELECT * FROM dates WHERE assignedTo = ? AND startTime > ? ORDER BY startTime`
+
+// GetFutureDatesAssignedTo returns the upcoming dates of the employee
+func GetFutureDatesAssignedTo(ctx context.Context, db *sql.DB, empId int) ([]*Date, error) {
+	rows, err := db.QueryContext(ctx, sqlDateFutureAssignedTo, empId, time.Now().Unix())
+	if err != nil {
+		return nil, err
+	}
+	return readFromRows(rows, dateFromRow)
+}
+
+const sqlDateFutureBookedBy = `
+SELECT * FROM dates WHERE bookedBy = ? AND startTime > ? ORDER BY startTime`
+
+// GetFutureDatesBookedBy returns the upcoming dates booked by the user
+func GetFutureDatesBookedBy(ctx context.Context, db *sql.DB, userId int) ([]*Date, error) {
+	rows, err := db.QueryContext(ctx, sqlDateFutureBookedBy, userId, time.Now().Unix())
+	if err != nil {
+		return nil, err
+	}
+	return readFromRows(rows, dateFromRow)
+}
+
+const sqlDateWithNamesBookedBy = `
+SELECT dates.*, IFNULL(cus.name, ''), IFNULL(emp.name, '')
+FROM dates
+LEFT JOIN users cus ON dates.bookedBy = cus.Id
+LEFT JOIN users emp ON dates.assignedTo = emp.Id
+WHERE bookedBy = ?
+ORDER BY startTime`
+
+func GetDatesWithNamesBookedBy(ctx context.Context, db *sql.DB, userId int) ([]*DateWithNames, error) {
+	rows, err := db.QueryContext(ctx, sqlDateWithNamesBookedBy, userId)
+	if err != nil {
+		return nil, err
+	}
+	return readFromRows(rows, dateUserNamesFromRow)
+}
+
+const sqlDateWithNamesBetween = `
+SELECT dates.*, IFNULL(cus.name, ''), IFNULL(emp.name, '')
+FROM dates
+LEFT JOIN users cus ON dates.bookedBy = cus.Id
+LEFT JOIN users emp ON dates.assignedTo = emp.Id
+WHERE (? = -1 OR assignedTo = ?) AND startTime >= ? AND startTime < ?
+ORDER BY startTime`
+
+// GetDatesWithNamesBetween returns dates of the employee starting
+// in the period, empId -1 returns dates of all employees
+func GetDatesWithNamesBetween(ctx context.Context, db *sql.DB, empId int, start time.Time, end time.Time) ([]*DateWithNames, error) {
+	rows, err := db.QueryContext(ctx, sqlDateWithNamesBetween, empId, empId, start.Unix(), end.Unix())
 	if err != nil {
 		return nil, err
 	}
 	return readFromRows(rows, dateUserNamesFromRow)
 }
+
+const sqlDatesByIds = `
+SELECT * FROM dates WHERE id IN (%s) ORDER BY startTime`
+
+func GetDatesByIds(ctx context.Context, db *sql.DB, ids []int) ([]*Date, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	placeholders := strings.Repeat("?, ", len(ids)-1) + "?"
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	rows, err := db.QueryContext(ctx, strings.Replace(sqlDatesByIds, "%s", placeholders, 1), args...)
+	if err != nil {
+		return nil, err
+	}
+	return readFromRows(rows, dateFromRow)
+}
+
+const sqlDateUpdate = `
+UPDATE dates SET startTime = ?, endTime = ?, assignedTo = ?
+WHERE id = ? AND NOT EXISTS (
+	SELECT 1 FROM absences WHERE userId = ? AND startTime < ? AND endTime > ?)`
+
+// ErrDatesOverlap is returned when a date would overlap another date of its employee
+var ErrDatesOverlap error = conflictError("date overlaps another date of the employee")
+
+const sqlDateOverlaps = `
+SELECT EXISTS (SELECT 1 FROM dates WHERE assignedTo = ? AND id != ? AND startTime < ? AND endTime > ?)`
+
+// checkOverlaps fails with ErrDatesOverlap if any of the dates overlaps another
+// date of its employee. It's run once all of them were moved, so that they
+// may take the places of each other.
+func checkOverlaps(ctx context.Context, tx *sql.Tx, dates []*Date) error {
+	for _, d := range dates {
+		var overlaps bool
+		err := tx.QueryRowContext(ctx, sqlDateOverlaps, d.AssignedTo, d.Id, d.EndTime.Unix(), d.StartTime.Unix()).Scan(&overlaps)
+		if err != nil {
+			return err
+		} else if overlaps {
+			return ErrDatesOverlap
+		}
+	}
+	return nil
+}
+
+// updateDate moves the date, failing with ErrEmployeeAbsent
+// if the employee is absent at the new time
+func updateDate(ctx context.Context, tx *sql.Tx, d *Date) error {
+	start, end := d.StartTime.Unix(), d.EndTime.Unix()
+	res, err := tx.ExecContext(ctx, sqlDateUpdate, start, end, d.AssignedTo, d.Id, d.AssignedTo, end, start)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n != 1 {
+		return ErrEmployeeAbsent
+	}
+	return nil
+}
+
+// UpdateDate changes the time and employee of a free date,
+// booked dates are only changed with MoveDates
+func UpdateDate(ctx context.Context, db *sql.DB, d *Date) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var bookedBy sql.NullInt32
+	if err = tx.QueryRowContext(ctx, `SELECT bookedBy FROM dates WHERE id = ?`, d.Id).Scan(&bookedBy); err == sql.ErrNoRows {
+		return ErrNotFound
+	} else if err != nil {
+		return err
+	} else if bookedBy.Valid {
+		return ErrDateTaken
+	}
+	if err = updateDate(ctx, tx, d); err != nil {
+		return err
+	}
+	if err = checkOverlaps(ctx, tx, []*Date{d}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// DeleteDate removes a free date, ErrDateTaken is returned if it's booked
+func DeleteDate(ctx context.Context, db *sql.DB, id int) error {
+	res, err := db.ExecContext(ctx, `DELETE FROM dates WHERE id = ? AND bookedBy IS NULL`, id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n != 1 {
+		return ErrDateTaken
+	}
+	return nil
+}
+
+// MoveDates saves new times and employees of the dates at once, keeping
+// their bookings. Nothing is changed if any of them would fall into
+// an absence or overlap another date of the employee.
+func MoveDates(ctx context.Context, db *sql.DB, dates []*Date) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = moveDates(ctx, tx, dates); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func moveDates(ctx context.Context, tx *sql.Tx, dates []*Date) error {
+	for _, d := range dates {
+		if err := updateDate(ctx, tx, d); err != nil {
+			return err
+		}
+	}
+	return checkOverlaps(ctx, tx, dates)
+}
+
+// DeleteDates removes the dates at once, bookings of booked ones
+// are recorded as cancelled by cancelledBy
+func DeleteDates(ctx context.Context, db *sql.DB, dates []*Date, cancelledBy int, reason string) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = deleteDates(ctx, tx, dates, cancelledBy, reason); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func deleteDates(ctx context.Context, tx *sql.Tx, dates []*Date, cancelledBy int, reason string) error {
+	now := time.Now().Unix()
+	for _, d := range dates {
+		if d.BookedBy != -1 {
+			_, err := tx.ExecContext(ctx, sqlCancellationCreate, d.Id, d.StartTime.Unix(), d.EndTime.Unix(),
+				d.AssignedTo, d.BookedBy, cancelledBy, now, reason, false)
+			if err != nil {
+				return err
+			}
+		}
+		for _, query := range []string{
+			`DELETE FROM bookingAnswers WHERE dateId = ?`,
+			`DELETE FROM attendance WHERE dateId = ?`,
+			`DELETE FROM pendingBookings WHERE dateId = ?`,
+			`DELETE FROM dates WHERE id = ?`,
+		} {
+			if _, err := tx.ExecContext(ctx, query, d.Id); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package models
+
+import (
+	"booker/logging"
+	"booker/metrics"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	sqlite3 "github.com/mattn/go-sqlite3"
+)
+
+// QueryDuration keeps timings of all statements run on databases opened
+// with ConnectToDatabase
+var QueryDuration = metrics.NewHistogram("booker_db_query_duration_seconds",
+	"Time spent running database statements.", metrics.DefaultBuckets, "operation")
+
+// slower statements are logged as warnings
+const slowQuery = 250 * time.Millisecond
+
+// ConnectToDatabase opens the database, every statement is given at most
+// queryTimeout to finish, zero means no limit besides the context
+func ConnectToDatabase(dbfilename string, queryTimeout time.Duration) *sql.DB {
+	d := timedDriver{&sqlite3.SQLiteDriver{}, queryTimeout}
+	return sql.OpenDB(timedConnector{d, dbfilename})
+}
+
+// observeQuery records the timing and logs the statement with the
+// logger of the context, which carries the ID of the request
+func observeQuery(ctx context.Context, operation string, query string, start time.Time) {
+	d := time.Since(start)
+	QueryDuration.Observe(d.Seconds(), operation)
+	logger := logging.FromContext(ctx)
+	if d >= slowQuery {
+		logger.Warn("slow query", "operation", operation, "query", strings.TrimSpace(query), "duration", d)
+	} else if logger.Enabled(logging.LevelDebug) {
+		logger.Debug("query", "operation", operation, "query", strings.TrimSpace(query), "duration", d)
+	}
+}
+
+// translateError turns violated unique constraints into ErrConflict
+func translateError(err error) error {
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) && (sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique ||
+		sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey) {
+		return fmt.Errorf("%w: %v", ErrConflict, err)
+	}
+	return err
+}
+
+type timedConnector struct {
+	driver timedDriver
+	name   string
+}
+
+func (c timedConnector) Connect(context.Context) (driver.Conn, error) {
+	return c.driver.Open(c.name)
+}
+
+func (c timedConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+// timedDriver measures how long statements of the wrapped driver take
+// and cancels those which take longer than the timeout.
+// For queries it's the time until the first rows are available.
+type timedDriver struct {
+	driver.Driver
+	timeout time.Duration
+}
+
+func (d timedDriver) Open(name string) (driver.Conn, error) {
+	c, err := d.Driver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &timedConn{c.(*sqlite3.SQLiteConn), d.timeout}, nil
+}
+
+type timedConn struct {
+	*sqlite3.SQLiteConn
+	timeout time.Duration
+}
+
+func (c *timedConn) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, c.timeout)
+}
+
+func (c *timedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	defer observeQuery(ctx, "exec", query, time.Now())
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+	res, err := c.SQLiteConn.ExecContext(ctx, query, args)
+	return res, translateError(err)
+}
+
+func (c *timedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	defer observeQuery(ctx, "query", query, time.Now())
+	ctx, cancel := c.withTimeout(ctx)
+	rows, err := c.SQLiteConn.QueryContext(ctx, query, args)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	return &timedRows{rows, cancel}, nil
+}
+
+// the transaction lives as long as its context,
+// only the statements run in it are limited
+func (c *timedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	defer observeQuery(ctx, "begin", "BEGIN", time.Now())
+	return c.SQLiteConn.BeginTx(ctx, opts)
+}
+
+// timedRows keep the timeout of the query running until they are closed,
+// sqlite reads the rows lazily
+type timedRows struct {
+	driver.Rows
+	cancel context.CancelFunc
+}
+
+func (r *timedRows) Close() error {
+	defer r.cancel()
+	return r.Rows.Close()
+}
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+)
+
+var (
+	// ErrNotFound is returned when the looked up row doesn't exist
+	ErrNotFound = errors.New("not found")
+	// ErrConflict is returned when a change clashes with the current
+	// state, like a taken username or a date booked in the meantime.
+	// The more specific errors of this package match it with errors.Is.
+	ErrConflict = errors.New("conflict")
+)
+
+// conflictError describes a conflict more closely
+type conflictError string
+
+func (e conflictError) Error() string {
+	return string(e)
+}
+
+func (e conflictError) Is(target error) bool {
+	return target == ErrConflict
+}
+
+// single returns the item read from a single row
+// or ErrNotFound when there was no row
+func single[T any](item *T, err error) (*T, error) {
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return item, err
+}
@@ -0,0 +1,153 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+)
+
+const sqlFieldTables = `
+DROP TABLE IF EXISTS bookingFields;
+CREATE TABLE bookingFields (
+	id           INTEGER PRIMARY KEY AUTOINCREMENT,
+	label        TEXT NOT NULL,
+	required     INTEGER NOT NULL,
+	profileField TEXT NOT NULL
+);
+DROP TABLE IF EXISTS bookingAnswers;
+CREATE TABLE bookingAnswers (
+	dateId  INTEGER NOT NULL,
+	fieldId INTEGER NOT NULL,
+	value   TEXT NOT NULL,
+	PRIMARY KEY(dateId, fieldId),
+	FOREIGN KEY(dateId) REFERENCES dates(id),
+	FOREIGN KEY(fieldId) REFERENCES bookingFields(id)
+);`
+
+// profile details which booking fields can be pre-filled with
+const (
+	ProfileFieldNone  = ""
+	ProfileFieldName  = "name"
+	ProfileFieldEmail = "email"
+	ProfileFieldPhone = "phone"
+)
+
+var ProfileFields = []string{ProfileFieldNone, ProfileFieldName, ProfileFieldEmail, ProfileFieldPhone}
+
+func IsValidProfileField(field string) bool {
+	for _, f := range ProfileFields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// ProfileValue returns the profile detail mapped to a booking field
+func (u *User) ProfileValue(field string) string {
+	switch field {
+	case ProfileFieldName:
+		return u.Name
+	case ProfileFieldEmail:
+		return u.Email
+	case ProfileFieldPhone:
+		return u.Phone
+	}
+	return ""
+}
+
+// BookingField is an additional question asked when booking a date
+type BookingField struct {
+	Id           int
+	Label        string
+	Required     bool
+	ProfileField string
+}
+
+func bookingFieldFromRow(row scannable) (*BookingField, error) {
+	var f BookingField
+	err := row.Scan(&f.Id, &f.Label, &f.Required, &f.ProfileField)
+	return &f, err
+}
+
+const sqlFieldAll = `
+SELECT * FROM bookingFields ORDER BY id`
+
+func GetBookingFields(ctx context.Context, db *sql.DB) ([]*BookingField, error) {
+	rows, err := db.QueryContext(ctx, sqlFieldAll)
+	if err != nil {
+		return nil, err
+	}
+	return readFromRows(rows, bookingFieldFromRow)
+}
+
+const sqlFieldCreate = `
+INSERT INTO bookingFields (label, required, profileField) VALUES (?, ?, ?)`
+
+func CreateBookingField(ctx context.Context, db *sql.DB, label string, required bool, profileField string) error {
+	_, err := db.ExecContext(ctx, sqlFieldCreate, label, required, profileField)
+	return err
+}
+
+// DeleteBookingField removes the field together with all answers to it
+func DeleteBookingField(ctx context.Context, db *sql.DB, id int) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM bookingAnswers WHERE fieldId = ?`, id); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM bookingFields WHERE id = ?`, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+type BookingAnswer struct {
+	DateId  int
+	FieldId int
+	Label   string
+	Value   string
+}
+
+func bookingAnswerFromRow(row scannable) (*BookingAnswer, error) {
+	var a BookingAnswer
+	err := row.Scan(&a.DateId, &a.FieldId, &a.Label, &a.Value)
+	return &a, err
+}
+
+const sqlAnswerByDates = `
+SELECT bookingAnswers.dateId, bookingAnswers.fieldId, bookingFields.label, bookingAnswers.value
+FROM bookingAnswers
+JOIN bookingFields ON bookingFields.id = bookingAnswers.fieldId
+WHERE bookingAnswers.dateId IN (%s)
+ORDER BY bookingAnswers.fieldId`
+
+// GetBookingAnswers returns answers given when booking the dates, by date id
+func GetBookingAnswers(ctx context.Context, db *sql.DB, dateIds []int) (map[int][]*BookingAnswer, error) {
+	byDate := make(map[int][]*BookingAnswer)
+	if len(dateIds) == 0 {
+		return byDate, nil
+	}
+
+	args := make([]interface{}, len(dateIds))
+	for i, id := range dateIds {
+		args[i] = id
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(dateIds)), ",")
+	rows, err := db.QueryContext(ctx, strings.Replace(sqlAnswerByDates, "%s", placeholders, 1), args...)
+	if err != nil {
+		return nil, err
+	}
+	answers, err := readFromRows(rows, bookingAnswerFromRow)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range answers {
+		byDate[a.DateId] = append(byDate[a.DateId], a)
+	}
+	return byDate, nil
+}
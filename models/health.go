@@ -0,0 +1,105 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const sqlCountActiveSessions = `
+SELECT COUNT(*) FROM sessions WHERE expiresAt > ?`
+
+func CountActiveSessions(ctx context.Context, db *sql.DB, now time.Time) (int, error) {
+	var n int
+	err := db.QueryRowContext(ctx, sqlCountActiveSessions, now.Unix()).Scan(&n)
+	return n, err
+}
+
+var createTable = regexp.MustCompile(`CREATE TABLE (\w+)`)
+
+var (
+	schemaOnce sync.Once
+	schema     map[string][]string
+	schemaErr  error
+)
+
+// expectedSchema creates the tables in memory to learn their columns
+func expectedSchema() (map[string][]string, error) {
+	schemaOnce.Do(func() {
+		var db *sql.DB
+		if db, schemaErr = sql.Open("sqlite3", ":memory:"); schemaErr != nil {
+			return
+		}
+		defer db.Close()
+		db.SetMaxOpenConns(1)
+		for _, query := range tableQueries {
+			if _, schemaErr = db.Exec(query); schemaErr != nil {
+				return
+			}
+		}
+		schema, schemaErr = readSchema(context.Background(), db)
+	})
+	return schema, schemaErr
+}
+
+// readSchema returns the sorted columns of every table of the schema
+func readSchema(ctx context.Context, db *sql.DB) (map[string][]string, error) {
+	tables := make(map[string][]string)
+	for _, query := range tableQueries {
+		for _, m := range createTable.FindAllStringSubmatch(query, -1) {
+			tables[m[1]] = nil
+		}
+	}
+	for table := range tables {
+		rows, err := db.QueryContext(ctx, `SELECT name FROM pragma_table_info(?)`, table)
+		if err != nil {
+			return nil, err
+		}
+		var columns []string
+		for rows.Next() {
+			var column string
+			if err = rows.Scan(&column); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			columns = append(columns, column)
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return nil, err
+		}
+		sort.Strings(columns)
+		tables[table] = columns
+	}
+	return tables, nil
+}
+
+// CheckSchema returns an error if the database can't be reached or its
+// tables differ from the ones created by CreateNewTables
+func CheckSchema(ctx context.Context, db *sql.DB) error {
+	expected, err := expectedSchema()
+	if err != nil {
+		return err
+	}
+	if err = db.PingContext(ctx); err != nil {
+		return err
+	}
+	actual, err := readSchema(ctx, db)
+	if err != nil {
+		return err
+	}
+	for table, columns := range expected {
+		if len(actual[table]) == 0 {
+			return fmt.Errorf("table %s is missing", table)
+		} else if strings.Join(actual[table], ",") != strings.Join(columns, ",") {
+			return fmt.Errorf("table %s has columns %s instead of %s", table,
+				strings.Join(actual[table], ", "), strings.Join(columns, ", "))
+		}
+	}
+	return nil
+}
@@ -2,15 +2,20 @@ package models_test
 
 import (
 	"booker/models"
+	"context"
 	"database/sql"
+	"errors"
 	"testing"
 	"time"
 )
 
+// ctx is passed to all calls of the tests
+var ctx = context.Background()
+
 func initTestingDB() *sql.DB {
-	db := models.ConnectToDatabase("testing.db")
-	models.CreateNewTables(db)
-	models.FillWithSampleData(db)
+	db := models.ConnectToDatabase("testing.db", 0)
+	models.CreateNewTables(ctx, db)
+	models.FillWithSampleData(ctx, db)
 	return db
 }
 
@@ -22,7 +27,7 @@ func checkError(t *testing.T, err error) {
 
 func TestDate(t *testing.T) {
 	db := initTestingDB()
-	dates, err := models.GetDatesWithNamesNotBooked(db)
+	dates, err := models.GetDatesWithNamesNotBooked(ctx, db)
 	checkError(t, err)
 
 	date := dates[0]
@@ -32,9 +37,9 @@ func TestDate(t *testing.T) {
 
 	dateId := date.Id
 	const userId = 123
-	checkError(t, models.SetDateBookedBy(db, dateId, userId))
+	checkError(t, models.SetDateBookedBy(ctx, db, dateId, userId))
 
-	newDate, err := models.GetDateById(db, dateId)
+	newDate, err := models.GetDateById(ctx, db, dateId)
 	checkError(t, err)
 	if newDate.BookedBy != userId {
 		t.Errorf("date booked by %d .BookedBy = %d", userId, newDate.BookedBy)
@@ -44,7 +49,7 @@ func TestDate(t *testing.T) {
 	}
 
 	var bookedDates []*models.Date
-	bookedDates, err = models.GetDatesBookedBy(db, userId)
+	bookedDates, err = models.GetDatesBookedBy(ctx, db, userId)
 	if len(bookedDates) != 1 {
 		t.Errorf("received too many dates")
 	}
@@ -53,15 +58,35 @@ func TestDate(t *testing.T) {
 	}
 }
 
-func checkUserType(t *testing.T, u *models.User, expectedUserType int) {
-	if u.IsAdmin() != (expectedUserType == models.UserTypeAdmin) {
-		t.Errorf("u.IsAdmin: unexpected result")
+func TestBookDate(t *testing.T) {
+	db := initTestingDB()
+
+	checkError(t, models.CreateBookingField(ctx, db, "Phone", true, models.ProfileFieldPhone))
+	checkError(t, models.BookDate(ctx, db, 1, 4, map[int]string{1: "555"}))
+	if err := models.BookDate(ctx, db, 1, 3, nil); err != models.ErrDateTaken {
+		t.Errorf("booking a booked date: expected ErrDateTaken, got %v", err)
+	}
+
+	answers, err := models.GetBookingAnswers(ctx, db, []int{1, 2})
+	checkError(t, err)
+	if len(answers[1]) != 1 || answers[1][0].Value != "555" || answers[1][0].Label != "Phone" {
+		t.Errorf("unexpected answers: %v", answers)
 	}
-	if u.IsEmployee() != (expectedUserType <= models.UserTypeEmployee) {
-		t.Errorf("u.IsEmployee: unexpected result")
+	checkArraySize(t, answers[2], 0)
+}
+
+func checkUserPermissions(t *testing.T, u *models.User, expected ...string) {
+	for _, p := range models.Permissions {
+		want := false
+		for _, e := range expected {
+			want = want || e == p.Name
+		}
+		if u.Can(p.Name) != want {
+			t.Errorf("u.Can(%s): unexpected result", p.Name)
+		}
 	}
-	if u.IsCustomer() != true {
-		t.Errorf("u.IsCustomer: unexpected result")
+	if u.IsStaff() != (len(expected) > 0) {
+		t.Errorf("u.IsStaff: unexpected result")
 	}
 }
 
@@ -78,21 +103,646 @@ func TestUser(t *testing.T) {
 
 	db := initTestingDB()
 
-	admin, err := models.GetUserById(db, adminId)
+	admin, err := models.GetUserById(ctx, db, adminId)
 	checkError(t, err)
-	checkUserType(t, admin, models.UserTypeAdmin)
+	allPermissions := []string{}
+	for _, p := range models.Permissions {
+		allPermissions = append(allPermissions, p.Name)
+	}
+	checkUserPermissions(t, admin, allPermissions...)
 
-	employee, err := models.GetUserById(db, employeeId)
+	employee, err := models.GetUserById(ctx, db, employeeId)
 	checkError(t, err)
-	checkUserType(t, employee, models.UserTypeEmployee)
+	checkUserPermissions(t, employee, models.PermOwnSlots)
 
-	customer, err := models.GetUserById(db, customerId)
+	customer, err := models.GetUserById(ctx, db, customerId)
 	checkError(t, err)
-	checkUserType(t, customer, models.UserTypeCustomer)
+	checkUserPermissions(t, customer)
 
-	admins, err := models.GetUsersByType(db, models.UserTypeAdmin)
+	admins, err := models.GetUsersWithPermission(ctx, db, models.PermManageUsers)
 	checkError(t, err)
 	checkArraySize(t, admins, 1)
+
+	employees, err := models.GetUsersWithPermission(ctx, db, models.PermOwnSlots)
+	checkError(t, err)
+	checkArraySize(t, employees, 3)
+
+	checkError(t, models.SetUserLoginFailures(ctx, db, customerId, 10, time.Now().Add(time.Hour)))
+	customer, err = models.GetUserById(ctx, db, customerId)
+	checkError(t, err)
+	if !customer.IsLocked() || customer.FailedLogins != 10 {
+		t.Errorf("user should be locked")
+	}
+
+	locked, err := models.GetLockedUsers(ctx, db)
+	checkError(t, err)
+	checkArraySize(t, locked, 1)
+
+	checkError(t, models.UnlockUser(ctx, db, customerId))
+	locked, err = models.GetLockedUsers(ctx, db)
+	checkError(t, err)
+	checkArraySize(t, locked, 0)
+}
+
+func TestRole(t *testing.T) {
+	const customerId = 4
+
+	db := initTestingDB()
+
+	roleId, err := models.CreateRole(ctx, db, "Receptionist", []string{models.PermViewAllBookings})
+	checkError(t, err)
+	checkError(t, models.SetUserRole(ctx, db, customerId, roleId))
+
+	u, err := models.GetUserById(ctx, db, customerId)
+	checkError(t, err)
+	checkUserPermissions(t, u, models.PermViewAllBookings)
+	if u.RoleName != "Receptionist" {
+		t.Errorf("u.RoleName = %s", u.RoleName)
+	}
+
+	checkError(t, models.SetRolePermissions(ctx, db, roleId, []string{models.PermOwnSlots, models.PermManageSlots}))
+	role, err := models.GetRoleById(ctx, db, roleId)
+	checkError(t, err)
+	if !role.Has(models.PermOwnSlots) || !role.Has(models.PermManageSlots) || role.Has(models.PermViewAllBookings) {
+		t.Errorf("role permissions were not replaced: %v", role.Permissions)
+	}
+
+	roles, err := models.GetRoles(ctx, db)
+	checkError(t, err)
+	checkArraySize(t, roles, 4)
+}
+
+func TestUserSearchAndDelete(t *testing.T) {
+	const customerId = 4
+	const employeeId = 2
+
+	db := initTestingDB()
+
+	users, err := models.SearchUsers(ctx, db, "pracownik")
+	checkError(t, err)
+	checkArraySize(t, users, 2)
+	users, err = models.SearchUsers(ctx, db, "%")
+	checkError(t, err)
+	checkArraySize(t, users, 0)
+
+	dates, err := models.GetDatesWithNamesAssignedTo(ctx, db, employeeId)
+	checkError(t, err)
+	checkError(t, models.SetDateBookedBy(ctx, db, dates[0].Id, customerId))
+
+	booked, err := models.CountFutureDatesBookedBy(ctx, db, customerId)
+	checkError(t, err)
+	if booked != 1 {
+		t.Errorf("customer should have 1 booking, has %d", booked)
+	}
+
+	_, bookings, err := models.DeleteUser(ctx, db, customerId, -1, 1, "")
+	checkError(t, err)
+	checkArraySize(t, bookings, 1)
+	date, err := models.GetDateById(ctx, db, dates[0].Id)
+	checkError(t, err)
+	if date.BookedBy != -1 {
+		t.Errorf("booking of the deleted user should be released")
+	}
+	cancellations, err := models.GetCancellationsAssignedTo(ctx, db, employeeId)
+	checkError(t, err)
+	checkArraySize(t, cancellations, 1)
+
+	// the dates can't be taken over by an employee who is busy at the time
+	_, err = models.CreateDate(ctx, db, dates[1].StartTime, dates[1].EndTime, 3)
+	checkError(t, err)
+	if _, _, err = models.DeleteUser(ctx, db, employeeId, 3, 1, ""); err != models.ErrDatesOverlap {
+		t.Errorf("reassigning onto other dates should fail, got %v", err)
+	}
+
+	checkError(t, models.SetDateBookedBy(ctx, db, dates[0].Id, 3))
+	deleted, _, err := models.DeleteUser(ctx, db, employeeId, -1, 1, "")
+	checkError(t, err)
+	checkArraySize(t, deleted, len(dates))
+	all, _, err := models.CountFutureDatesAssignedTo(ctx, db, employeeId)
+	checkError(t, err)
+	if all != 0 {
+		t.Errorf("dates of the deleted employee should be removed")
+	}
+	cancellations, err = models.GetCancellationsBookedBy(ctx, db, 3)
+	checkError(t, err)
+	checkArraySize(t, cancellations, 1)
+}
+
+func TestAudit(t *testing.T) {
+	db := initTestingDB()
+
+	checkError(t, models.AddAuditEntry(ctx, db, &models.AuditEntry{
+		ActorId: -1, Action: models.AuditLoginFailed, Target: "nobody",
+		TargetUserId: -1, TargetDateId: -1, IP: "127.0.0.1",
+	}))
+	checkError(t, models.AddAuditEntry(ctx, db, &models.AuditEntry{
+		ActorId: 1, Action: models.AuditLogin, Target: "admin",
+		TargetUserId: 1, TargetDateId: -1, IP: "127.0.0.1",
+	}))
+	checkError(t, models.AddAuditEntry(ctx, db, &models.AuditEntry{
+		ActorId: 4, Action: models.AuditBook, Target: "Andrzej",
+		TargetUserId: 2, TargetDateId: 1, Before: `{"bookedBy":-1}`, After: `{"bookedBy":4}`, IP: "127.0.0.1",
+	}))
+
+	entries, err := models.GetAuditEntries(ctx, db, models.AuditFilter{})
+	checkError(t, err)
+	checkArraySize(t, entries, 3)
+	if entries[1].ActorId != 1 || entries[2].ActorId != -1 || entries[1].ActorName != "Admin" {
+		t.Errorf("audit entries in invalid order or with invalid actors")
+	}
+
+	entries, err = models.GetAuditEntries(ctx, db, models.AuditFilter{TargetDateId: 1})
+	checkError(t, err)
+	checkArraySize(t, entries, 1)
+	if entries[0].After != `{"bookedBy":4}` || entries[0].TargetUserId != 2 {
+		t.Errorf("invalid audit entry %+v", entries[0])
+	}
+
+	entries, err = models.GetAuditEntries(ctx, db, models.AuditFilter{Action: models.AuditLogin, ActorId: 1})
+	checkError(t, err)
+	checkArraySize(t, entries, 1)
+
+	entries, err = models.GetAuditEntries(ctx, db, models.AuditFilter{From: time.Now().Add(time.Hour)})
+	checkError(t, err)
+	checkArraySize(t, entries, 0)
+
+	// the log is append-only
+	if _, err = db.Exec(`UPDATE audit SET action = 'login'`); err == nil {
+		t.Errorf("audit entries shouldn't be modifiable")
+	}
+	if _, err = db.Exec(`DELETE FROM audit`); err == nil {
+		t.Errorf("audit entries shouldn't be deletable")
+	}
+}
+
+func TestCancelBooking(t *testing.T) {
+	db := initTestingDB()
+	const bobId = 4
+
+	checkError(t, models.SetDateBookedBy(ctx, db, 1, bobId))
+	date, err := models.GetDateById(ctx, db, 1)
+	checkError(t, err)
+
+	checkError(t, models.CancelBooking(ctx, db, date, bobId, "sick", true))
+	if err := models.CancelBooking(ctx, db, date, bobId, "sick", true); err != models.ErrNotBooked {
+		t.Errorf("expected ErrNotBooked when cancelling twice, got %v", err)
+	}
+
+	date, err = models.GetDateById(ctx, db, 1)
+	checkError(t, err)
+	if date.BookedBy != -1 {
+		t.Errorf("cancelled date should be free")
+	}
+
+	cancellations, err := models.GetCancellationsBookedBy(ctx, db, bobId)
+	checkError(t, err)
+	checkArraySize(t, cancellations, 1)
+	if !cancellations[0].Late || cancellations[0].Reason != "sick" || cancellations[0].AssignedToName != "Andrzej" {
+		t.Errorf("invalid cancellation %+v", cancellations[0])
+	}
+
+	policy, err := models.GetCancellationPolicy(ctx, db)
+	checkError(t, err)
+	if !policy.AllowLate || policy.IsLate(date.StartTime, time.Now()) {
+		t.Errorf("by default cancellations shouldn't be late")
+	}
+}
+
+func TestAttendance(t *testing.T) {
+	db := initTestingDB()
+	const bobId = 4
+
+	checkError(t, models.SetDateBookedBy(ctx, db, 1, bobId))
+	checkError(t, models.SetDateBookedBy(ctx, db, 2, bobId))
+	checkError(t, models.SetAttendance(ctx, db, 1, models.AttendanceNoShow, 2))
+	checkError(t, models.SetAttendance(ctx, db, 2, models.AttendanceAttended, 2))
+	checkError(t, models.SetAttendance(ctx, db, 2, models.AttendanceNoShow, 2))
+
+	statuses, err := models.GetAttendance(ctx, db, []int{1, 2, 3})
+	checkError(t, err)
+	if len(statuses) != 2 || statuses[2] != models.AttendanceNoShow {
+		t.Errorf("invalid attendance %v", statuses)
+	}
+
+	count, err := models.CountNoShows(ctx, db, bobId)
+	checkError(t, err)
+	counts, err := models.GetNoShowCounts(ctx, db)
+	checkError(t, err)
+	if count != 2 || counts[bobId] != 2 {
+		t.Errorf("expected 2 no-shows, got %d and %v", count, counts)
+	}
+}
+
+func TestPendingBookings(t *testing.T) {
+	db := initTestingDB()
+	const bobId = 4
+
+	expiresAt := time.Now().Add(time.Minute)
+	checkError(t, models.RequestBooking(ctx, db, 1, bobId, map[int]string{}, expiresAt))
+	checkError(t, models.RequestBooking(ctx, db, 2, bobId, map[int]string{}, expiresAt))
+	if err := models.RequestBooking(ctx, db, 1, bobId, nil, expiresAt); err != models.ErrDateTaken {
+		t.Errorf("pending booking should hold the date, got %v", err)
+	}
+
+	checkError(t, models.ApproveBooking(ctx, db, 1))
+	if err := models.ApproveBooking(ctx, db, 1); err != models.ErrNotPending {
+		t.Errorf("expected ErrNotPending, got %v", err)
+	}
+
+	expired, err := models.ExpirePendingBookings(ctx, db, time.Now())
+	checkError(t, err)
+	checkArraySize(t, expired, 0)
+	expired, err = models.ExpirePendingBookings(ctx, db, expiresAt)
+	checkError(t, err)
+	checkArraySize(t, expired, 1)
+	if expired[0].Id != 2 || expired[0].BookedBy != bobId {
+		t.Errorf("invalid expired booking %+v", expired[0])
+	}
+
+	dates, err := models.GetDatesBookedBy(ctx, db, bobId)
+	checkError(t, err)
+	checkArraySize(t, dates, 1)
+
+	checkError(t, models.CreateNotification(ctx, db, bobId, "hello"))
+	notifications, err := models.GetUnreadNotifications(ctx, db, bobId)
+	checkError(t, err)
+	checkArraySize(t, notifications, 1)
+	checkError(t, models.MarkNotificationsRead(ctx, db, bobId))
+	notifications, err = models.GetUnreadNotifications(ctx, db, bobId)
+	checkError(t, err)
+	checkArraySize(t, notifications, 0)
+}
+
+func TestPlanSlots(t *testing.T) {
+	loc := time.UTC
+	// 2030-01-07 is a Monday
+	monday := time.Date(2030, 1, 7, 0, 0, 0, 0, loc)
+	hours := []*models.WorkingHours{{Weekday: time.Monday, Start: 9 * 60, End: 12 * 60}}
+	breaks := []*models.Break{{Weekday: time.Monday, Start: 10 * 60, End: 11 * 60}}
+
+	slots := models.PlanSlots(hours, breaks, nil, monday, monday.AddDate(0, 0, 6), 30*time.Minute, loc)
+	checkArraySize(t, slots, 4)
+	if !slots[2].StartTime.Equal(monday.Add(11 * time.Hour)) {
+		t.Errorf("expected the break to be skipped, got %v", slots[2].StartTime)
+	}
+
+	absences := []*models.Absence{{StartTime: monday.Add(11 * time.Hour), EndTime: monday.Add(24 * time.Hour)}}
+	slots = models.PlanSlots(hours, breaks, absences, monday, monday.AddDate(0, 0, 7), 30*time.Minute, loc)
+	checkArraySize(t, slots, 6)
+
+	// wall clock times are kept across the change to summer time
+	warsaw, err := time.LoadLocation("Europe/Warsaw")
+	checkError(t, err)
+	// 2030-03-31 is the Sunday when clocks go forward
+	hours = []*models.WorkingHours{
+		{Weekday: time.Saturday, Start: 9 * 60, End: 10 * 60},
+		{Weekday: time.Monday, Start: 9 * 60, End: 10 * 60},
+	}
+	from := time.Date(2030, 3, 30, 0, 0, 0, 0, warsaw)
+	slots = models.PlanSlots(hours, nil, nil, from, from.AddDate(0, 0, 2), time.Hour, warsaw)
+	checkArraySize(t, slots, 2)
+	for _, slot := range slots {
+		if h := slot.StartTime.In(warsaw).Hour(); h != 9 {
+			t.Errorf("expected the slot at 9:00, got %v", slot.StartTime.In(warsaw))
+		}
+	}
+	if d := slots[1].StartTime.Sub(slots[0].StartTime); d != 47*time.Hour {
+		t.Errorf("expected 47 hours between slots, got %v", d)
+	}
+
+	// 2030-10-27 is the Sunday when clocks go back, 1:00-4:00 lasts four hours
+	hours = []*models.WorkingHours{{Weekday: time.Sunday, Start: 60, End: 4 * 60}}
+	from = time.Date(2030, 10, 27, 0, 0, 0, 0, warsaw)
+	slots = models.PlanSlots(hours, nil, nil, from, from, time.Hour, warsaw)
+	checkArraySize(t, slots, 3)
+	if d := slots[2].EndTime.Sub(slots[0].StartTime); d != 4*time.Hour {
+		t.Errorf("expected the slots to span 4 hours, got %v", d)
+	}
+}
+
+func TestAbsences(t *testing.T) {
+	db := initTestingDB()
+	const andrzejId = 2
+	const bobId = 4
+
+	dates, err := models.GetDatesWithNamesAssignedTo(ctx, db, andrzejId)
+	checkError(t, err)
+	checkArraySize(t, dates, 5)
+	checkError(t, models.SetDateBookedBy(ctx, db, dates[1].Id, bobId))
+
+	// free dates inside the absence are removed, booked ones are kept
+	absence := models.Absence{
+		UserId:    andrzejId,
+		StartTime: dates[0].StartTime,
+		EndTime:   dates[2].EndTime,
+		Kind:      models.AbsenceVacation,
+	}
+	checkError(t, models.CreateAbsence(ctx, db, &absence))
+	after, err := models.GetDatesWithNamesAssignedTo(ctx, db, andrzejId)
+	checkError(t, err)
+	checkArraySize(t, after, 3)
+
+	collisions, err := models.GetBookedDatesBetween(ctx, db, andrzejId, absence.StartTime, absence.EndTime)
+	checkError(t, err)
+	checkArraySize(t, collisions, 1)
+	if collisions[0].Id != dates[1].Id {
+		t.Errorf("invalid colliding date %+v", collisions[0])
+	}
+
+	_, err = models.CreateDate(ctx, db, dates[0].StartTime, dates[0].EndTime, andrzejId)
+	if err != models.ErrEmployeeAbsent {
+		t.Errorf("expected ErrEmployeeAbsent, got %v", err)
+	}
+
+	// only slots outside the absence and other dates are created
+	slots := []models.Slot{
+		{dates[0].StartTime, dates[0].EndTime},
+		{dates[3].StartTime, dates[3].EndTime},
+		{dates[4].EndTime, dates[4].EndTime.Add(time.Hour)},
+	}
+	created, err := models.CreateDates(ctx, db, andrzejId, slots)
+	checkError(t, err)
+	if created != 1 {
+		t.Errorf("expected 1 created date, got %d", created)
+	}
+
+	absences, err := models.GetAbsences(ctx, db, andrzejId, time.Now())
+	checkError(t, err)
+	checkArraySize(t, absences, 1)
+	checkError(t, models.DeleteAbsence(ctx, db, absences[0].Id, andrzejId))
+	_, err = models.CreateDate(ctx, db, dates[0].StartTime, dates[0].EndTime, andrzejId)
+	checkError(t, err)
+}
+
+func TestEditDates(t *testing.T) {
+	db := initTestingDB()
+	const andrzejId = 2
+	const fabianId = 3
+	const bobId = 4
+
+	date, err := models.GetDateById(ctx, db, 1)
+	checkError(t, err)
+	if date.StartTime.Location() != time.UTC {
+		t.Errorf("expected times to be read in UTC, got %v", date.StartTime.Location())
+	}
+	date.StartTime = date.StartTime.Add(time.Hour)
+	checkError(t, models.UpdateDate(ctx, db, date))
+	updated, err := models.GetDateById(ctx, db, 1)
+	checkError(t, err)
+	if !updated.StartTime.Equal(date.StartTime) {
+		t.Errorf("expected the date to be moved, got %v", updated.StartTime)
+	}
+
+	checkError(t, models.SetDateBookedBy(ctx, db, 2, bobId))
+	booked, err := models.GetDateById(ctx, db, 2)
+	checkError(t, err)
+	if err := models.UpdateDate(ctx, db, booked); err != models.ErrDateTaken {
+		t.Errorf("expected ErrDateTaken, got %v", err)
+	}
+	if err := models.DeleteDate(ctx, db, 2); err != models.ErrDateTaken {
+		t.Errorf("expected ErrDateTaken, got %v", err)
+	}
+	checkError(t, models.DeleteDate(ctx, db, 1))
+
+	// moving into an absence changes nothing
+	dates, err := models.GetDatesByIds(ctx, db, []int{2, 3})
+	checkError(t, err)
+	checkArraySize(t, dates, 2)
+	absence := models.Absence{
+		UserId:    andrzejId,
+		StartTime: dates[1].EndTime,
+		EndTime:   dates[1].EndTime.Add(time.Hour),
+		Kind:      models.AbsenceOther,
+	}
+	checkError(t, models.CreateAbsence(ctx, db, &absence))
+	for _, d := range dates {
+		d.StartTime, d.EndTime = d.StartTime.Add(time.Hour), d.EndTime.Add(time.Hour)
+	}
+	if err := models.MoveDates(ctx, db, dates); err != models.ErrEmployeeAbsent {
+		t.Errorf("expected ErrEmployeeAbsent, got %v", err)
+	}
+	unchanged, err := models.GetDateById(ctx, db, 2)
+	checkError(t, err)
+	if !unchanged.StartTime.Equal(booked.StartTime) {
+		t.Errorf("expected the date not to be moved")
+	}
+
+	// dates may take the places of each other, but not overlap other dates
+	dates, err = models.GetDatesByIds(ctx, db, []int{4, 5})
+	checkError(t, err)
+	for _, d := range dates {
+		d.StartTime, d.EndTime = d.StartTime.Add(time.Hour), d.EndTime.Add(time.Hour)
+	}
+	checkError(t, models.MoveDates(ctx, db, dates))
+	dates, err = models.GetDatesByIds(ctx, db, []int{3})
+	checkError(t, err)
+	dates[0].AssignedTo = fabianId
+	if err := models.MoveDates(ctx, db, dates); err != models.ErrDatesOverlap {
+		t.Errorf("expected ErrDatesOverlap, got %v", err)
+	}
+	dates[0].AssignedTo = andrzejId
+	dates[0].StartTime = dates[0].StartTime.Add(-time.Minute)
+	if err := models.UpdateDate(ctx, db, dates[0]); err != models.ErrDatesOverlap {
+		t.Errorf("expected ErrDatesOverlap, got %v", err)
+	}
+
+	// removing booked dates cancels their bookings
+	checkError(t, models.DeleteDates(ctx, db, []*models.Date{booked}, andrzejId, "closed"))
+	cancellations, err := models.GetCancellationsBookedBy(ctx, db, bobId)
+	checkError(t, err)
+	checkArraySize(t, cancellations, 1)
+	if cancellations[0].Reason != "closed" || cancellations[0].CancelledBy != andrzejId {
+		t.Errorf("invalid cancellation %+v", cancellations[0])
+	}
+	if _, err := models.GetDateById(ctx, db, 2); err != models.ErrNotFound {
+		t.Errorf("expected the date to be deleted, got %v", err)
+	}
+}
+
+func TestHealth(t *testing.T) {
+	db := initTestingDB()
+	checkError(t, models.CheckSchema(ctx, db))
+
+	before := models.QueryDuration.Count("query")
+	n, err := models.CountActiveSessions(ctx, db, time.Now())
+	checkError(t, err)
+	if n != 0 {
+		t.Errorf("Expected no sessions, got %d", n)
+	}
+	if models.QueryDuration.Count("query") <= before {
+		t.Error("Expected the query to be timed")
+	}
+
+	checkError(t, models.CreateSession(ctx, db, "expired", 1, time.Now().Add(-time.Hour)))
+	checkError(t, models.CreateSession(ctx, db, "active", 1, time.Now().Add(time.Hour)))
+	n, err = models.CountActiveSessions(ctx, db, time.Now())
+	checkError(t, err)
+	if n != 1 {
+		t.Errorf("Expected one active session, got %d", n)
+	}
+
+	// tables from an older version are found
+	_, err = db.Exec(`ALTER TABLE users DROP COLUMN timezone`)
+	checkError(t, err)
+	if err = models.CheckSchema(ctx, db); err == nil {
+		t.Error("Expected an error for a missing column")
+	}
+	_, err = db.Exec(`DROP TABLE notifications`)
+	checkError(t, err)
+	if err = models.CheckSchema(ctx, db); err == nil {
+		t.Error("Expected an error for a missing table")
+	}
+}
+
+func TestTypedErrors(t *testing.T) {
+	db := initTestingDB()
+
+	if _, err := models.GetUserById(ctx, db, 100); err != models.ErrNotFound {
+		t.Errorf("Expected ErrNotFound for a missing user, got %v", err)
+	}
+	if _, err := models.GetSessionByToken(ctx, db, "missing"); err != models.ErrNotFound {
+		t.Errorf("Expected ErrNotFound for a missing session, got %v", err)
+	}
+	missing := &models.Date{Id: 100, StartTime: time.Now(), EndTime: time.Now().Add(time.Hour), AssignedTo: 2}
+	if err := models.UpdateDate(ctx, db, missing); err != models.ErrNotFound {
+		t.Errorf("Expected ErrNotFound for a missing date, got %v", err)
+	}
+
+	err := models.CreateUser(ctx, db, "Bob", "bob", "456", models.RoleCustomer)
+	if !errors.Is(err, models.ErrConflict) {
+		t.Errorf("Expected a conflict for a taken username, got %v", err)
+	}
+	checkError(t, models.BookDate(ctx, db, 1, 4, nil))
+	err = models.BookDate(ctx, db, 1, 1, nil)
+	if err != models.ErrDateTaken || !errors.Is(err, models.ErrConflict) {
+		t.Errorf("Expected ErrDateTaken to be a conflict, got %v", err)
+	}
+}
+
+func TestQueryTimeout(t *testing.T) {
+	initTestingDB().Close()
+	db := models.ConnectToDatabase("testing.db", 50*time.Millisecond)
+	defer db.Close()
+
+	// sqlite runs the query while the rows are read
+	var n int
+	start := time.Now()
+	err := db.QueryRowContext(ctx, `
+WITH RECURSIVE c(x) AS (SELECT 1 UNION ALL SELECT x + 1 FROM c)
+SELECT COUNT(*) FROM c`).Scan(&n)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the query to time out, got %v", err)
+	} else if time.Since(start) > time.Second {
+		t.Errorf("The query was stopped only after %s", time.Since(start))
+	}
+
+	users, err := models.GetUsers(ctx, db)
+	checkError(t, err)
+	checkArraySize(t, users, 4)
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := models.GetUsers(cancelled, db); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected the cancelled context to stop the query, got %v", err)
+	}
+}
+
+func TestSearchFreeDates(t *testing.T) {
+	db := initTestingDB()
+	const andrzejId = 2
+	const fabianId = 3
+
+	// days after the sample dates, which are in the next hours
+	now := time.Now().UTC()
+	day := time.Date(now.Year(), now.Month(), now.Day()+10, 0, 0, 0, 0, time.UTC)
+	at := func(days int, hour int, minute int) time.Time {
+		return day.AddDate(0, 0, days).Add(time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute)
+	}
+	create := func(start time.Time, end time.Time, assignedTo int) int {
+		id, err := models.CreateDate(ctx, db, start, end, assignedTo)
+		checkError(t, err)
+		return id
+	}
+	andrzejMorning := create(at(0, 9, 0), at(0, 10, 0), andrzejId)
+	fabianMorning := create(at(0, 9, 0), at(0, 10, 0), fabianId)
+	andrzejShort := create(at(0, 14, 0), at(0, 14, 30), andrzejId)
+	fabianNextDay := create(at(1, 8, 0), at(1, 9, 0), fabianId)
+	booked := create(at(1, 10, 0), at(1, 11, 0), fabianId)
+	checkError(t, models.SetDateBookedBy(ctx, db, booked, 4))
+
+	search := func(s models.DateSearch, expected ...int) {
+		t.Helper()
+		s.From, s.To, s.Location = day, day.AddDate(0, 0, 2), time.UTC
+		dates, err := models.SearchFreeDates(ctx, db, s)
+		checkError(t, err)
+		var ids []int
+		for _, d := range dates {
+			ids = append(ids, d.Id)
+		}
+		if len(ids) != len(expected) {
+			t.Errorf("expected dates %v, got %v", expected, ids)
+			return
+		}
+		for i := range ids {
+			if ids[i] != expected[i] {
+				t.Errorf("expected dates %v, got %v", expected, ids)
+				return
+			}
+		}
+	}
+
+	search(models.DateSearch{}, andrzejMorning, fabianMorning, andrzejShort, fabianNextDay)
+	search(models.DateSearch{Limit: 2}, andrzejMorning, fabianMorning)
+	search(models.DateSearch{After: 8 * 60, Before: 12 * 60, Duration: time.Hour},
+		andrzejMorning, fabianMorning, fabianNextDay)
+	search(models.DateSearch{After: 13 * 60}, andrzejShort)
+	search(models.DateSearch{Duration: 45 * time.Minute, After: 13 * 60})
+	search(models.DateSearch{Before: 9*60 + 30}, fabianNextDay)
+	search(models.DateSearch{Weekdays: []time.Weekday{day.AddDate(0, 0, 1).Weekday()}}, fabianNextDay)
+
+	// preferred employees come first on every day, but not before earlier days
+	search(models.DateSearch{Employees: []int{fabianId}},
+		fabianMorning, andrzejMorning, andrzejShort, fabianNextDay)
+	search(models.DateSearch{Employees: []int{andrzejId}, OnlyEmployees: true},
+		andrzejMorning, andrzejShort)
+}
+
+func TestUserSlug(t *testing.T) {
+	db := initTestingDB()
+	const andrzejId = 2
+	const fabianId = 3
+
+	andrzej, err := models.GetUserById(ctx, db, andrzejId)
+	checkError(t, err)
+	andrzej.Slug = "andrzej"
+	andrzej.Services = "haircut\n\n  beard trim \n"
+	checkError(t, models.UpdateUserProfile(ctx, db, andrzej))
+
+	u, err := models.GetUserBySlug(ctx, db, "andrzej")
+	checkError(t, err)
+	if u.Id != andrzejId {
+		t.Errorf("expected user %d, got %d", andrzejId, u.Id)
+	}
+	if services := u.ServiceList(); len(services) != 2 || services[1] != "beard trim" {
+		t.Errorf("unexpected services %q", services)
+	}
+	if _, err := models.GetUserBySlug(ctx, db, ""); err != models.ErrNotFound {
+		t.Errorf("expected ErrNotFound for the empty slug, got %v", err)
+	}
+
+	// many users have no page, but a page belongs to one user
+	fabian, err := models.GetUserById(ctx, db, fabianId)
+	checkError(t, err)
+	checkError(t, models.UpdateUserProfile(ctx, db, fabian))
+	fabian.Slug = "andrzej"
+	if err := models.UpdateUserProfile(ctx, db, fabian); !errors.Is(err, models.ErrConflict) {
+		t.Errorf("expected ErrConflict, got %v", err)
+	}
+
+	checkError(t, models.AnonymizeUser(ctx, db, andrzejId, "random"))
+	if _, err := models.GetUserBySlug(ctx, db, "andrzej"); err != models.ErrNotFound {
+		t.Errorf("expected the page of an erased user to be gone, got %v", err)
+	}
 }
 
 func TestSession(t *testing.T) {
@@ -100,21 +750,21 @@ func TestSession(t *testing.T) {
 
 	const token = "secret"
 
-	err := models.CreateSession(db, token, 1, time.Now().Add(time.Hour))
+	err := models.CreateSession(ctx, db, token, 1, time.Now().Add(time.Hour))
 	checkError(t, err)
 
-	sess, err := models.GetSessionByToken(db, token)
+	sess, err := models.GetSessionByToken(ctx, db, token)
 	checkError(t, err)
 
 	if sess.IsExpired() {
 		t.Errorf("session should not be expired");
 	}
 
-	err = models.DeleteSession(db, token)
+	err = models.DeleteSession(ctx, db, token)
 	checkError(t, err)
 
 /*
-	sess, err = models.GetSessionByToken(db, token)
+	sess, err = models.GetSessionByToken(ctx, db, token)
 	checkError(t, err)
 
 	if sess != nil {
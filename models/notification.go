@@ -0,0 +1,64 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// notifications are shown to users in the application
+// the next time they look at their bookings
+const sqlNotificationTable = `
+DROP TABLE IF EXISTS notifications;
+CREATE TABLE notifications (
+	id      INTEGER PRIMARY KEY AUTOINCREMENT,
+	userId  INTEGER NOT NULL,
+	time    INTEGER NOT NULL,
+	message TEXT NOT NULL,
+	read    BOOL NOT NULL DEFAULT 0,
+	FOREIGN KEY(userId) REFERENCES users(id)
+);
+CREATE INDEX notificationsUserId ON notifications(userId);`
+
+type Notification struct {
+	Id      int
+	UserId  int
+	Time    time.Time
+	Message string
+	Read    bool
+}
+
+func notificationFromRow(row scannable) (*Notification, error) {
+	var n Notification
+	var t int64
+	err := row.Scan(&n.Id, &n.UserId, &t, &n.Message, &n.Read)
+	n.Time = fromUnix(t)
+	return &n, err
+}
+
+const sqlNotificationCreate = `
+INSERT INTO notifications (userId, time, message) VALUES (?, ?, ?)`
+
+func CreateNotification(ctx context.Context, db *sql.DB, userId int, message string) error {
+	_, err := db.ExecContext(ctx, sqlNotificationCreate, userId, time.Now().Unix(), message)
+	return err
+}
+
+const sqlNotificationsUnread = `
+SELECT * FROM notifications WHERE userId = ? AND read = 0 ORDER BY id DESC`
+
+func GetUnreadNotifications(ctx context.Context, db *sql.DB, userId int) ([]*Notification, error) {
+	rows, err := db.QueryContext(ctx, sqlNotificationsUnread, userId)
+	if err != nil {
+		return nil, err
+	}
+	return readFromRows(rows, notificationFromRow)
+}
+
+const sqlNotificationsMarkRead = `
+UPDATE notifications SET read = 1 WHERE userId = ?`
+
+func MarkNotificationsRead(ctx context.Context, db *sql.DB, userId int) error {
+	_, err := db.ExecContext(ctx, sqlNotificationsMarkRead, userId)
+	return err
+}
@@ -0,0 +1,201 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+)
+
+const sqlRoleTable = `
+DROP TABLE IF EXISTS roles;
+CREATE TABLE roles (
+	id   INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL UNIQUE
+);
+DROP TABLE IF EXISTS rolePermissions;
+CREATE TABLE rolePermissions (
+	roleId     INTEGER NOT NULL,
+	permission TEXT NOT NULL,
+	PRIMARY KEY(roleId, permission),
+	FOREIGN KEY(roleId) REFERENCES roles(id)
+);
+INSERT INTO roles (id, name) VALUES (1, 'Admin'), (2, 'Employee'), (3, 'Customer');
+INSERT INTO rolePermissions (roleId, permission) VALUES
+	(1, 'own_slots'),
+	(1, 'manage_slots'),
+	(1, 'manage_users'),
+	(1, 'view_all_bookings'),
+	(1, 'cancel_any_booking'),
+	(1, 'edit_settings'),
+	(1, 'view_audit_log'),
+	(2, 'own_slots');`
+
+// built-in roles, the admin role always has all permissions
+const (
+	RoleAdmin    = 1
+	RoleEmployee = 2
+	RoleCustomer = 3
+)
+
+const (
+	PermOwnSlots         = "own_slots" // offers slots which customers can book
+	PermManageSlots      = "manage_slots"
+	PermManageUsers      = "manage_users"
+	PermViewAllBookings  = "view_all_bookings"
+	PermCancelAnyBooking = "cancel_any_booking"
+	PermEditSettings     = "edit_settings"
+	PermViewAuditLog     = "view_audit_log"
+)
+
+type PermissionInfo struct {
+	Name        string
+	Description string
+}
+
+// Permissions lists every permission in the order shown to admins
+var Permissions = []PermissionInfo{
+	{PermOwnSlots, "has own dates which customers can book"},
+	{PermManageSlots, "adds dates for any employee"},
+	{PermManageUsers, "creates users and assigns roles"},
+	{PermViewAllBookings, "sees dates and bookings of all employees"},
+	{PermCancelAnyBooking, "cancels bookings of any customer"},
+	{PermEditSettings, "changes application settings"},
+	{PermViewAuditLog, "browses and exports the audit log"},
+}
+
+func IsValidPermission(permission string) bool {
+	for _, p := range Permissions {
+		if p.Name == permission {
+			return true
+		}
+	}
+	return false
+}
+
+type Role struct {
+	Id          int
+	Name        string
+	Permissions map[string]bool
+}
+
+func (r *Role) Has(permission string) bool {
+	return r.Permissions[permission]
+}
+
+func (r *Role) IsBuiltIn() bool {
+	return r.Id == RoleAdmin || r.Id == RoleEmployee || r.Id == RoleCustomer
+}
+
+// CanGrant reports whether the user may give the permissions to others,
+// which they can only do with the permissions they have themselves
+func (u *User) CanGrant(permissions map[string]bool) bool {
+	for p, granted := range permissions {
+		if granted && !u.Can(p) {
+			return false
+		}
+	}
+	return true
+}
+
+// CanAssign reports whether the user may give the role to others,
+// the admin role is given only by admins
+func (u *User) CanAssign(role *Role) bool {
+	if role.Id == RoleAdmin {
+		return u.RoleId == RoleAdmin
+	}
+	return u.CanGrant(role.Permissions)
+}
+
+// CanManage reports whether the user may change the account of the
+// other user, whose role they have to be able to assign
+func (u *User) CanManage(other *User) bool {
+	return u.CanAssign(&Role{Id: other.RoleId, Permissions: other.Permissions})
+}
+
+func parsePermissions(list string) map[string]bool {
+	perms := make(map[string]bool)
+	for _, p := range strings.Split(list, ",") {
+		if p != "" {
+			perms[p] = true
+		}
+	}
+	return perms
+}
+
+func roleFromRow(row scannable) (*Role, error) {
+	var r Role
+	var perms string
+	err := row.Scan(&r.Id, &r.Name, &perms)
+	r.Permissions = parsePermissions(perms)
+	return &r, err
+}
+
+const sqlRoleAll = `
+SELECT roles.*, IFNULL(GROUP_CONCAT(rolePermissions.permission), '')
+FROM roles
+LEFT JOIN rolePermissions ON rolePermissions.roleId = roles.id
+GROUP BY roles.id
+ORDER BY roles.id`
+
+func GetRoles(ctx context.Context, db *sql.DB) ([]*Role, error) {
+	rows, err := db.QueryContext(ctx, sqlRoleAll)
+	if err != nil {
+		return nil, err
+	}
+	return readFromRows(rows, roleFromRow)
+}
+
+const sqlRoleById = `
+SELECT roles.*, IFNULL(GROUP_CONCAT(rolePermissions.permission), '')
+FROM roles
+LEFT JOIN rolePermissions ON rolePermissions.roleId = roles.id
+WHERE roles.id = ?
+GROUP BY roles.id`
+
+func GetRoleById(ctx context.Context, db *sql.DB, id int) (*Role, error) {
+	row := db.QueryRowContext(ctx, sqlRoleById, id)
+	return single(roleFromRow(row))
+}
+
+const sqlRoleCreate = `
+INSERT INTO roles (name) VALUES (?)`
+
+func CreateRole(ctx context.Context, db *sql.DB, name string, permissions []string) (int, error) {
+	res, err := db.ExecContext(ctx, sqlRoleCreate, name)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return int(id), SetRolePermissions(ctx, db, int(id), permissions)
+}
+
+// SetRolePermissions replaces all permissions of the role
+func SetRolePermissions(ctx context.Context, db *sql.DB, roleId int, permissions []string) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM rolePermissions WHERE roleId = ?`, roleId); err != nil {
+		return err
+	}
+	for _, p := range permissions {
+		_, err := tx.ExecContext(ctx, `INSERT INTO rolePermissions (roleId, permission) VALUES (?, ?)`, roleId, p)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+const sqlUserSetRole = `
+UPDATE users SET roleId = ? WHERE id = ?`
+
+func SetUserRole(ctx context.Context, db *sql.DB, userId int, roleId int) error {
+	_, err := db.ExecContext(ctx, sqlUserSetRole, roleId, userId)
+	return err
+}
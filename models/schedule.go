@@ -0,0 +1,342 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// working hours and breaks repeat every week, times are kept as minutes
+// since midnight so that they don't depend on the time zone; absences
+// are single periods like vacations
+const sqlScheduleTables = `
+DROP TABLE IF EXISTS workingHours;
+CREATE TABLE workingHours (
+	userId  INTEGER NOT NULL,
+	weekday INTEGER NOT NULL,
+	start   INTEGER NOT NULL,
+	end     INTEGER NOT NULL,
+	PRIMARY KEY(userId, weekday),
+	FOREIGN KEY(userId) REFERENCES users(id)
+);
+DROP TABLE IF EXISTS breaks;
+CREATE TABLE breaks (
+	id      INTEGER PRIMARY KEY AUTOINCREMENT,
+	userId  INTEGER NOT NULL,
+	weekday INTEGER NOT NULL,
+	start   INTEGER NOT NULL,
+	end     INTEGER NOT NULL,
+	FOREIGN KEY(userId) REFERENCES users(id)
+);
+DROP TABLE IF EXISTS absences;
+CREATE TABLE absences (
+	id        INTEGER PRIMARY KEY AUTOINCREMENT,
+	userId    INTEGER NOT NULL,
+	startTime INTEGER NOT NULL,
+	endTime   INTEGER NOT NULL,
+	kind      TEXT NOT NULL,
+	note      TEXT NOT NULL,
+	FOREIGN KEY(userId) REFERENCES users(id)
+);
+CREATE INDEX absencesUserId ON absences(userId, startTime);`
+
+// kinds of absences
+const (
+	AbsenceVacation  = "vacation"
+	AbsenceSickLeave = "sick_leave"
+	AbsenceOther     = "other"
+)
+
+var AbsenceKinds = []string{AbsenceVacation, AbsenceSickLeave, AbsenceOther}
+
+func IsValidAbsenceKind(kind string) bool {
+	for _, k := range AbsenceKinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// FormatMinutes formats minutes since midnight as HH:MM
+func FormatMinutes(minutes int) string {
+	return fmt.Sprintf("%02d:%02d", minutes/60, minutes%60)
+}
+
+// ParseMinutes parses HH:MM into minutes since midnight, 24:00 is accepted
+func ParseMinutes(clock string) (int, error) {
+	var h, m int
+	if _, err := fmt.Sscanf(clock, "%d:%d", &h, &m); err != nil {
+		return 0, err
+	}
+	if h < 0 || m < 0 || m > 59 || h*60+m > 24*60 {
+		return 0, errors.New("invalid time of day " + clock)
+	}
+	return h*60 + m, nil
+}
+
+// WorkingHours are the hours of an employee on one day of the week
+type WorkingHours struct {
+	UserId  int
+	Weekday time.Weekday
+	Start   int // minutes since midnight
+	End     int
+}
+
+func workingHoursFromRow(row scannable) (*WorkingHours, error) {
+	var h WorkingHours
+	err := row.Scan(&h.UserId, &h.Weekday, &h.Start, &h.End)
+	return &h, err
+}
+
+const sqlWorkingHoursByUser = `
+SELECT * FROM workingHours WHERE userId = ? ORDER BY weekday`
+
+func GetWorkingHours(ctx context.Context, db *sql.DB, userId int) ([]*WorkingHours, error) {
+	rows, err := db.QueryContext(ctx, sqlWorkingHoursByUser, userId)
+	if err != nil {
+		return nil, err
+	}
+	return readFromRows(rows, workingHoursFromRow)
+}
+
+// SetWorkingHours replaces the working hours of the employee,
+// days without an entry are days off
+func SetWorkingHours(ctx context.Context, db *sql.DB, userId int, hours []*WorkingHours) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.ExecContext(ctx, `DELETE FROM workingHours WHERE userId = ?`, userId); err != nil {
+		return err
+	}
+	for _, h := range hours {
+		_, err := tx.ExecContext(ctx, `INSERT INTO workingHours (userId, weekday, start, end) VALUES (?, ?, ?, ?)`,
+			userId, h.Weekday, h.Start, h.End)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Break is a recurring weekly break of an employee
+type Break struct {
+	Id      int
+	UserId  int
+	Weekday time.Weekday
+	Start   int // minutes since midnight
+	End     int
+}
+
+// Period formats the break as HH:MM-HH:MM
+func (b *Break) Period() string {
+	return FormatMinutes(b.Start) + "-" + FormatMinutes(b.End)
+}
+
+func breakFromRow(row scannable) (*Break, error) {
+	var b Break
+	err := row.Scan(&b.Id, &b.UserId, &b.Weekday, &b.Start, &b.End)
+	return &b, err
+}
+
+const sqlBreaksByUser = `
+SELECT * FROM breaks WHERE userId = ? ORDER BY weekday, start`
+
+func GetBreaks(ctx context.Context, db *sql.DB, userId int) ([]*Break, error) {
+	rows, err := db.QueryContext(ctx, sqlBreaksByUser, userId)
+	if err != nil {
+		return nil, err
+	}
+	return readFromRows(rows, breakFromRow)
+}
+
+const sqlBreakCreate = `
+INSERT INTO breaks (userId, weekday, start, end) VALUES (?, ?, ?, ?)`
+
+func CreateBreak(ctx context.Context, db *sql.DB, b *Break) error {
+	_, err := db.ExecContext(ctx, sqlBreakCreate, b.UserId, b.Weekday, b.Start, b.End)
+	return err
+}
+
+// DeleteBreak removes the break if it belongs to the user
+func DeleteBreak(ctx context.Context, db *sql.DB, id int, userId int) error {
+	_, err := db.ExecContext(ctx, `DELETE FROM breaks WHERE id = ? AND userId = ?`, id, userId)
+	return err
+}
+
+type Absence struct {
+	Id        int
+	UserId    int
+	StartTime time.Time
+	EndTime   time.Time
+	Kind      string
+	Note      string
+}
+
+func absenceFromRow(row scannable) (*Absence, error) {
+	var a Absence
+	var start, end int64
+	err := row.Scan(&a.Id, &a.UserId, &start, &end, &a.Kind, &a.Note)
+	a.StartTime = fromUnix(start)
+	a.EndTime = fromUnix(end)
+	return &a, err
+}
+
+const sqlAbsencesByUser = `
+SELECT * FROM absences WHERE userId = ? AND endTime > ? ORDER BY startTime`
+
+// GetAbsences returns absences of the user which end after the given time
+func GetAbsences(ctx context.Context, db *sql.DB, userId int, after time.Time) ([]*Absence, error) {
+	rows, err := db.QueryContext(ctx, sqlAbsencesByUser, userId, after.Unix())
+	if err != nil {
+		return nil, err
+	}
+	return readFromRows(rows, absenceFromRow)
+}
+
+const sqlAbsenceCreate = `
+INSERT INTO absences (userId, startTime, endTime, kind, note) VALUES (?, ?, ?, ?, ?)`
+
+// CreateAbsence adds the absence and removes free dates of the employee
+// inside it, booked dates are kept so that they can be rescheduled
+func CreateAbsence(ctx context.Context, db *sql.DB, a *Absence) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, sqlAbsenceCreate, a.UserId, a.StartTime.Unix(), a.EndTime.Unix(), a.Kind, a.Note)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `DELETE FROM dates WHERE assignedTo = ? AND bookedBy IS NULL
+		AND startTime < ? AND endTime > ?`, a.UserId, a.EndTime.Unix(), a.StartTime.Unix())
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// DeleteAbsence removes the absence if it belongs to the user
+func DeleteAbsence(ctx context.Context, db *sql.DB, id int, userId int) error {
+	_, err := db.ExecContext(ctx, `DELETE FROM absences WHERE id = ? AND userId = ?`, id, userId)
+	return err
+}
+
+const sqlDatesBookedBetween = `
+SELECT dates.*, IFNULL(cus.name, ''), IFNULL(emp.name, '')
+FROM dates
+LEFT JOIN users cus ON dates.bookedBy = cus.Id
+LEFT JOIN users emp ON dates.assignedTo = emp.Id
+WHERE dates.assignedTo = ? AND dates.bookedBy IS NOT NULL
+	AND dates.startTime < ? AND dates.endTime > ?
+ORDER BY dates.startTime`
+
+// GetBookedDatesBetween returns booked dates of the employee
+// overlapping the period, e.g. colliding with an absence
+func GetBookedDatesBetween(ctx context.Context, db *sql.DB, empId int, start time.Time, end time.Time) ([]*DateWithNames, error) {
+	rows, err := db.QueryContext(ctx, sqlDatesBookedBetween, empId, end.Unix(), start.Unix())
+	if err != nil {
+		return nil, err
+	}
+	return readFromRows(rows, dateUserNamesFromRow)
+}
+
+// Slot is a period of a date to be created
+type Slot struct {
+	StartTime time.Time
+	EndTime   time.Time
+}
+
+// PlanSlots splits the working hours on days from..to (inclusive, taken
+// in loc) into slots of the given length, leaving out breaks and absences.
+// Times of day are resolved separately for every day, so slots keep
+// their wall clock time across daylight saving time changes.
+func PlanSlots(
+	hours []*WorkingHours,
+	breaks []*Break,
+	absences []*Absence,
+	from time.Time,
+	to time.Time,
+	length time.Duration,
+	loc *time.Location,
+) []Slot {
+	var slots []Slot
+	step := int(length / time.Minute)
+	if step <= 0 {
+		return slots
+	}
+
+	byDay := make(map[time.Weekday]*WorkingHours)
+	for _, h := range hours {
+		byDay[h.Weekday] = h
+	}
+
+	from = from.In(loc)
+	to = to.In(loc)
+	day := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, loc)
+	last := time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, loc)
+	for ; !day.After(last); day = day.AddDate(0, 0, 1) {
+		h, ok := byDay[day.Weekday()]
+		if !ok {
+			continue
+		}
+
+	next:
+		for m := h.Start; m+step <= h.End; m += step {
+			for _, b := range breaks {
+				if b.Weekday == day.Weekday() && m < b.End && m+step > b.Start {
+					continue next
+				}
+			}
+			start := time.Date(day.Year(), day.Month(), day.Day(), 0, m, 0, 0, loc)
+			end := time.Date(day.Year(), day.Month(), day.Day(), 0, m+step, 0, 0, loc)
+			for _, a := range absences {
+				if start.Before(a.EndTime) && end.After(a.StartTime) {
+					continue next
+				}
+			}
+			slots = append(slots, Slot{start, end})
+		}
+	}
+	return slots
+}
+
+const sqlDateCreateIfFree = `
+INSERT INTO dates (startTime, endTime, assignedTo)
+SELECT ?, ?, ?
+WHERE NOT EXISTS (SELECT 1 FROM absences WHERE userId = ? AND startTime < ? AND endTime > ?)
+	AND NOT EXISTS (SELECT 1 FROM dates WHERE assignedTo = ? AND startTime < ? AND endTime > ?)`
+
+// CreateDates adds the slots as free dates of the employee, skipping
+// those overlapping an absence or another date, and returns how many
+// were created
+func CreateDates(ctx context.Context, db *sql.DB, assignedTo int, slots []Slot) (int, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	created := 0
+	for _, s := range slots {
+		start, end := s.StartTime.Unix(), s.EndTime.Unix()
+		res, err := tx.ExecContext(ctx, sqlDateCreateIfFree, start, end, assignedTo,
+			assignedTo, end, start, assignedTo, end, start)
+		if err != nil {
+			return 0, err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		created += int(n)
+	}
+	return created, tx.Commit()
+}
@@ -0,0 +1,141 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DateSearch describes the free dates a customer is looking for,
+// zero values don't narrow the search down
+type DateSearch struct {
+	// the visit starts within [From, To)
+	From time.Time
+	To   time.Time
+	// days of the week and times of day are taken in Location
+	Location *time.Location
+	Weekdays []time.Weekday
+	// the visit fits between these minutes since midnight,
+	// zero Before means the end of the day
+	After  int
+	Before int
+	// the shortest date which fits the service
+	Duration time.Duration
+	// dates of these employees come first on every day,
+	// or are the only ones if OnlyEmployees is set
+	Employees     []int
+	OnlyEmployees bool
+	Limit         int
+}
+
+// window is a period of one day in which a visit has to fit
+type window struct {
+	day   int
+	start time.Time
+	end   time.Time
+}
+
+// windows resolves the days and times of day of the search to periods,
+// separately for every day so that they keep their wall clock time
+// across daylight saving time changes
+func (s *DateSearch) windows() []window {
+	loc := s.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	allowed := make(map[time.Weekday]bool)
+	for _, d := range s.Weekdays {
+		allowed[d] = true
+	}
+	before := s.Before
+	if before == 0 {
+		before = 24 * 60
+	}
+
+	var windows []window
+	from, to := s.From.In(loc), s.To.In(loc)
+	day := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, loc)
+	for i := 0; day.Before(to); i, day = i+1, day.AddDate(0, 0, 1) {
+		if len(allowed) > 0 && !allowed[day.Weekday()] {
+			continue
+		}
+		start := time.Date(day.Year(), day.Month(), day.Day(), 0, s.After, 0, 0, loc)
+		end := time.Date(day.Year(), day.Month(), day.Day(), 0, before, 0, 0, loc)
+		if start.Before(s.From) {
+			start = s.From
+		}
+		if end.After(s.To) {
+			end = s.To
+		}
+		if start.Before(end) {
+			windows = append(windows, window{i, start, end})
+		}
+	}
+	return windows
+}
+
+// placeholders returns n comma separated groups of question marks
+func placeholders(n int, group string) string {
+	return strings.TrimSuffix(strings.Repeat(group+", ", n), ", ")
+}
+
+// the search joins the windows with free dates starting in them,
+// which is a range scan of the index for every window
+const sqlDateSearch = `
+WITH windows(day, windowStart, windowEnd) AS (VALUES %s)
+SELECT dates.*, '', IFNULL(emp.name, '')
+FROM windows
+JOIN dates ON dates.startTime >= windows.windowStart AND dates.startTime < windows.windowEnd
+LEFT JOIN users emp ON dates.assignedTo = emp.id
+WHERE dates.bookedBy IS NULL
+	AND dates.endTime <= windows.windowEnd
+	AND dates.endTime - dates.startTime >= ?
+	%s
+ORDER BY windows.day, %s dates.startTime, dates.id
+LIMIT ?`
+
+// SearchFreeDates returns free dates matching the search ranked from
+// the best one: earlier days first and on the same day dates of the
+// preferred employees before others, then the earlier ones
+func SearchFreeDates(ctx context.Context, db *sql.DB, s DateSearch) ([]*DateWithNames, error) {
+	windows := s.windows()
+	if len(windows) == 0 {
+		return nil, nil
+	}
+
+	var args []interface{}
+	for _, w := range windows {
+		args = append(args, w.day, w.start.Unix(), w.end.Unix())
+	}
+	args = append(args, int64(s.Duration/time.Second))
+
+	var employees []interface{}
+	for _, id := range s.Employees {
+		employees = append(employees, id)
+	}
+	var filter, order string
+	if len(employees) > 0 {
+		in := "dates.assignedTo IN (" + placeholders(len(employees), "?") + ")"
+		if s.OnlyEmployees {
+			filter = "AND " + in
+		} else {
+			order = in + " DESC,"
+		}
+		// only one of them has placeholders
+		args = append(args, employees...)
+	}
+	limit := s.Limit
+	if limit <= 0 {
+		limit = -1
+	}
+	args = append(args, limit)
+
+	query := fmt.Sprintf(sqlDateSearch, placeholders(len(windows), "(?, ?, ?)"), filter, order)
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return readFromRows(rows, dateUserNamesFromRow)
+}
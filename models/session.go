@@ -1,6 +1,7 @@
 package models
 
 import (
+	"context"
 	"database/sql"
 	"time"
 )
@@ -27,30 +28,50 @@ func sessionFromRow(row scannable) (*Session, error) {
 	var s Session
 	var t int64
 	err := row.Scan(&s.Token, &s.UserId, &t)
-	s.ExpiresAt = time.Unix(t, 0)
+	s.ExpiresAt = fromUnix(t)
 	return &s, err
 }
 
 const sqlSessionByToken = `
 SELECT * FROM sessions WHERE token = ?`
 
-func GetSessionByToken(db *sql.DB, token string) (*Session, error) {
-	row := db.QueryRow(sqlSessionByToken, token)
-	return sessionFromRow(row)
+func GetSessionByToken(ctx context.Context, db *sql.DB, token string) (*Session, error) {
+	row := db.QueryRowContext(ctx, sqlSessionByToken, token)
+	return single(sessionFromRow(row))
 }
 
 const sqlSessionCreate = `
 INSERT INTO sessions (token, userId, expiresAt) VALUES (?, ?, ?)`
 
-func CreateSession(db *sql.DB, token string, userId int, expiresAt time.Time) error {
-	_, err := db.Exec(sqlSessionCreate, token, userId, expiresAt.Unix())
+func CreateSession(ctx context.Context, db *sql.DB, token string, userId int, expiresAt time.Time) error {
+	_, err := db.ExecContext(ctx, sqlSessionCreate, token, userId, expiresAt.Unix())
 	return err
 }
 
 const sqlSessionDelete = `
 DELETE FROM sessions WHERE token = ?`
 
-func DeleteSession(db *sql.DB, token string) error {
-	_, err := db.Exec(sqlSessionDelete, token)
+func DeleteSession(ctx context.Context, db *sql.DB, token string) error {
+	_, err := db.ExecContext(ctx, sqlSessionDelete, token)
 	return err
 }
+
+const sqlSessionDeleteByUser = `
+DELETE FROM sessions WHERE userId = ?`
+
+// DeleteUserSessions signs the user out everywhere
+func DeleteUserSessions(ctx context.Context, db *sql.DB, userId int) error {
+	_, err := db.ExecContext(ctx, sqlSessionDeleteByUser, userId)
+	return err
+}
+
+const sqlSessionByUser = `
+SELECT * FROM sessions WHERE userId = ?`
+
+func GetSessionsByUser(ctx context.Context, db *sql.DB, userId int) ([]*Session, error) {
+	rows, err := db.QueryContext(ctx, sqlSessionByUser, userId)
+	if err != nil {
+		return nil, err
+	}
+	return readFromRows(rows, sessionFromRow)
+}
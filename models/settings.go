@@ -0,0 +1,73 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"time"
+)
+
+const sqlSettingTable = `
+DROP TABLE IF EXISTS settings;
+CREATE TABLE settings (
+	key   TEXT PRIMARY KEY,
+	value TEXT NOT NULL
+);`
+
+// keys of the settings configurable by admins
+const (
+	SettingRequireStaffTotp     = "require_staff_totp"
+	SettingCancelMinNoticeHours = "cancel_min_notice_hours"
+	SettingAllowLateCancel      = "allow_late_cancel"
+	SettingRequireCancelReason  = "require_cancel_reason"
+	SettingNoShowLimit          = "no_show_limit" // 0 turns the rule off
+	SettingNoShowAction         = "no_show_action"
+	SettingApprovalHoldHours    = "approval_hold_hours"
+	SettingTimezone             = "timezone" // IANA name of the zone of the business
+)
+
+// values of SettingNoShowAction
+const (
+	NoShowBlock    = "block"
+	NoShowApproval = "approval"
+)
+
+const sqlSettingByKey = `
+SELECT value FROM settings WHERE key = ?`
+
+// GetSetting returns the value of the setting or def if it was never set
+func GetSetting(ctx context.Context, db *sql.DB, key string, def string) (string, error) {
+	var value string
+	err := db.QueryRowContext(ctx, sqlSettingByKey, key).Scan(&value)
+	if err == sql.ErrNoRows {
+		return def, nil
+	}
+	return value, err
+}
+
+func GetBoolSetting(ctx context.Context, db *sql.DB, key string, def bool) (bool, error) {
+	value, err := GetSetting(ctx, db, key, strconv.FormatBool(def))
+	if err != nil {
+		return def, err
+	}
+	return strconv.ParseBool(value)
+}
+
+// GetLocation returns the time zone of the business, the default one
+// until it's set
+func GetLocation(ctx context.Context, db *sql.DB, def string) (*time.Location, error) {
+	name, err := GetSetting(ctx, db, SettingTimezone, def)
+	if err != nil {
+		return time.Local, err
+	}
+	return time.LoadLocation(name)
+}
+
+const sqlSettingSet = `
+INSERT INTO settings (key, value) VALUES (?, ?)
+ON CONFLICT(key) DO UPDATE SET value = excluded.value`
+
+func SetSetting(ctx context.Context, db *sql.DB, key string, value string) error {
+	_, err := db.ExecContext(ctx, sqlSettingSet, key, value)
+	return err
+}
@@ -0,0 +1,179 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+const sqlTwoFactorTables = `
+DROP TABLE IF EXISTS recoveryCodes;
+CREATE TABLE recoveryCodes (
+	userId   INTEGER NOT NULL,
+	codeHash TEXT NOT NULL,
+	PRIMARY KEY(userId, codeHash),
+	FOREIGN KEY(userId) REFERENCES USER(id)
+);
+DROP TABLE IF EXISTS pendingLogins;
+CREATE TABLE pendingLogins (
+	token     TEXT PRIMARY KEY,
+	userId    INTEGER NOT NULL,
+	expiresAt INTEGER NOT NULL,
+	FOREIGN KEY(userId) REFERENCES USER(id)
+);
+DROP TABLE IF EXISTS trustedDevices;
+CREATE TABLE trustedDevices (
+	token     TEXT PRIMARY KEY,
+	userId    INTEGER NOT NULL,
+	expiresAt INTEGER NOT NULL,
+	FOREIGN KEY(userId) REFERENCES USER(id)
+);`
+
+const sqlUserSetTotp = `
+UPDATE users SET totpSecret = ?, totpEnabled = ? WHERE id = ?`
+
+func SetUserTotp(ctx context.Context, db *sql.DB, userId int, secret string, enabled bool) error {
+	_, err := db.ExecContext(ctx, sqlUserSetTotp, secret, enabled, userId)
+	return err
+}
+
+// DisableUserTotp removes the secret together with all recovery codes
+// and remembered devices of the user
+func DisableUserTotp(ctx context.Context, db *sql.DB, userId int) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	queries := []string{
+		`UPDATE users SET totpSecret = '', totpCounter = 0, totpEnabled = 0 WHERE id = ?`,
+		`DELETE FROM recoveryCodes WHERE userId = ?`,
+		`DELETE FROM trustedDevices WHERE userId = ?`,
+	}
+	for _, query := range queries {
+		if _, err := tx.ExecContext(ctx, query, userId); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// SetRecoveryCodes replaces all recovery codes of the user
+func SetRecoveryCodes(ctx context.Context, db *sql.DB, userId int, codeHashes []string) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM recoveryCodes WHERE userId = ?`, userId); err != nil {
+		return err
+	}
+	for _, hash := range codeHashes {
+		_, err := tx.ExecContext(ctx, `INSERT INTO recoveryCodes (userId, codeHash) VALUES (?, ?)`, userId, hash)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+const sqlRecoveryCodeUse = `
+DELETE FROM recoveryCodes WHERE userId = ? AND codeHash = ?`
+
+// UseRecoveryCode consumes the code, returning false if it didn't exist
+func UseRecoveryCode(ctx context.Context, db *sql.DB, userId int, codeHash string) (bool, error) {
+	res, err := db.ExecContext(ctx, sqlRecoveryCodeUse, userId, codeHash)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+const sqlTotpCounterUse = `
+UPDATE users SET totpCounter = ? WHERE id = ? AND totpCounter < ?`
+
+// UseTotpCounter remembers the time step of an accepted code, returning
+// false if a code of the same or a later step was already used
+func UseTotpCounter(ctx context.Context, db *sql.DB, userId int, counter uint64) (bool, error) {
+	res, err := db.ExecContext(ctx, sqlTotpCounterUse, int64(counter), userId, int64(counter))
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+const sqlRecoveryCodeCount = `
+SELECT COUNT(*) FROM recoveryCodes WHERE userId = ?`
+
+func CountRecoveryCodes(ctx context.Context, db *sql.DB, userId int) (int, error) {
+	var n int
+	err := db.QueryRowContext(ctx, sqlRecoveryCodeCount, userId).Scan(&n)
+	return n, err
+}
+
+// PendingLogin is a login which passed the password check
+// and waits for the second factor
+type PendingLogin struct {
+	Token     string
+	UserId    int
+	ExpiresAt time.Time
+}
+
+func (p *PendingLogin) IsExpired() bool {
+	return time.Now().After(p.ExpiresAt)
+}
+
+func pendingLoginFromRow(row scannable) (*PendingLogin, error) {
+	var p PendingLogin
+	var t int64
+	err := row.Scan(&p.Token, &p.UserId, &t)
+	p.ExpiresAt = fromUnix(t)
+	return &p, err
+}
+
+const sqlPendingLoginCreate = `
+INSERT INTO pendingLogins (token, userId, expiresAt) VALUES (?, ?, ?)`
+
+func CreatePendingLogin(ctx context.Context, db *sql.DB, token string, userId int, expiresAt time.Time) error {
+	_, err := db.ExecContext(ctx, sqlPendingLoginCreate, token, userId, expiresAt.Unix())
+	return err
+}
+
+const sqlPendingLoginByToken = `
+SELECT * FROM pendingLogins WHERE token = ?`
+
+func GetPendingLoginByToken(ctx context.Context, db *sql.DB, token string) (*PendingLogin, error) {
+	row := db.QueryRowContext(ctx, sqlPendingLoginByToken, token)
+	return single(pendingLoginFromRow(row))
+}
+
+const sqlPendingLoginDelete = `
+DELETE FROM pendingLogins WHERE token = ? OR expiresAt < ?`
+
+// DeletePendingLogin removes the login together with all expired ones
+func DeletePendingLogin(ctx context.Context, db *sql.DB, token string) error {
+	_, err := db.ExecContext(ctx, sqlPendingLoginDelete, token, time.Now().Unix())
+	return err
+}
+
+const sqlTrustedDeviceCreate = `
+INSERT INTO trustedDevices (token, userId, expiresAt) VALUES (?, ?, ?)`
+
+func CreateTrustedDevice(ctx context.Context, db *sql.DB, token string, userId int, expiresAt time.Time) error {
+	_, err := db.ExecContext(ctx, sqlTrustedDeviceCreate, token, userId, expiresAt.Unix())
+	return err
+}
+
+const sqlTrustedDeviceCheck = `
+SELECT COUNT(*) FROM trustedDevices WHERE token = ? AND userId = ? AND expiresAt > ?`
+
+// IsTrustedDevice checks whether the device token was remembered for the user
+func IsTrustedDevice(ctx context.Context, db *sql.DB, token string, userId int) (bool, error) {
+	var n int
+	err := db.QueryRowContext(ctx, sqlTrustedDeviceCheck, token, userId, time.Now().Unix()).Scan(&n)
+	return n > 0, err
+}
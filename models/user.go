@@ -1,6 +1,11 @@
 package models
 
-import "database/sql"
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+)
 
 const sqlUserTable = `
 DROP TABLE IF EXISTS users;
@@ -9,79 +14,370 @@ CREATE TABLE users (
  	name 	 TEXT NOT NULL,
  	username TEXT NOT NULL UNIQUE,
  	password TEXT NOT NULL,
- 	userType INTEGER NOT NULL
-);`
+ 	roleId   INTEGER NOT NULL,
+ 	failedLogins INTEGER NOT NULL DEFAULT 0,
+ 	lockedUntil  INTEGER NOT NULL DEFAULT 0,
+ 	totpSecret   TEXT NOT NULL DEFAULT '',
+ 	totpCounter  INTEGER NOT NULL DEFAULT 0,
+ 	totpEnabled  INTEGER NOT NULL DEFAULT 0,
+ 	disabled     INTEGER NOT NULL DEFAULT 0,
+ 	email        TEXT NOT NULL DEFAULT '',
+ 	phone        TEXT NOT NULL DEFAULT '',
+ 	language     TEXT NOT NULL DEFAULT '',
+ 	notifyEmail  INTEGER NOT NULL DEFAULT 0,
+ 	notifySms    INTEGER NOT NULL DEFAULT 0,
+ 	requiresApproval INTEGER NOT NULL DEFAULT 0,
+ 	timezone     TEXT NOT NULL DEFAULT '',
+ 	slug         TEXT NOT NULL DEFAULT '',
+ 	bio          TEXT NOT NULL DEFAULT '',
+ 	photo        TEXT NOT NULL DEFAULT '',
+ 	services     TEXT NOT NULL DEFAULT '',
+ 	FOREIGN KEY(roleId) REFERENCES roles(id)
+);
+-- only users with a public page have a slug
+CREATE UNIQUE INDEX usersSlug ON users(slug) WHERE slug != '';`
 
 type User struct {
 	Id       int
 	Name     string
 	Username string
 	Password string
-	UserType int
+	RoleId   int
+
+	FailedLogins int       // consecutive failed login attempts
+	LockedUntil  time.Time // zero time if the account was never locked
+
+	TotpSecret  string // set during enrolment, before TotpEnabled
+	TotpCounter int64  // time step of the last accepted code
+	TotpEnabled bool
+
+	Disabled bool // can't sign in nor book, but the history is kept
+
+	// contact details maintained by the user on the profile page
+	Email       string
+	Phone       string
+	Language    string // empty if the user hasn't chosen one
+	Timezone    string // IANA name, empty to use the one of the business
+	NotifyEmail bool
+	NotifySms   bool
+
+	// bookings of dates assigned to the user wait for their approval
+	RequiresApproval bool
+
+	// the public page of an employee at /e/{Slug}/, which they don't
+	// have while the slug is empty
+	Slug     string
+	Bio      string
+	Photo    string // URL of the picture
+	Services string // one per line
+
+	RoleName    string
+	Permissions map[string]bool // granted by the role
 }
 
-const (
-	UserTypeAdmin    = iota // 0
-	UserTypeEmployee = iota // 1
-	UserTypeCustomer = iota // 2
-)
+func (u *User) Can(permission string) bool {
+	return u.Permissions[permission]
+}
 
-func (u *User) IsAdmin() bool {
-	return u.UserType == UserTypeAdmin
+// IsStaff reports whether the user has any permissions beyond booking
+func (u *User) IsStaff() bool {
+	return len(u.Permissions) > 0
 }
 
-func (u *User) IsEmployee() bool {
-	return u.UserType <= UserTypeEmployee
+// ServiceList returns the non-empty lines of Services
+func (u *User) ServiceList() []string {
+	var services []string
+	for _, line := range strings.Split(u.Services, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			services = append(services, line)
+		}
+	}
+	return services
 }
 
-func (u *User) IsCustomer() bool {
-	return true
-	// or maybe return u.UserType == UserTypeCustomer?
+func (u *User) IsLocked() bool {
+	return time.Now().Before(u.LockedUntil)
 }
 
 func userFromRow(row scannable) (*User, error) {
 	var u User
-	err := row.Scan(&u.Id, &u.Name, &u.Username, &u.Password, &u.UserType)
+	var lockedUntil int64
+	var perms string
+	err := row.Scan(&u.Id, &u.Name, &u.Username, &u.Password, &u.RoleId,
+		&u.FailedLogins, &lockedUntil, &u.TotpSecret, &u.TotpCounter, &u.TotpEnabled,
+		&u.Disabled, &u.Email, &u.Phone, &u.Language, &u.NotifyEmail, &u.NotifySms,
+		&u.RequiresApproval, &u.Timezone, &u.Slug, &u.Bio, &u.Photo, &u.Services,
+		&u.RoleName, &perms)
+	u.Permissions = parsePermissions(perms)
+	if lockedUntil != 0 {
+		u.LockedUntil = fromUnix(lockedUntil)
+	}
 	return &u, err
 }
 
-const sqlUserByUsername = `
-SELECT * FROM users WHERE username = ?`
+// selects users together with their role and its permissions
+const sqlUserSelect = `
+SELECT users.*, IFNULL(roles.name, ''),
+	IFNULL((SELECT GROUP_CONCAT(permission) FROM rolePermissions WHERE roleId = users.roleId), '')
+FROM users
+LEFT JOIN roles ON roles.id = users.roleId`
 
-func GetUserByUsername(db *sql.DB, username string) (*User, error) {
-	row := db.QueryRow(sqlUserByUsername, username)
-	return userFromRow(row)
+const sqlUserByUsername = sqlUserSelect + `
+WHERE username = ?`
+
+func GetUserByUsername(ctx context.Context, db *sql.DB, username string) (*User, error) {
+	row := db.QueryRowContext(ctx, sqlUserByUsername, username)
+	return single(userFromRow(row))
+}
+
+const sqlUserById = sqlUserSelect + `
+WHERE users.id = ?`
+
+func GetUserById(ctx context.Context, db *sql.DB, id int) (*User, error) {
+	row := db.QueryRowContext(ctx, sqlUserById, id)
+	return single(userFromRow(row))
 }
 
-const sqlUserById = `
-SELECT * FROM users WHERE id = ?`
+const sqlUserBySlug = sqlUserSelect + `
+WHERE users.slug = ? AND users.slug != ''`
 
-func GetUserById(db *sql.DB, id int) (*User, error) {
-	row := db.QueryRow(sqlUserById, id)
-	return userFromRow(row)
+// GetUserBySlug returns the user whose public page is at the slug
+func GetUserBySlug(ctx context.Context, db *sql.DB, slug string) (*User, error) {
+	row := db.QueryRowContext(ctx, sqlUserBySlug, slug)
+	return single(userFromRow(row))
 }
 
 const sqlUserCreate = `
-INSERT INTO users (name, username, password, userType) VALUES (?, ?, ?, ?)`
+INSERT INTO users (name, username, password, roleId) VALUES (?, ?, ?, ?)`
 
 func CreateUser(
+	ctx context.Context,
 	db *sql.DB,
 	name string,
 	username string,
 	password string,
-	userType int,
+	roleId int,
 ) error {
-	_, err := db.Exec(sqlUserCreate, name, username, password, userType)
+	_, err := db.ExecContext(ctx, sqlUserCreate, name, username, password, roleId)
+	return err
+}
+
+const sqlUserWithPermission = sqlUserSelect + `
+WHERE users.roleId IN (SELECT roleId FROM rolePermissions WHERE permission = ?)`
+
+func GetUsersWithPermission(ctx context.Context, db *sql.DB, permission string) ([]*User, error) {
+	rows, err := db.QueryContext(ctx, sqlUserWithPermission, permission)
+	if err != nil {
+		return nil, err
+	}
+	return readFromRows(rows, userFromRow)
+}
+
+const sqlUserAll = sqlUserSelect + `
+ORDER BY users.name`
+
+func GetUsers(ctx context.Context, db *sql.DB) ([]*User, error) {
+	rows, err := db.QueryContext(ctx, sqlUserAll)
+	if err != nil {
+		return nil, err
+	}
+	return readFromRows(rows, userFromRow)
+}
+
+const sqlUserSetLoginFailures = `
+UPDATE users SET failedLogins = ?, lockedUntil = ? WHERE id = ?`
+
+// SetUserLoginFailures stores the failed attempts counter and lockout time.
+// Pass the zero time to leave the account unlocked.
+func SetUserLoginFailures(ctx context.Context, db *sql.DB, id int, failures int, lockedUntil time.Time) error {
+	var t int64
+	if !lockedUntil.IsZero() {
+		t = lockedUntil.Unix()
+	}
+	_, err := db.ExecContext(ctx, sqlUserSetLoginFailures, failures, t, id)
 	return err
 }
 
-const sqlUserByType = `
-SELECT * FROM users WHERE userType <= ?`
+func UnlockUser(ctx context.Context, db *sql.DB, id int) error {
+	return SetUserLoginFailures(ctx, db, id, 0, time.Time{})
+}
+
+const sqlUserLocked = sqlUserSelect + `
+WHERE lockedUntil > ?`
 
-func GetUsersByType(db *sql.DB, userType int) ([]*User, error) {
-	rows, err := db.Query(sqlUserByType, userType)
+func GetLockedUsers(ctx context.Context, db *sql.DB) ([]*User, error) {
+	rows, err := db.QueryContext(ctx, sqlUserLocked, time.Now().Unix())
 	if err != nil {
 		return nil, err
 	}
 	return readFromRows(rows, userFromRow)
 }
+
+const sqlUserSearch = sqlUserSelect + `
+WHERE users.name LIKE ? ESCAPE '\' OR users.username LIKE ? ESCAPE '\'
+ORDER BY users.name`
+
+// SearchUsers returns users whose name or username contains the query
+func SearchUsers(ctx context.Context, db *sql.DB, query string) ([]*User, error) {
+	pattern := "%" + strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(query) + "%"
+	rows, err := db.QueryContext(ctx, sqlUserSearch, pattern, pattern)
+	if err != nil {
+		return nil, err
+	}
+	return readFromRows(rows, userFromRow)
+}
+
+const sqlUserUpdate = `
+UPDATE users SET name = ?, username = ?, roleId = ?, disabled = ?, requiresApproval = ? WHERE id = ?`
+
+// UpdateUser saves the name, username, role, disabled and approval flags of the user
+func UpdateUser(ctx context.Context, db *sql.DB, u *User) error {
+	_, err := db.ExecContext(ctx, sqlUserUpdate, u.Name, u.Username, u.RoleId, u.Disabled, u.RequiresApproval, u.Id)
+	return err
+}
+
+const sqlUserUpdateProfile = `
+UPDATE users SET name = ?, email = ?, phone = ?, language = ?, timezone = ?,
+	notifyEmail = ?, notifySms = ?, slug = ?, bio = ?, photo = ?, services = ?
+WHERE id = ?`
+
+// UpdateUserProfile saves the details which users can change themselves,
+// a slug taken by another user is an ErrConflict
+func UpdateUserProfile(ctx context.Context, db *sql.DB, u *User) error {
+	_, err := db.ExecContext(ctx, sqlUserUpdateProfile, u.Name, u.Email, u.Phone, u.Language, u.Timezone,
+		u.NotifyEmail, u.NotifySms, u.Slug, u.Bio, u.Photo, u.Services, u.Id)
+	return err
+}
+
+const sqlUserSetPassword = `
+UPDATE users SET password = ? WHERE id = ?`
+
+func SetUserPassword(ctx context.Context, db *sql.DB, id int, password string) error {
+	_, err := db.ExecContext(ctx, sqlUserSetPassword, password, id)
+	return err
+}
+
+// DeleteUser removes the user together with everything tied to their account.
+// Upcoming bookings of the user are cancelled by deletedBy. Upcoming dates
+// assigned to the user are moved to reassignTo, with the same checks as
+// MoveDates, or deleted with their bookings cancelled if it's -1. Past dates
+// stay for the history of the other side, referencing the removed id.
+// The upcoming dates assigned to and booked by the user are returned
+// as they were before, so that the other side can be notified.
+func DeleteUser(ctx context.Context, db *sql.DB, id int, reassignTo int, deletedBy int, reason string) ([]*Date, []*Date, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().Unix()
+	// cancellations of the user's bookings go with their account,
+	// only the ones recorded below stay for the employees
+	if _, err = tx.ExecContext(ctx, `DELETE FROM cancellations WHERE bookedBy = ?`, id); err != nil {
+		return nil, nil, err
+	}
+	rows, err := tx.QueryContext(ctx, sqlDateFutureBookedBy, id, now)
+	if err != nil {
+		return nil, nil, err
+	}
+	bookings, err := readFromRows(rows, dateFromRow)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, d := range bookings {
+		if err = cancelBooking(ctx, tx, d, deletedBy, reason, false); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	rows, err = tx.QueryContext(ctx, sqlDateFutureAssignedTo, id, now)
+	if err != nil {
+		return nil, nil, err
+	}
+	dates, err := readFromRows(rows, dateFromRow)
+	if err != nil {
+		return nil, nil, err
+	}
+	if reassignTo != -1 {
+		moved := make([]*Date, len(dates))
+		for i, d := range dates {
+			m := *d
+			m.AssignedTo = reassignTo
+			moved[i] = &m
+		}
+		err = moveDates(ctx, tx, moved)
+	} else {
+		err = deleteDates(ctx, tx, dates, deletedBy, reason)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	queries := []string{
+		`DELETE FROM dates WHERE assignedTo = ? AND bookedBy IS NULL`,
+	}
+	for _, table := range userAccountTables {
+		queries = append(queries, `DELETE FROM `+table+` WHERE userId = ?`)
+	}
+	for _, table := range []string{"workingHours", "breaks", "absences"} {
+		queries = append(queries, `DELETE FROM `+table+` WHERE userId = ?`)
+	}
+	queries = append(queries, `DELETE FROM users WHERE id = ?`)
+
+	for _, q := range queries {
+		if _, err := tx.ExecContext(ctx, q, id); err != nil {
+			return nil, nil, err
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, nil, err
+	}
+	return dates, bookings, nil
+}
+
+// tables with rows which only serve the account of the user, to sign
+// them in or to send them notifications, removed with the account
+var userAccountTables = []string{"sessions", "recoveryCodes", "pendingLogins", "trustedDevices", "notifications"}
+
+// AnonymizedUserName replaces the name of erased users in the history
+const AnonymizedUserName = "Deleted user"
+
+// AnonymizeUser erases personal data of the user while keeping the row,
+// so that past dates still point to a (placeholder) customer.
+// Future bookings are released and all answers to booking fields removed.
+func AnonymizeUser(ctx context.Context, db *sql.DB, id int, randomPassword string) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().Unix()
+	queries := []struct {
+		sql  string
+		args []interface{}
+	}{
+		{`DELETE FROM pendingBookings WHERE dateId IN
+			(SELECT id FROM dates WHERE bookedBy = ? AND startTime > ?)`, []interface{}{id, now}},
+		{`DELETE FROM bookingAnswers WHERE dateId IN (SELECT id FROM dates WHERE bookedBy = ?)`, []interface{}{id}},
+		{`UPDATE dates SET bookedBy = NULL WHERE bookedBy = ? AND startTime > ?`, []interface{}{id, now}},
+		{`UPDATE cancellations SET reason = '' WHERE bookedBy = ?`, []interface{}{id}},
+		{`UPDATE users SET name = ?, username = 'deleted-' || id, password = ?,
+			email = '', phone = '', language = '', timezone = '', notifyEmail = 0, notifySms = 0,
+			slug = '', bio = '', photo = '', services = '',
+			totpSecret = '', totpCounter = 0, totpEnabled = 0, disabled = 1, roleId = ?
+			WHERE id = ?`, []interface{}{AnonymizedUserName, randomPassword, RoleCustomer, id}},
+	}
+	for _, q := range queries {
+		if _, err := tx.ExecContext(ctx, q.sql, q.args...); err != nil {
+			return err
+		}
+	}
+	for _, table := range userAccountTables {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM `+table+` WHERE userId = ?`, id); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
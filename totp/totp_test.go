@@ -0,0 +1,66 @@
+package totp
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+// test vectors from RFC 6238 appendix B (SHA1)
+func TestRFCVectors(t *testing.T) {
+	key := []byte("12345678901234567890")
+	vectors := []struct {
+		unix int64
+		code string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+
+	for _, v := range vectors {
+		code := hotp(key, counterAt(time.Unix(v.unix, 0)), 8)
+		if code != v.code {
+			t.Errorf("time %d: got %s expected %s", v.unix, code, v.code)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	code, err := Code(secret, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	step, ok := Validate(secret, code, now)
+	if !ok || step != counterAt(now) {
+		t.Errorf("current code should be valid, got step %d", step)
+	}
+	if step, ok := Validate(strings.ToLower(secret), code, now.Add(Period)); !ok || step != counterAt(now) {
+		t.Errorf("code from the previous period should be valid, got step %d", step)
+	}
+	if _, ok := Validate(secret, code, now.Add(5*Period)); ok {
+		t.Errorf("old code should not be valid")
+	}
+	if _, ok := Validate(secret, "12345", now); ok {
+		t.Errorf("short code should not be valid")
+	}
+}
+
+func TestProvisioningURI(t *testing.T) {
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+	uri := ProvisioningURI("Booker", "bob", secret)
+	if !strings.HasPrefix(uri, "otpauth://totp/Booker:bob?") || !strings.Contains(uri, "secret="+secret) {
+		t.Errorf("invalid provisioning uri: %s", uri)
+	}
+}
@@ -0,0 +1,38 @@
+// Package web holds the templates and static files of the interface,
+// they are embedded so the server binary can be run from anywhere.
+package web
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"os"
+)
+
+//go:embed templates static
+var files embed.FS
+
+// FS returns the templates and the static files. With a directory given
+// they are read from its templates/ and static/ subdirectories on every
+// use, so they can be edited without rebuilding the binary.
+func FS(dir string) (templates fs.FS, static fs.FS, err error) {
+	var root fs.FS = files
+	if dir != "" {
+		if info, err := os.Stat(dir); err != nil {
+			return nil, nil, err
+		} else if !info.IsDir() {
+			return nil, nil, fmt.Errorf("%s is not a directory", dir)
+		}
+		root = os.DirFS(dir)
+	}
+	if templates, err = fs.Sub(root, "templates"); err != nil {
+		return nil, nil, err
+	}
+	if static, err = fs.Sub(root, "static"); err != nil {
+		return nil, nil, err
+	}
+	if _, err = fs.Stat(templates, "layout.html"); err != nil {
+		return nil, nil, fmt.Errorf("no templates found: %w", err)
+	}
+	return templates, static, nil
+}